@@ -0,0 +1,546 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/weex/ai_trading/bot/internal/clock"
+	"github.com/weex/ai_trading/bot/internal/config"
+	"github.com/weex/ai_trading/bot/internal/logger"
+	"github.com/weex/ai_trading/bot/internal/ratelimit"
+	"github.com/weex/ai_trading/bot/internal/report"
+	"github.com/weex/ai_trading/bot/internal/strategy"
+	"github.com/weex/ai_trading/bot/internal/trader"
+	"github.com/weex/ai_trading/bot/internal/weex"
+)
+
+// Exit codes: 0 ok, 1 the command failed, 2 usage or config error.
+
+const usageText = `usage: bot [command] [flags]
+
+commands:
+  run                     start trading (default)
+  backtest -data FILE     replay a CSV of market snapshots through the strategy
+  report                  performance of the closed trades in the pnl logs [-json FILE] [-csv FILE]
+  status                  print account equity, positions, leverage settings and open orders
+  flatten -yes            cancel open and plan orders, close every position
+  cancel-all -yes         cancel open orders [-symbol SYM]
+  contracts               print contract specs for the configured symbols
+  ping                    check server time drift and private API access
+  config check [FILE]     validate the config and print it with secrets masked
+
+Every command reads the same config: WEEX_CONFIG plus WEEX_* variables.
+`
+
+func dispatch(cmd string, args []string) int {
+	switch cmd {
+	case "run":
+		return run(args)
+	case "backtest":
+		return backtest(args)
+	case "report":
+		return reportCmd(args)
+	case "status":
+		return status(args)
+	case "flatten":
+		return flatten(args)
+	case "cancel-all":
+		return cancelAll(args)
+	case "contracts":
+		return contracts(args)
+	case "ping":
+		return ping(args)
+	case "config":
+		if len(args) > 0 && args[0] == "check" {
+			return configCheck(args[1:])
+		}
+	case "help", "-h", "--help":
+		fmt.Print(usageText)
+		return 0
+	}
+	return usage()
+}
+
+func usage() int {
+	fmt.Fprint(os.Stderr, usageText)
+	return 2
+}
+
+// loadConfig loads path, or WEEX_CONFIG when empty, and reports problems
+// on stderr.
+func loadConfig(path string) (config.Config, bool) {
+	if path == "" {
+		path = os.Getenv("WEEX_CONFIG")
+	}
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return cfg, false
+	}
+	return cfg, true
+}
+
+func newLogger(cfg config.Config, clk clock.Clock) *logger.Logger {
+	return logger.New(logger.Config{
+		Dir:           cfg.LogDir,
+		BufferSize:    cfg.LogBufferSize,
+		Overflow:      logger.OverflowPolicy(strings.ToLower(cfg.LogOverflow)),
+		FlushInterval: cfg.LogFlushEvery,
+		Lang:          logger.ParseLang(cfg.LogLang),
+		Redact:        cfg.Secrets(),
+		Clock:         clk,
+	})
+}
+
+func newLimiter(clk clock.Clock, onWait func(ratelimit.Domain, time.Duration)) *ratelimit.RateLimiter {
+	return ratelimit.New(ratelimit.Config{
+		IPCapacity:  500,
+		UIDCapacity: 500,
+		Window:      10 * time.Second,
+		OnWait:      onWait,
+		Clock:       clk,
+	})
+}
+
+// useCassette switches client to a recording or replaying transport when
+// http_record or http_replay is set. closeFn flushes a recording; done is
+// closed once a replay has served every interaction and is nil otherwise.
+func useCassette(cfg config.Config, client *weex.Client, log *logger.Logger) (closeFn func(), done <-chan struct{}, err error) {
+	switch {
+	case cfg.HTTPRecord != "":
+		rec, err := weex.NewRecorder(cfg.HTTPRecord, nil, cfg.Secrets()...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("http_record: %w", err)
+		}
+		client.SetTransport(rec)
+		log.Info(logger.EvCassette, logger.KMode, "record", logger.KPath, cfg.HTTPRecord)
+		return func() { _ = rec.Close() }, nil, nil
+	case cfg.HTTPReplay != "":
+		rp, err := weex.LoadCassette(cfg.HTTPReplay, cfg.ReplayLatency)
+		if err != nil {
+			return nil, nil, fmt.Errorf("http_replay: %w", err)
+		}
+		client.SetTransport(rp)
+		log.Info(logger.EvCassette, logger.KMode, "replay", logger.KPath, cfg.HTTPReplay, logger.KCount, strconv.Itoa(rp.Remaining()))
+		return func() {}, rp.Done(), nil
+	}
+	return func() {}, nil, nil
+}
+
+// oneShot is the shared setup of the inspection commands: config, logger
+// and a client, with a context cancelled on Ctrl-C.
+type oneShot struct {
+	cfg    config.Config
+	log    *logger.Logger
+	client *weex.Client
+	ctx    context.Context
+	stop   context.CancelFunc
+	done   func()
+}
+
+func newOneShot(fs *flag.FlagSet, args []string) (*oneShot, int) {
+	if err := fs.Parse(args); err != nil {
+		return nil, 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "%s: unexpected argument %q\n", fs.Name(), fs.Arg(0))
+		return nil, 2
+	}
+	cfg, ok := loadConfig("")
+	if !ok {
+		return nil, 2
+	}
+	o := &oneShot{cfg: cfg, log: newLogger(cfg, nil)}
+	o.client = weex.NewClient(cfg, o.log, newLimiter(nil, nil), nil)
+	closeFn, _, err := useCassette(cfg, o.client, o.log)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		o.log.Close()
+		return nil, 2
+	}
+	o.done = closeFn
+	o.ctx, o.stop = signalContext()
+	return o, 0
+}
+
+func (o *oneShot) close() {
+	o.stop()
+	o.done()
+	o.log.Close()
+}
+
+func (o *oneShot) requireCredentials() bool {
+	if o.cfg.APIKey == "" || o.cfg.APISecret == "" || o.cfg.Passphrase == "" {
+		fmt.Fprintln(os.Stderr, "api key, secret and passphrase are required for this command")
+		return false
+	}
+	return true
+}
+
+func fail(cmd string, err error) int {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", cmd, err)
+	return 1
+}
+
+func backtest(args []string) int {
+	fs := flag.NewFlagSet("backtest", flag.ContinueOnError)
+	data := fs.String("data", "", "CSV with columns time,symbol,last,bid,ask,mark,index,funding_rate")
+	offline := fs.Bool("offline", false, "do not fetch contract specs; use default size step and fees")
+	o, code := newOneShot(fs, args)
+	if o == nil {
+		return code
+	}
+	defer o.close()
+	if *data == "" {
+		fmt.Fprintln(os.Stderr, "backtest: -data is required")
+		return 2
+	}
+	f, err := os.Open(*data)
+	if err != nil {
+		return fail("backtest", err)
+	}
+	bars, err := strategy.ReadBars(f)
+	f.Close()
+	if err != nil {
+		return fail("backtest", fmt.Errorf("%s: %w", *data, err))
+	}
+	specs := make(map[string]weex.Contract)
+	if !*offline {
+		for _, s := range o.cfg.Symbols {
+			cs, err := o.client.GetContracts(o.ctx, s)
+			if err != nil || len(cs) == 0 {
+				fmt.Fprintf(os.Stderr, "backtest: no contract spec for %s, using defaults\n", s)
+				continue
+			}
+			specs[s] = cs[0]
+		}
+	}
+	var start time.Time
+	if len(bars) > 0 {
+		start = bars[0].Time
+	}
+	// a separate logger so backtest records carry simulated timestamps
+	clk := clock.NewManual(start)
+	blog := newLogger(o.cfg, clk)
+	res := strategy.Backtest(o.cfg, bars, specs, blog, clk)
+	blog.Close()
+	fmt.Printf("bars=%d from=%s to=%s\n", res.Bars, res.From.Format(time.RFC3339), res.To.Format(time.RFC3339))
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SYMBOL\tTRADES\tCLOSED\tOPEN\tREALIZED\tUNREALIZED")
+	var total float64
+	for _, s := range res.Symbols {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.6f\t%.6f\n", s.Symbol, s.Trades, s.Closed, s.Open, s.RealizedPnL, s.UnrealizedPnL)
+		total += s.RealizedPnL
+	}
+	tw.Flush()
+	fmt.Printf("realized_pnl=%.6f\n", total)
+	fmt.Println()
+	_ = res.Report.WriteText(os.Stdout)
+	return 0
+}
+
+func reportCmd(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	dir := fs.String("dir", "", "log directory or its pnl subdirectory (default: the configured log_dir)")
+	from := fs.String("from", "", "only trades closed at or after this time (RFC3339 or 2006-01-02)")
+	to := fs.String("to", "", "only trades closed at or before this time (RFC3339 or 2006-01-02)")
+	period := fs.Duration("period", 24*time.Hour, "return period for Sharpe and Sortino")
+	capital := fs.Float64("capital", 0, "starting capital in USDT; turns drawdown and returns into fractions")
+	jsonOut := fs.String("json", "", "also write the full report, equity curve included, as JSON to this file")
+	csvOut := fs.String("csv", "", "also write the per-group figures as CSV to this file")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "report: unexpected argument %q\n", fs.Arg(0))
+		return 2
+	}
+	if *dir == "" {
+		cfg, ok := loadConfig("")
+		if !ok {
+			return 2
+		}
+		*dir = cfg.LogDir
+	}
+	var lo, hi time.Time
+	var err error
+	if lo, err = parseWhen(*from, false); err != nil {
+		fmt.Fprintf(os.Stderr, "report: -from: %v\n", err)
+		return 2
+	}
+	if hi, err = parseWhen(*to, true); err != nil {
+		fmt.Fprintf(os.Stderr, "report: -to: %v\n", err)
+		return 2
+	}
+	if *period <= 0 {
+		fmt.Fprintln(os.Stderr, "report: -period must be positive")
+		return 2
+	}
+	trades, legacy, err := report.ReadLogs(*dir, lo, hi)
+	if err != nil {
+		return fail("report", err)
+	}
+	if legacy > 0 {
+		fmt.Fprintf(os.Stderr, "report: skipped %d position_closed records with per-unit PnL (logged before pnl_unit)\n", legacy)
+	}
+	r := report.New(trades, report.Options{Period: *period, Capital: *capital})
+	if err := r.WriteText(os.Stdout); err != nil {
+		return fail("report", err)
+	}
+	if *jsonOut != "" {
+		if err := writeFile(*jsonOut, r.WriteJSON); err != nil {
+			return fail("report", err)
+		}
+	}
+	if *csvOut != "" {
+		if err := writeFile(*csvOut, r.WriteCSV); err != nil {
+			return fail("report", err)
+		}
+	}
+	return 0
+}
+
+// parseWhen reads an RFC3339 time or a date; a date as an upper bound
+// means the end of that day.
+func parseWhen(s string, end bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return t, fmt.Errorf("want RFC3339 or 2006-01-02, got %q", s)
+	}
+	if end {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func status(args []string) int {
+	o, code := newOneShot(flag.NewFlagSet("status", flag.ContinueOnError), args)
+	if o == nil {
+		return code
+	}
+	defer o.close()
+	if !o.requireCredentials() {
+		return 2
+	}
+	avail, eq, err := o.client.GetCollateralUSDT(o.ctx)
+	if err != nil {
+		return fail("status", err)
+	}
+	fmt.Printf("equity_usdt=%.6f available_usdt=%.6f\n\n", eq, avail)
+
+	pos, err := o.client.GetPositions(o.ctx)
+	if err != nil {
+		return fail("status", err)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SYMBOL\tSIDE\tSIZE\tLEVERAGE")
+	for _, p := range pos {
+		fmt.Fprintf(tw, "%s\t%s\t%g\t%g\n", p.Symbol, p.Side, p.Size, p.Leverage)
+	}
+	tw.Flush()
+	fmt.Println()
+
+	settings, err := o.client.GetSymbolSettings(o.ctx)
+	if err != nil {
+		return fail("status", err)
+	}
+	fmt.Fprintln(tw, "SYMBOL\tMARGIN_MODE\tLONG_LEV\tSHORT_LEV\tCONFIG")
+	for _, s := range o.cfg.Symbols {
+		st, sp := settings[s], o.cfg.ForSymbol(s)
+		fmt.Fprintf(tw, "%s\t%s\t%g\t%g\t%s %g\n", s, st.MarginMode, st.LongLeverage, st.ShortLeverage, sp.MarginMode, sp.Leverage)
+	}
+	tw.Flush()
+	fmt.Println()
+
+	fmt.Fprintln(tw, "SYMBOL\tORDER_ID\tTYPE\tPRICE\tSIZE\tFILLED\tSTATUS\tCREATED")
+	for _, s := range o.cfg.Symbols {
+		orders, err := o.client.GetOpenOrders(o.ctx, s)
+		if err != nil {
+			return fail("status", err)
+		}
+		for _, od := range orders {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", od.Symbol, od.OrderID, od.Type, od.Price, od.Size, od.FilledQty, od.Status, od.CreateTime)
+		}
+	}
+	tw.Flush()
+	return 0
+}
+
+func flatten(args []string) int {
+	fs := flag.NewFlagSet("flatten", flag.ContinueOnError)
+	yes := fs.Bool("yes", false, "confirm: this places market orders on the live account")
+	o, code := newOneShot(fs, args)
+	if o == nil {
+		return code
+	}
+	defer o.close()
+	if !*yes {
+		fmt.Fprintln(os.Stderr, "flatten: refusing without -yes")
+		return 2
+	}
+	if !o.requireCredentials() {
+		return 2
+	}
+	if _, err := o.client.CancelAllOrders(o.ctx, ""); err != nil {
+		return fail("flatten", err)
+	}
+	// TP/SL and conditional orders are not in cancelAllOrders; left live
+	// they would fire on the flat account
+	n, err := o.client.CancelAllPlans(o.ctx, "")
+	o.log.Trade(logger.EvCancelAll, logger.KReason, "cli", logger.KPlanType, "all", logger.KCount, strconv.Itoa(n))
+	if err != nil {
+		return fail("flatten", err)
+	}
+	pos, err := o.client.GetPositions(o.ctx)
+	if err != nil {
+		return fail("flatten", err)
+	}
+	tr := trader.NewWeex(o.client, o.log, nil)
+	failed := 0
+	for _, p := range pos {
+		if p.Size <= 0 {
+			continue
+		}
+		side := trader.Sell
+		if strings.EqualFold(p.Side, "long") {
+			side = trader.Buy
+		}
+		od := tr.ClosePosition(p.Symbol, side, "market", 0, p.Size)
+		o.log.Trade(logger.EvFlatten, logger.KReason, "cli", logger.KSymbol, p.Symbol, logger.KSide, p.Side, logger.KSize, strconv.FormatFloat(p.Size, 'f', 6, 64))
+		if od.Status == "error" {
+			failed++
+		}
+		fmt.Printf("%s %s %g order=%s status=%s\n", p.Symbol, p.Side, p.Size, od.ID, od.Status)
+	}
+	if failed > 0 {
+		return fail("flatten", fmt.Errorf("%d close orders failed", failed))
+	}
+	return 0
+}
+
+func cancelAll(args []string) int {
+	fs := flag.NewFlagSet("cancel-all", flag.ContinueOnError)
+	yes := fs.Bool("yes", false, "confirm cancelling open orders on the live account")
+	symbol := fs.String("symbol", "", "only this symbol")
+	o, code := newOneShot(fs, args)
+	if o == nil {
+		return code
+	}
+	defer o.close()
+	if !*yes {
+		fmt.Fprintln(os.Stderr, "cancel-all: refusing without -yes")
+		return 2
+	}
+	if !o.requireCredentials() {
+		return 2
+	}
+	res, err := o.client.CancelAllOrders(o.ctx, *symbol)
+	if err != nil {
+		return fail("cancel-all", err)
+	}
+	failed := 0
+	for _, r := range res {
+		if !r.Success {
+			failed++
+		}
+	}
+	o.log.Trade(logger.EvCancelAll, logger.KMode, "cli", logger.KSymbol, *symbol, logger.KCount, strconv.Itoa(len(res)))
+	fmt.Printf("cancelled=%d failed=%d\n", len(res)-failed, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func contracts(args []string) int {
+	o, code := newOneShot(flag.NewFlagSet("contracts", flag.ContinueOnError), args)
+	if o == nil {
+		return code
+	}
+	defer o.close()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SYMBOL\tCONTRACT_ID\tTICK_SIZE\tSIZE_INCREMENT\tMAKER_FEE\tTAKER_FEE")
+	for _, s := range o.cfg.Symbols {
+		cs, err := o.client.GetContracts(o.ctx, s)
+		if err != nil {
+			tw.Flush()
+			return fail("contracts", err)
+		}
+		for _, c := range cs {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\n", c.Symbol, c.ContractID, c.TickSize, c.SizeIncrement, c.MakerFeeRate, c.TakerFeeRate)
+		}
+	}
+	tw.Flush()
+	return 0
+}
+
+func ping(args []string) int {
+	o, code := newOneShot(flag.NewFlagSet("ping", flag.ContinueOnError), args)
+	if o == nil {
+		return code
+	}
+	defer o.close()
+	start := time.Now()
+	if err := o.client.SyncServerTime(o.ctx); err != nil {
+		return fail("ping", err)
+	}
+	fmt.Printf("public ok rtt=%s drift_ms=%d\n", time.Since(start).Round(time.Millisecond), o.client.Drift())
+	if o.cfg.APIKey == "" {
+		fmt.Println("private skipped (no credentials)")
+		return 0
+	}
+	start = time.Now()
+	if err := o.client.PingPrivate(o.ctx); err != nil {
+		return fail("ping", err)
+	}
+	fmt.Printf("private ok rtt=%s\n", time.Since(start).Round(time.Millisecond))
+	return 0
+}
+
+func configCheck(args []string) int {
+	if len(args) > 1 {
+		return usage()
+	}
+	path := ""
+	if len(args) == 1 {
+		path = args[0]
+	}
+	cfg, ok := loadConfig(path)
+	if !ok {
+		return 2
+	}
+	cfg.Dump(os.Stdout)
+	fmt.Println("config ok")
+	return 0
+}
+
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
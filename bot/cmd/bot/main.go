@@ -2,10 +2,20 @@ package main
 
 import (
     "context"
+    "fmt"
+    "net/http"
+    "os"
+    "os/signal"
     "strings"
+    "syscall"
     "time"
+    "github.com/weex/ai_trading/bot/internal/admin"
+    "github.com/weex/ai_trading/bot/internal/clock"
     "github.com/weex/ai_trading/bot/internal/config"
+    "github.com/weex/ai_trading/bot/internal/execution"
+    "github.com/weex/ai_trading/bot/internal/health"
     "github.com/weex/ai_trading/bot/internal/logger"
+    "github.com/weex/ai_trading/bot/internal/metrics"
     "github.com/weex/ai_trading/bot/internal/ratelimit"
     "github.com/weex/ai_trading/bot/internal/strategy"
     "github.com/weex/ai_trading/bot/internal/trader"
@@ -13,39 +23,184 @@ import (
 )
 
 func main() {
-    cfg := config.Load()
+    cmd, args := "run", os.Args[1:]
+    if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+        cmd, args = args[0], args[1:]
+    }
+    os.Exit(dispatch(cmd, args))
+}
+
+// run is the trading loop: the default when no subcommand is given.
+func run(args []string) int {
+    if len(args) > 0 {
+        return usage()
+    }
+    cfg, ok := loadConfig("")
+    if !ok {
+        return 2
+    }
 
-    log := logger.New(cfg.LogDir)
+    // clock_speed > 1 runs cooldowns, holds, the poll loop and rate
+    // windows faster than real time for simulations
+    clk := clock.Real()
+    if cfg.ClockSpeed != 1 {
+        clk = clock.Accelerated(time.Now(), cfg.ClockSpeed)
+    }
+    log := newLogger(cfg, clk)
     defer log.Close()
 
-    rl := ratelimit.New(ratelimit.Config{
-        IPCapacity: 500,
-        UIDCapacity: 500,
-        Window: 10 * time.Second,
+    m := metrics.New()
+    rl := newLimiter(clk, func(d ratelimit.Domain, waited time.Duration) {
+        m.RateLimitWait.Observe(waited.Seconds(), d.String())
+    })
+    rateUsage := func() map[string]float64 {
+        out := make(map[string]float64, 2)
+        for _, d := range []ratelimit.Domain{ratelimit.IP, ratelimit.UID} {
+            used, capacity := rl.Usage(d)
+            if capacity > 0 {
+                out[d.String()] = float64(used) / float64(capacity)
+            }
+        }
+        return out
+    }
+    m.GaugeFunc("ratelimit_utilization_ratio", "Share of the rate-limit window weight in use.", []string{"domain"}, func() []metrics.Sample {
+        var out []metrics.Sample
+        for d, u := range rateUsage() {
+            out = append(out, metrics.Sample{Labels: []string{d}, Value: u})
+        }
+        return out
     })
 
-    client := weex.NewClient(cfg, log, rl)
+    client := weex.NewClient(cfg, log, rl, m)
+    closeCassette, replayDone, err := useCassette(cfg, client, log)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        return 2
+    }
+    defer closeCassette()
+    m.GaugeFunc("weex_clock_drift_ms", "Smoothed server-minus-local clock offset.", nil, func() []metrics.Sample {
+        return []metrics.Sample{{Value: float64(client.Drift())}}
+    })
+    m.GaugeFunc("weex_time_sync_rtt_ms", "Round trip of the last server time sync.", nil, func() []metrics.Sample {
+        return []metrics.Sample{{Value: float64(client.RTT())}}
+    })
+    hm := health.New(health.Config{
+        Symbols: cfg.Symbols,
+        StaleAfter: cfg.StaleAfter,
+        MaxDriftMs: int64(cfg.MaxDriftMs),
+        MaxRateUsage: cfg.MaxRateUsage,
+        RequirePrivate: strings.ToLower(cfg.TraderMode) == "real",
+        Drift: client.Drift,
+        Private: client.PrivateStatus,
+        RateUsage: rateUsage,
+    })
 
-    ctx := context.Background()
+    ctx, stop := signalContext()
+    defer stop()
+    if replayDone != nil {
+        // a replayed session ends when the cassette runs out
+        go func() {
+            select {
+            case <-replayDone:
+                log.Info(logger.EvCassette, logger.KMode, "replay", logger.KMsg, "cassette exhausted")
+                stop()
+            case <-ctx.Done():
+            }
+        }()
+    }
+
+    var srv *http.Server
+    if cfg.HTTPAddr != "" {
+        mux := http.NewServeMux()
+        mux.Handle("/metrics", m.Handler())
+        mux.Handle("/healthz", hm.Healthz())
+        mux.Handle("/readyz", hm.Readyz())
+        srv = &http.Server{Addr: cfg.HTTPAddr, Handler: mux}
+        go func() {
+            if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+                log.Error(logger.EvHTTPServer, logger.KErr, err.Error())
+            }
+        }()
+        log.Info(logger.EvHTTPServer, logger.KAddr, cfg.HTTPAddr)
+    }
 
     if err := client.SyncServerTime(ctx); err != nil {
-        log.Error("sync_time", "err", err.Error())
+        log.Error(logger.EvSyncTime, logger.KErr, err.Error())
     }
+    go client.RunTimeSync(ctx, cfg.TimeSync)
 
     if err := client.PingPrivate(ctx); err != nil {
-        log.Error("account_ping", "err", err.Error())
+        log.Error(logger.EvAccountPing, logger.KErr, err.Error())
     } else {
-        log.Info("account_ping", "msg", "private API reachable")
+        log.Info(logger.EvAccountPing, logger.KMsg, "private API reachable")
     }
 
     var tr trader.Trader
     if strings.ToLower(cfg.TraderMode) == "real" {
-        tr = trader.NewWeex(client, log)
-        log.Info("trader_mode", "mode", "real")
+        wt := trader.NewWeex(client, log, clk)
+        wt.SetExecution(execution.Params{Poll: cfg.ExecReprice, Timeout: cfg.ExecTimeout, Show: cfg.IcebergShow, Duration: cfg.TWAPDuration, Slices: cfg.TWAPSlices})
+        tr = wt
+        log.Info(logger.EvTraderMode, logger.KMode, "real")
     } else {
-        tr = trader.NewMock(log)
-        log.Info("trader_mode", "mode", "mock")
+        tr = trader.NewMock(log, clk)
+        log.Info(logger.EvTraderMode, logger.KMode, "mock")
     }
-    eng := strategy.NewEngine(cfg, client, tr, log)
+    eng := strategy.NewEngine(cfg, client, tr, log, m, hm, clk)
+
+    var adminSrv *http.Server
+    if cfg.AdminAddr != "" {
+        ln, err := admin.Listen(cfg.AdminAddr)
+        if err != nil {
+            log.Error(logger.EvAdmin, logger.KAddr, cfg.AdminAddr, logger.KErr, err.Error())
+        } else {
+            adminSrv = &http.Server{Handler: admin.New(eng, client, log, cfg.AdminToken.Reveal()).Handler()}
+            go func() { _ = adminSrv.Serve(ln) }()
+            log.Info(logger.EvAdmin, logger.KAddr, cfg.AdminAddr)
+        }
+    }
+
+    // hot reload: SIGHUP or a change to the WEEX_CONFIG file re-reads the
+    // config; an invalid result is logged and the running config kept
+    cfgPath := os.Getenv("WEEX_CONFIG")
+    reload := func() {
+        next, err := config.LoadFile(cfgPath)
+        if err != nil {
+            log.Error(logger.EvConfigReload, logger.KErr, err.Error())
+            return
+        }
+        if _, err := eng.Reload(ctx, next); err != nil {
+            log.Error(logger.EvConfigReload, logger.KErr, err.Error())
+        }
+    }
+    hup := make(chan os.Signal, 1)
+    signal.Notify(hup, syscall.SIGHUP)
+    go func() {
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case <-hup:
+                reload()
+            }
+        }
+    }()
+    if cfgPath != "" && cfg.WatchInterval > 0 {
+        go config.Watch(ctx, cfgPath, cfg.WatchInterval, reload)
+    }
+
     eng.Run(ctx)
+    signal.Stop(hup)
+
+    // restore default signal handling so a second Ctrl-C exits immediately
+    stop()
+    sctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+    defer cancel()
+    sum := eng.Shutdown(sctx)
+    for _, s := range []*http.Server{adminSrv, srv} {
+        if s != nil {
+            _ = s.Shutdown(sctx)
+        }
+    }
+    fmt.Printf("shutdown: action=%s open_positions=%d closed=%d realized_pnl=%.6f elapsed=%s\n", sum.Action, sum.OpenPositions, sum.Closed, sum.RealizedPnL, sum.Elapsed)
+    return 0
 }
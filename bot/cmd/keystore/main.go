@@ -0,0 +1,55 @@
+// Command keystore creates or checks an encrypted credentials file for the
+// bot. Credentials are taken from WEEX_API_KEY, WEEX_API_SECRET and
+// WEEX_API_PASSPHRASE, the passphrase from WEEX_KEYSTORE_PASSPHRASE:
+//
+//	keystore -out weex.keystore
+//	keystore -check weex.keystore
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/weex/ai_trading/bot/internal/keystore"
+)
+
+func main() {
+	out := flag.String("out", "", "write a new keystore to this path")
+	check := flag.String("check", "", "decrypt this keystore and report which fields are set")
+	flag.Parse()
+
+	pass := os.Getenv("WEEX_KEYSTORE_PASSPHRASE")
+	if pass == "" {
+		fail("WEEX_KEYSTORE_PASSPHRASE is not set")
+	}
+	switch {
+	case *out != "":
+		creds := keystore.Credentials{
+			APIKey:     os.Getenv("WEEX_API_KEY"),
+			APISecret:  os.Getenv("WEEX_API_SECRET"),
+			Passphrase: os.Getenv("WEEX_API_PASSPHRASE"),
+		}
+		if creds.APIKey == "" || creds.APISecret == "" || creds.Passphrase == "" {
+			fail("WEEX_API_KEY, WEEX_API_SECRET and WEEX_API_PASSPHRASE must all be set")
+		}
+		if err := keystore.WriteFile(*out, creds, pass); err != nil {
+			fail(err.Error())
+		}
+		fmt.Println("wrote", *out)
+	case *check != "":
+		creds, err := keystore.ReadFile(*check, pass)
+		if err != nil {
+			fail(err.Error())
+		}
+		fmt.Printf("api_key=%t api_secret=%t api_passphrase=%t\n", creds.APIKey != "", creds.APISecret != "", creds.Passphrase != "")
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func fail(msg string) {
+	fmt.Fprintln(os.Stderr, "keystore:", msg)
+	os.Exit(1)
+}
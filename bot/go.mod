@@ -2,3 +2,9 @@ module github.com/weex/ai_trading/bot
 
 go 1.21
 
+require (
+	github.com/BurntSushi/toml v1.6.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/crypto v0.21.0
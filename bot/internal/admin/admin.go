@@ -0,0 +1,220 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/weex/ai_trading/bot/internal/logger"
+	"github.com/weex/ai_trading/bot/internal/report"
+	"github.com/weex/ai_trading/bot/internal/strategy"
+	"github.com/weex/ai_trading/bot/internal/weex"
+)
+
+// Server is the local operator API. Routes:
+//
+//	GET  /admin/state              engine params, pause flags, per-symbol state
+//	GET  /admin/positions          positions as reported by the exchange
+//	GET  /admin/report             performance since start [period=24h, capital=0]
+//	POST /admin/pause?symbol=      pause entries globally or for one symbol
+//	POST /admin/resume?symbol=     resume entries
+//	POST /admin/flatten            cancel orders and close all positions
+//	POST /admin/cancel-all         cancel all resting orders
+//	POST /admin/params             JSON patch of live thresholds
+//
+// When a token is configured every request must carry it as
+// "Authorization: Bearer <token>".
+type Server struct {
+	eng    *strategy.Engine
+	client *weex.Client
+	log    *logger.Logger
+	token  string
+}
+
+func New(eng *strategy.Engine, client *weex.Client, log *logger.Logger, token string) *Server {
+	return &Server{eng: eng, client: client, log: log, token: token}
+}
+
+// Listen opens addr; "unix:/path/to.sock" listens on a Unix socket.
+func Listen(addr string) (net.Listener, error) {
+	if p, ok := strings.CutPrefix(addr, "unix:"); ok {
+		_ = os.Remove(p)
+		ln, err := net.Listen("unix", p)
+		if err != nil {
+			return nil, err
+		}
+		_ = os.Chmod(p, 0o600)
+		return ln, nil
+	}
+	return net.Listen("tcp", addr)
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/state", s.only("GET", s.state))
+	mux.HandleFunc("/admin/positions", s.only("GET", s.positions))
+	mux.HandleFunc("/admin/report", s.only("GET", s.report))
+	mux.HandleFunc("/admin/pause", s.only("POST", s.pause))
+	mux.HandleFunc("/admin/resume", s.only("POST", s.resume))
+	mux.HandleFunc("/admin/flatten", s.only("POST", s.flatten))
+	mux.HandleFunc("/admin/cancel-all", s.only("POST", s.cancelAll))
+	mux.HandleFunc("/admin/params", s.only("POST", s.params))
+	return mux
+}
+
+func (s *Server) only(method string, h func(http.ResponseWriter, *http.Request) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		action := strings.TrimPrefix(r.URL.Path, "/admin/")
+		if !s.authorized(r) {
+			s.log.Error(logger.EvAdmin, logger.KAction, action, logger.KRemote, r.RemoteAddr, logger.KErr, "unauthorized")
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		if r.Method != method {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use " + method})
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		defer cancel()
+		out, err := h(w, r.WithContext(ctx))
+		sym := r.URL.Query().Get("symbol")
+		if err != nil {
+			s.log.Error(logger.EvAdmin, logger.KAction, action, logger.KSymbol, sym, logger.KRemote, r.RemoteAddr, logger.KErr, err.Error())
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if method != "GET" {
+			s.log.Info(logger.EvAdmin, logger.KAction, action, logger.KSymbol, sym, logger.KRemote, r.RemoteAddr)
+		}
+		writeJSON(w, http.StatusOK, out)
+	}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) == 1
+}
+
+func (s *Server) state(_ http.ResponseWriter, r *http.Request) (any, error) {
+	return s.eng.Snapshot(r.Context())
+}
+
+func (s *Server) positions(_ http.ResponseWriter, r *http.Request) (any, error) {
+	return s.client.GetPositions(r.Context())
+}
+
+func (s *Server) report(_ http.ResponseWriter, r *http.Request) (any, error) {
+	var opt report.Options
+	q := r.URL.Query()
+	if v := q.Get("period"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+		opt.Period = d
+	}
+	if v := q.Get("capital"); v != "" {
+		c, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, err
+		}
+		opt.Capital = c
+	}
+	return s.eng.Report(r.Context(), opt)
+}
+
+func (s *Server) pause(_ http.ResponseWriter, r *http.Request) (any, error) {
+	return map[string]bool{"ok": true}, s.eng.Pause(r.Context(), r.URL.Query().Get("symbol"))
+}
+
+func (s *Server) resume(_ http.ResponseWriter, r *http.Request) (any, error) {
+	return map[string]bool{"ok": true}, s.eng.Resume(r.Context(), r.URL.Query().Get("symbol"))
+}
+
+func (s *Server) flatten(_ http.ResponseWriter, r *http.Request) (any, error) {
+	return map[string]bool{"ok": true}, s.eng.Flatten(r.Context(), "admin")
+}
+
+func (s *Server) cancelAll(_ http.ResponseWriter, r *http.Request) (any, error) {
+	return map[string]bool{"ok": true}, s.eng.CancelAll(r.Context())
+}
+
+// paramsPatch mirrors strategy.ParamsView; absent fields are left unchanged.
+type paramsPatch struct {
+	ZThreshold     *float64 `json:"z_threshold"`
+	FundingAbsMax  *float64 `json:"funding_abs_max"`
+	SpreadMaxRatio *float64 `json:"spread_max_ratio"`
+	MaxNotionalUSD *float64 `json:"max_notional_usd"`
+	Cooldown       *string  `json:"cooldown"`
+	HoldDuration   *string  `json:"hold_duration"`
+}
+
+func (s *Server) params(_ http.ResponseWriter, r *http.Request) (any, error) {
+	var p paramsPatch
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return nil, err
+	}
+	var cd, hd time.Duration
+	var err error
+	if p.Cooldown != nil {
+		if cd, err = time.ParseDuration(*p.Cooldown); err != nil {
+			return nil, err
+		}
+	}
+	if p.HoldDuration != nil {
+		if hd, err = time.ParseDuration(*p.HoldDuration); err != nil {
+			return nil, err
+		}
+	}
+	before, after, err := s.eng.UpdateParams(r.Context(), func(cur *strategy.Params) {
+		if p.ZThreshold != nil {
+			cur.ZThreshold = *p.ZThreshold
+		}
+		if p.FundingAbsMax != nil {
+			cur.FundingAbsMax = *p.FundingAbsMax
+		}
+		if p.SpreadMaxRatio != nil {
+			cur.SpreadMaxRatio = *p.SpreadMaxRatio
+		}
+		if p.MaxNotionalUSD != nil {
+			cur.MaxNotionalUSD = *p.MaxNotionalUSD
+		}
+		if p.Cooldown != nil {
+			cur.Cooldown = cd
+		}
+		if p.HoldDuration != nil {
+			cur.HoldDuration = hd
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	b, a := before.View(), after.View()
+	s.log.Info(logger.EvAdmin, logger.KAction, "params", logger.KBefore, compact(b), logger.KAfter, compact(a))
+	return map[string]strategy.ParamsView{"before": b, "after": a}, nil
+}
+
+func compact(v strategy.ParamsView) string {
+	return "z=" + strconv.FormatFloat(v.ZThreshold, 'f', -1, 64) +
+		",fund=" + strconv.FormatFloat(v.FundingAbsMax, 'f', -1, 64) +
+		",spread=" + strconv.FormatFloat(v.SpreadMaxRatio, 'f', -1, 64) +
+		",notional=" + strconv.FormatFloat(v.MaxNotionalUSD, 'f', -1, 64) +
+		",cooldown=" + v.Cooldown + ",hold=" + v.HoldDuration
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,123 @@
+// Package book computes execution estimates from an order book snapshot:
+// VWAP fill price and slippage for a size, liquidity near the mid and
+// bid/ask imbalance.
+package book
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+type Level struct {
+	Price float64
+	Size  float64
+}
+
+// Book holds asks ascending and bids descending by price.
+type Book struct {
+	Asks []Level
+	Bids []Level
+}
+
+// Parse builds a Book from [price, size, ...] string levels as returned by
+// the depth endpoint. Unparsable or non-positive levels are dropped.
+func Parse(asks, bids [][]string) Book {
+	b := Book{Asks: levels(asks), Bids: levels(bids)}
+	sort.Slice(b.Asks, func(i, j int) bool { return b.Asks[i].Price < b.Asks[j].Price })
+	sort.Slice(b.Bids, func(i, j int) bool { return b.Bids[i].Price > b.Bids[j].Price })
+	return b
+}
+
+func levels(raw [][]string) []Level {
+	out := make([]Level, 0, len(raw))
+	for _, r := range raw {
+		if len(r) < 2 {
+			continue
+		}
+		p, err1 := strconv.ParseFloat(r[0], 64)
+		s, err2 := strconv.ParseFloat(r[1], 64)
+		if err1 != nil || err2 != nil || p <= 0 || s <= 0 {
+			continue
+		}
+		out = append(out, Level{Price: p, Size: s})
+	}
+	return out
+}
+
+// Mid is the midpoint of the best bid and ask, or 0 if either side is empty.
+func (b Book) Mid() float64 {
+	if len(b.Asks) == 0 || len(b.Bids) == 0 {
+		return 0
+	}
+	return (b.Asks[0].Price + b.Bids[0].Price) / 2
+}
+
+// side returns the levels a taker consumes: asks to buy, bids to sell.
+func (b Book) side(buy bool) []Level {
+	if buy {
+		return b.Asks
+	}
+	return b.Bids
+}
+
+// VWAP walks the book for a buy (asks) or sell (bids) of size and returns
+// the average fill price and how much of size the visible book covers.
+func (b Book) VWAP(buy bool, size float64) (price, filled float64) {
+	var notional float64
+	for _, l := range b.side(buy) {
+		if filled >= size {
+			break
+		}
+		q := math.Min(l.Size, size-filled)
+		notional += q * l.Price
+		filled += q
+	}
+	if filled == 0 {
+		return 0, 0
+	}
+	return notional / filled, filled
+}
+
+// SlippageBps is the adverse distance of the VWAP for size from the mid, in
+// basis points; it includes half the spread. ok is false when the visible
+// book cannot fill size.
+func (b Book) SlippageBps(buy bool, size float64) (bps float64, ok bool) {
+	mid := b.Mid()
+	vwap, filled := b.VWAP(buy, size)
+	if mid == 0 || filled < size {
+		return 0, false
+	}
+	if buy {
+		return (vwap - mid) / mid * 1e4, true
+	}
+	return (mid - vwap) / mid * 1e4, true
+}
+
+// Liquidity is the size resting on the ask (buy) or bid (sell) side within
+// bps of the mid.
+func (b Book) Liquidity(buy bool, bps float64) float64 {
+	mid := b.Mid()
+	if mid == 0 {
+		return 0
+	}
+	limit := mid * bps / 1e4
+	var sum float64
+	for _, l := range b.side(buy) {
+		if math.Abs(l.Price-mid) > limit {
+			break
+		}
+		sum += l.Size
+	}
+	return sum
+}
+
+// Imbalance is (bid - ask) / (bid + ask) of the liquidity within bps of the
+// mid: +1 means only bids, -1 only asks, 0 balanced or empty.
+func (b Book) Imbalance(bps float64) float64 {
+	bid, ask := b.Liquidity(false, bps), b.Liquidity(true, bps)
+	if bid+ask == 0 {
+		return 0
+	}
+	return (bid - ask) / (bid + ask)
+}
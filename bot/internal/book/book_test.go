@@ -0,0 +1,93 @@
+package book
+
+import (
+	"math"
+	"testing"
+)
+
+// testBook has a mid of 100 with three asks and three bids, given out of
+// order and with one unusable level.
+func testBook() Book {
+	return Parse(
+		[][]string{{"100.5", "5"}, {"100.1", "1"}, {"100.2", "2"}, {"x", "1"}},
+		[][]string{{"99.8", "2"}, {"99.9", "3"}, {"99.5", "5"}, {"99.7", "0"}},
+	)
+}
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+func TestVWAP(t *testing.T) {
+	tests := []struct {
+		name       string
+		buy        bool
+		size       float64
+		wantPrice  float64
+		wantFilled float64
+	}{
+		{"buy inside the top level", true, 0.5, 100.1, 0.5},
+		{"buy across two levels", true, 2, 100.15, 2},
+		{"buy beyond the book", true, 10, (100.1 + 2*100.2 + 5*100.5) / 8, 8},
+		{"sell across two levels", false, 4, (3*99.9 + 99.8) / 4, 4},
+		{"sell beyond the book", false, 20, (3*99.9 + 2*99.8 + 5*99.5) / 10, 10},
+	}
+	b := testBook()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			px, filled := b.VWAP(tt.buy, tt.size)
+			if !near(px, tt.wantPrice) || !near(filled, tt.wantFilled) {
+				t.Fatalf("VWAP = %v for %v, want %v for %v", px, filled, tt.wantPrice, tt.wantFilled)
+			}
+		})
+	}
+}
+
+func TestSlippageBps(t *testing.T) {
+	tests := []struct {
+		name   string
+		buy    bool
+		size   float64
+		want   float64
+		wantOK bool
+	}{
+		{"buy pays above the mid", true, 2, 15, true},
+		{"sell receives below the mid", false, 4, 12.5, true},
+		{"buy beyond the book", true, 10, 0, false},
+		{"sell beyond the book", false, 20, 0, false},
+	}
+	b := testBook()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bps, ok := b.SlippageBps(tt.buy, tt.size)
+			if ok != tt.wantOK || !near(bps, tt.want) {
+				t.Fatalf("SlippageBps = %v, %v; want %v, %v", bps, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+	if _, ok := (Book{Asks: testBook().Asks}).SlippageBps(true, 1); ok {
+		t.Fatal("slippage without a mid")
+	}
+}
+
+func TestLiquidityAndImbalance(t *testing.T) {
+	tests := []struct {
+		bps           float64
+		wantAsk       float64
+		wantBid       float64
+		wantImbalance float64
+	}{
+		{5, 0, 0, 0},
+		{10, 1, 3, 0.5},
+		{25, 3, 5, 0.25},
+		{100, 8, 10, 2.0 / 18},
+	}
+	b := testBook()
+	for _, tt := range tests {
+		ask, bid, imb := b.Liquidity(true, tt.bps), b.Liquidity(false, tt.bps), b.Imbalance(tt.bps)
+		if !near(ask, tt.wantAsk) || !near(bid, tt.wantBid) || !near(imb, tt.wantImbalance) {
+			t.Errorf("%v bps: ask %v bid %v imbalance %v, want %v %v %v", tt.bps, ask, bid, imb, tt.wantAsk, tt.wantBid, tt.wantImbalance)
+		}
+	}
+	if got := (Book{}).Imbalance(100); got != 0 {
+		t.Fatalf("empty book imbalance = %v, want 0", got)
+	}
+}
@@ -0,0 +1,117 @@
+// Package clock abstracts time so cooldowns, holds, fill delays and rate
+// windows can be driven by a manual clock in tests or run faster than real
+// time in simulations.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	Sleep(d time.Duration)
+	// After returns a channel that receives the time once d has elapsed.
+	// The timer is armed at the call, not when the channel is read.
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+type Ticker interface {
+	C() <-chan time.Time
+	Reset(d time.Duration)
+	Stop()
+}
+
+// Real is the wall clock.
+func Real() Clock { return realClock{} }
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+type realTicker struct{ t *time.Ticker }
+
+func (r realTicker) C() <-chan time.Time   { return r.t.C }
+func (r realTicker) Reset(d time.Duration) { r.t.Reset(d) }
+func (r realTicker) Stop()                 { r.t.Stop() }
+
+// Or returns c, or the wall clock when c is nil.
+func Or(c Clock) Clock {
+	if c == nil {
+		return Real()
+	}
+	return c
+}
+
+// Accelerated runs factor times faster than the wall clock, starting from
+// start: one real second is factor simulated seconds.
+func Accelerated(start time.Time, factor float64) Clock {
+	if factor <= 0 {
+		factor = 1
+	}
+	return &accel{start: start, origin: time.Now(), factor: factor}
+}
+
+type accel struct {
+	start  time.Time
+	origin time.Time
+	factor float64
+}
+
+func (a *accel) real(d time.Duration) time.Duration { return time.Duration(float64(d) / a.factor) }
+
+func (a *accel) Now() time.Time {
+	return a.start.Add(time.Duration(float64(time.Since(a.origin)) * a.factor))
+}
+
+func (a *accel) Since(t time.Time) time.Duration { return a.Now().Sub(t) }
+func (a *accel) Sleep(d time.Duration)           { time.Sleep(a.real(d)) }
+
+func (a *accel) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	time.AfterFunc(a.real(d), func() { ch <- a.Now() })
+	return ch
+}
+
+func (a *accel) NewTicker(d time.Duration) Ticker {
+	t := &accelTicker{a: a, c: make(chan time.Time, 1), rt: time.NewTicker(a.real(d)), stop: make(chan struct{})}
+	go t.run()
+	return t
+}
+
+type accelTicker struct {
+	a    *accel
+	c    chan time.Time
+	rt   *time.Ticker
+	stop chan struct{}
+	once sync.Once
+}
+
+func (t *accelTicker) run() {
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-t.rt.C:
+			select {
+			case t.c <- t.a.Now():
+			default:
+			}
+		}
+	}
+}
+
+func (t *accelTicker) C() <-chan time.Time   { return t.c }
+func (t *accelTicker) Reset(d time.Duration) { t.rt.Reset(t.a.real(d)) }
+func (t *accelTicker) Stop() {
+	t.once.Do(func() {
+		t.rt.Stop()
+		close(t.stop)
+	})
+}
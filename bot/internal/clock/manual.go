@@ -0,0 +1,152 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Manual only moves when told to. Timers, tickers and sleepers fire, in
+// deadline order, as Advance or Set pass their deadline.
+type Manual struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*waiter
+	changed chan struct{}
+}
+
+type waiter struct {
+	at     time.Time
+	period time.Duration // > 0 for tickers
+	ch     chan time.Time
+	dead   bool
+}
+
+func NewManual(start time.Time) *Manual {
+	return &Manual{now: start, changed: make(chan struct{})}
+}
+
+func (m *Manual) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.now
+}
+
+func (m *Manual) Since(t time.Time) time.Duration { return m.Now().Sub(t) }
+
+func (m *Manual) Sleep(d time.Duration) { <-m.After(d) }
+
+func (m *Manual) After(d time.Duration) <-chan time.Time {
+	return m.add(d, 0).ch
+}
+
+func (m *Manual) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	return &manualTicker{m: m, w: m.add(d, d)}
+}
+
+func (m *Manual) add(d, period time.Duration) *waiter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w := &waiter{at: m.now.Add(d), period: period, ch: make(chan time.Time, 1)}
+	m.waiters = append(m.waiters, w)
+	m.fireLocked()
+	m.notifyLocked()
+	return w
+}
+
+// Advance moves the clock forward by d.
+func (m *Manual) Advance(d time.Duration) { m.Set(m.Now().Add(d)) }
+
+// Set moves the clock to t; earlier times are ignored.
+func (m *Manual) Set(t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t.After(m.now) {
+		m.now = t
+	}
+	m.fireLocked()
+}
+
+// fireLocked delivers every due waiter. A ticker that fell several periods
+// behind delivers once, like time.Ticker dropping ticks for a slow reader.
+func (m *Manual) fireLocked() {
+	kept := m.waiters[:0]
+	for _, w := range m.waiters {
+		if !w.at.After(m.now) {
+			select {
+			case w.ch <- m.now:
+			default:
+			}
+			if w.period == 0 {
+				continue
+			}
+			for !w.at.After(m.now) {
+				w.at = w.at.Add(w.period)
+			}
+		}
+		kept = append(kept, w)
+	}
+	m.waiters = kept
+}
+
+func (m *Manual) notifyLocked() {
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+// Waiters reports how many timers, tickers and sleepers are pending.
+func (m *Manual) Waiters() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.waiters)
+}
+
+// BlockUntil waits until at least n timers, tickers or sleepers are
+// pending, so a test can advance only after a goroutine has gone to sleep.
+func (m *Manual) BlockUntil(n int) {
+	for {
+		m.mu.Lock()
+		if len(m.waiters) >= n {
+			m.mu.Unlock()
+			return
+		}
+		ch := m.changed
+		m.mu.Unlock()
+		<-ch
+	}
+}
+
+type manualTicker struct {
+	m *Manual
+	w *waiter
+}
+
+func (t *manualTicker) C() <-chan time.Time { return t.w.ch }
+
+func (t *manualTicker) Reset(d time.Duration) {
+	t.m.mu.Lock()
+	defer t.m.mu.Unlock()
+	t.w.period = d
+	t.w.at = t.m.now.Add(d)
+	if t.w.dead {
+		t.w.dead = false
+		t.m.waiters = append(t.m.waiters, t.w)
+	}
+}
+
+func (t *manualTicker) Stop() {
+	t.m.mu.Lock()
+	defer t.m.mu.Unlock()
+	if t.w.dead {
+		return
+	}
+	t.w.dead = true
+	for i, w := range t.m.waiters {
+		if w == t.w {
+			t.m.waiters = append(t.m.waiters[:i], t.m.waiters[i+1:]...)
+			break
+		}
+	}
+}
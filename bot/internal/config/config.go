@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
@@ -8,126 +9,471 @@ import (
 )
 
 type Config struct {
-	BaseURL         string
-	APIKey          string
-	APISecret       string
-	Passphrase      string
-	Symbols         []string
-	QueryInterval   time.Duration
-	LogDir          string
-	ZThreshold      float64
-	FundingAbsMax   float64
-	SpreadMaxRatio  float64
-	Cooldown        time.Duration
-	HoldDuration    time.Duration
-	TraderMode      string
-	MetricsInterval time.Duration
-	MinSizeMap      map[string]float64
-	MaxNotionalUSD  float64
-	FlattenOnStart  bool
-}
-
-func Load() Config {
-	baseURL := getenv("WEEX_BASE_URL", "https://api-contract.weex.com")
-	apiKey := getenv("WEEX_API_KEY", "")
-	apiSecret := getenv("WEEX_API_SECRET", "")
-	pass := getenv("WEEX_API_PASSPHRASE", "")
-	syms := []string{
-		"cmt_btcusdt", "cmt_ethusdt", "cmt_solusdt", "cmt_bnbusdt",
-		"cmt_xrpusdt", "cmt_adausdt", "cmt_ltcusdt", "cmt_linkusdt",
+	BaseURL             string
+	APIKey              Secret
+	APISecret           Secret
+	Passphrase          Secret
+	Keystore            string
+	Symbols             []string
+	QueryInterval       time.Duration
+	LogDir              string
+	ZThreshold          float64
+	FundingAbsMax       float64
+	SpreadMaxRatio      float64
+	BaseSize            float64
+	Cooldown            time.Duration
+	HoldDuration        time.Duration
+	TraderMode          string
+	MetricsInterval     time.Duration
+	MinSizeMap          map[string]float64
+	MaxNotionalUSD      float64
+	BasisEstimator      string
+	BasisHalfLife       time.Duration
+	BasisOutlierZ       float64
+	BasisWindow         time.Duration
+	BasisStep           time.Duration
+	BasisMaxGap         time.Duration
+	SizingMethod        string
+	RiskPerTrade        float64
+	EquityFraction      float64
+	VolHalfLife         time.Duration
+	SizingEquity        float64
+	Leverage            float64
+	MarginMode          string
+	AccountSetup        string
+	ExecAlgo            string
+	ExecUrgentZ         float64
+	ExecUrgentAlgo      string
+	ExecReprice         time.Duration
+	ExecTimeout         time.Duration
+	IcebergShow         float64
+	TWAPDuration        time.Duration
+	TWAPSlices          int
+	FlattenOnStart      bool
+	LogBufferSize       int
+	LogOverflow         string
+	LogFlushEvery       time.Duration
+	LogLang             string
+	ShutdownAction      string
+	ShutdownTimeout     time.Duration
+	HTTPAddr            string
+	StaleAfter          time.Duration
+	MaxDriftMs          int
+	MaxRateUsage        float64
+	AdminAddr           string
+	AdminToken          Secret
+	WatchInterval       time.Duration
+	HTTPRecord          string
+	HTTPReplay          string
+	ReplayLatency       bool
+	ClockSpeed          float64
+	TimeSync            time.Duration
+	DriftAlertMs        int
+	DepthLimit          int
+	MaxSlippageBps      float64
+	StopLossBps         float64
+	TakeProfitBps       float64
+	LiquidityBps        float64
+	MaxBookShare        float64
+	MaxAdverseImbalance float64
+	FactorWeights       map[string]float64
+	FactorMinScore      float64
+	Overrides           map[string]SymbolOverride
+}
+
+// SymbolOverride replaces the global value of any non-nil field for one symbol.
+type SymbolOverride struct {
+	ZThreshold     *float64
+	SpreadMaxRatio *float64
+	FundingAbsMax  *float64
+	BaseSize       *float64
+	Cooldown       *time.Duration
+	HoldDuration   *time.Duration
+	MaxNotionalUSD *float64
+	MaxSlippageBps *float64
+	StopLossBps    *float64
+	TakeProfitBps  *float64
+	BasisEstimator *string
+	BasisHalfLife  *time.Duration
+	BasisOutlierZ  *float64
+	BasisWindow    *time.Duration
+	Leverage       *float64
+	MarginMode     *string
+	ExecAlgo       *string
+}
+
+// SymbolParams are the effective strategy parameters for one symbol.
+type SymbolParams struct {
+	ZThreshold     float64
+	SpreadMaxRatio float64
+	FundingAbsMax  float64
+	BaseSize       float64
+	Cooldown       time.Duration
+	HoldDuration   time.Duration
+	MaxNotionalUSD float64
+	MaxSlippageBps float64
+	StopLossBps    float64
+	TakeProfitBps  float64
+	BasisEstimator string
+	BasisHalfLife  time.Duration
+	BasisOutlierZ  float64
+	BasisWindow    time.Duration
+	BasisStep      time.Duration
+	BasisMaxGap    time.Duration
+	Leverage       float64
+	MarginMode     string
+	ExecAlgo       string
+}
+
+func (c Config) ForSymbol(symbol string) SymbolParams {
+	p := SymbolParams{
+		ZThreshold:     c.ZThreshold,
+		SpreadMaxRatio: c.SpreadMaxRatio,
+		FundingAbsMax:  c.FundingAbsMax,
+		BaseSize:       c.BaseSize,
+		Cooldown:       c.Cooldown,
+		HoldDuration:   c.HoldDuration,
+		MaxNotionalUSD: c.MaxNotionalUSD,
+		MaxSlippageBps: c.MaxSlippageBps,
+		StopLossBps:    c.StopLossBps,
+		TakeProfitBps:  c.TakeProfitBps,
+		BasisEstimator: c.BasisEstimator,
+		BasisHalfLife:  c.BasisHalfLife,
+		BasisOutlierZ:  c.BasisOutlierZ,
+		BasisWindow:    c.BasisWindow,
+		BasisStep:      c.BasisStep,
+		BasisMaxGap:    c.BasisMaxGap,
+		Leverage:       c.Leverage,
+		MarginMode:     c.MarginMode,
+		ExecAlgo:       c.ExecAlgo,
+	}
+	o, ok := c.Overrides[symbol]
+	if !ok {
+		return p
+	}
+	if o.ZThreshold != nil {
+		p.ZThreshold = *o.ZThreshold
+	}
+	if o.SpreadMaxRatio != nil {
+		p.SpreadMaxRatio = *o.SpreadMaxRatio
+	}
+	if o.FundingAbsMax != nil {
+		p.FundingAbsMax = *o.FundingAbsMax
+	}
+	if o.BaseSize != nil {
+		p.BaseSize = *o.BaseSize
+	}
+	if o.Cooldown != nil {
+		p.Cooldown = *o.Cooldown
+	}
+	if o.HoldDuration != nil {
+		p.HoldDuration = *o.HoldDuration
+	}
+	if o.MaxNotionalUSD != nil {
+		p.MaxNotionalUSD = *o.MaxNotionalUSD
+	}
+	if o.MaxSlippageBps != nil {
+		p.MaxSlippageBps = *o.MaxSlippageBps
+	}
+	if o.StopLossBps != nil {
+		p.StopLossBps = *o.StopLossBps
+	}
+	if o.TakeProfitBps != nil {
+		p.TakeProfitBps = *o.TakeProfitBps
+	}
+	if o.BasisEstimator != nil {
+		p.BasisEstimator = *o.BasisEstimator
+	}
+	if o.BasisHalfLife != nil {
+		p.BasisHalfLife = *o.BasisHalfLife
 	}
+	if o.BasisOutlierZ != nil {
+		p.BasisOutlierZ = *o.BasisOutlierZ
+	}
+	if o.BasisWindow != nil {
+		p.BasisWindow = *o.BasisWindow
+	}
+	if o.Leverage != nil {
+		p.Leverage = *o.Leverage
+	}
+	if o.MarginMode != nil {
+		p.MarginMode = *o.MarginMode
+	}
+	if o.ExecAlgo != nil {
+		p.ExecAlgo = *o.ExecAlgo
+	}
+	return p
+}
+
+func Defaults() Config {
+	return Config{
+		BaseURL: "https://api-contract.weex.com",
+		Symbols: []string{
+			"cmt_btcusdt", "cmt_ethusdt", "cmt_solusdt", "cmt_bnbusdt",
+			"cmt_xrpusdt", "cmt_adausdt", "cmt_ltcusdt", "cmt_linkusdt",
+		},
+		QueryInterval:       1 * time.Second,
+		LogDir:              "../log",
+		ZThreshold:          1.2,
+		FundingAbsMax:       0.01,
+		SpreadMaxRatio:      0.005,
+		BaseSize:            0.001,
+		Cooldown:            1 * time.Minute,
+		HoldDuration:        3 * time.Minute,
+		TraderMode:          "mock",
+		MetricsInterval:     10 * time.Second,
+		MinSizeMap:          make(map[string]float64),
+		MaxNotionalUSD:      300,
+		BasisEstimator:      "window",
+		BasisHalfLife:       time.Minute,
+		BasisWindow:         10 * time.Minute,
+		BasisStep:           5 * time.Second,
+		BasisMaxGap:         time.Minute,
+		SizingMethod:        "fixed",
+		RiskPerTrade:        0.005,
+		EquityFraction:      0.05,
+		VolHalfLife:         30 * time.Minute,
+		Leverage:            1,
+		MarginMode:          "cross",
+		AccountSetup:        "enforce",
+		ExecAlgo:            "limit",
+		ExecUrgentAlgo:      "limit_then_market",
+		ExecReprice:         2 * time.Second,
+		ExecTimeout:         30 * time.Second,
+		IcebergShow:         0.2,
+		TWAPDuration:        time.Minute,
+		TWAPSlices:          5,
+		LogBufferSize:       4096,
+		LogOverflow:         "block",
+		LogFlushEvery:       1 * time.Second,
+		LogLang:             "both",
+		ShutdownAction:      "none",
+		ShutdownTimeout:     30 * time.Second,
+		StaleAfter:          30 * time.Second,
+		MaxDriftMs:          5000,
+		MaxRateUsage:        0.9,
+		WatchInterval:       2 * time.Second,
+		ClockSpeed:          1,
+		TimeSync:            time.Minute,
+		DriftAlertMs:        1000,
+		DepthLimit:          15,
+		MaxSlippageBps:      10,
+		LiquidityBps:        25,
+		MaxBookShare:        0.2,
+		MaxAdverseImbalance: 1,
+		FactorWeights:       make(map[string]float64),
+		Overrides:           make(map[string]SymbolOverride),
+	}
+}
+
+// Load builds the config from defaults, the file named by WEEX_CONFIG (if
+// any) and then WEEX_* environment variables, and validates the result.
+func Load() (Config, error) {
+	return LoadFile(os.Getenv("WEEX_CONFIG"))
+}
+
+// LoadFile is Load with an explicit config file path; empty means none.
+// Every parse and validation problem is reported together in a
+// *ValidationError.
+func LoadFile(path string) (Config, error) {
+	cfg := Defaults()
+	var problems []string
+	if path != "" {
+		fp, err := applyFile(&cfg, path)
+		if err != nil {
+			return cfg, err
+		}
+		problems = append(problems, fp...)
+	}
+	env := &envReader{}
+	env.apply(&cfg)
+	problems = append(problems, env.errs...)
+	problems = append(problems, applyKeystore(&cfg)...)
+	problems = append(problems, cfg.problems()...)
+	if len(problems) > 0 {
+		return cfg, &ValidationError{Problems: problems}
+	}
+	return cfg, nil
+}
+
+type envReader struct {
+	errs []string
+}
+
+func (r *envReader) apply(c *Config) {
+	r.str("WEEX_BASE_URL", &c.BaseURL)
+	r.secret("WEEX_API_KEY", &c.APIKey)
+	r.secret("WEEX_API_SECRET", &c.APISecret)
+	r.secret("WEEX_API_PASSPHRASE", &c.Passphrase)
+	r.str("WEEX_KEYSTORE", &c.Keystore)
 	if v := os.Getenv("WEEX_SYMBOLS"); v != "" {
-		parts := strings.Split(v, ",")
-		syms = make([]string, 0, len(parts))
-		for _, p := range parts {
-			p = strings.TrimSpace(p)
-			if p != "" {
-				syms = append(syms, p)
-			}
+		c.Symbols = splitList(v)
+	}
+	r.duration("WEEX_QUERY_INTERVAL", &c.QueryInterval)
+	r.str("WEEX_LOG_DIR", &c.LogDir)
+	r.float("WEEX_Z_THRESHOLD", &c.ZThreshold)
+	r.float("WEEX_FUND_RATE_MAX_ABS", &c.FundingAbsMax)
+	r.float("WEEX_SPREAD_MAX_RATIO", &c.SpreadMaxRatio)
+	r.float("WEEX_BASE_SIZE", &c.BaseSize)
+	r.duration("WEEX_COOLDOWN", &c.Cooldown)
+	r.duration("WEEX_HOLD_DURATION", &c.HoldDuration)
+	r.str("WEEX_TRADER_MODE", &c.TraderMode)
+	r.duration("WEEX_METRICS_INTERVAL", &c.MetricsInterval)
+	r.floatMap("WEEX_MIN_SIZE_MAP", c.MinSizeMap)
+	r.float("WEEX_MAX_NOTIONAL_USD", &c.MaxNotionalUSD)
+	r.str("WEEX_BASIS_ESTIMATOR", &c.BasisEstimator)
+	r.duration("WEEX_BASIS_HALF_LIFE", &c.BasisHalfLife)
+	r.float("WEEX_BASIS_OUTLIER_Z", &c.BasisOutlierZ)
+	r.duration("WEEX_BASIS_WINDOW", &c.BasisWindow)
+	r.duration("WEEX_BASIS_STEP", &c.BasisStep)
+	r.duration("WEEX_BASIS_MAX_GAP", &c.BasisMaxGap)
+	r.str("WEEX_SIZING_METHOD", &c.SizingMethod)
+	r.float("WEEX_RISK_PER_TRADE", &c.RiskPerTrade)
+	r.float("WEEX_EQUITY_FRACTION", &c.EquityFraction)
+	r.duration("WEEX_VOL_HALF_LIFE", &c.VolHalfLife)
+	r.float("WEEX_SIZING_EQUITY", &c.SizingEquity)
+	r.float("WEEX_LEVERAGE", &c.Leverage)
+	r.str("WEEX_MARGIN_MODE", &c.MarginMode)
+	r.str("WEEX_ACCOUNT_SETUP", &c.AccountSetup)
+	r.str("WEEX_EXEC_ALGO", &c.ExecAlgo)
+	r.float("WEEX_EXEC_URGENT_Z", &c.ExecUrgentZ)
+	r.str("WEEX_EXEC_URGENT_ALGO", &c.ExecUrgentAlgo)
+	r.duration("WEEX_EXEC_REPRICE", &c.ExecReprice)
+	r.duration("WEEX_EXEC_TIMEOUT", &c.ExecTimeout)
+	r.float("WEEX_ICEBERG_SHOW", &c.IcebergShow)
+	r.duration("WEEX_TWAP_DURATION", &c.TWAPDuration)
+	r.int("WEEX_TWAP_SLICES", &c.TWAPSlices)
+	r.bool("WEEX_FLATTEN_ON_START", &c.FlattenOnStart)
+	r.int("WEEX_LOG_BUFFER_SIZE", &c.LogBufferSize)
+	r.str("WEEX_LOG_OVERFLOW", &c.LogOverflow)
+	r.duration("WEEX_LOG_FLUSH_INTERVAL", &c.LogFlushEvery)
+	r.str("WEEX_LOG_LANG", &c.LogLang)
+	r.str("WEEX_SHUTDOWN_ACTION", &c.ShutdownAction)
+	r.duration("WEEX_SHUTDOWN_TIMEOUT", &c.ShutdownTimeout)
+	r.str("WEEX_HTTP_ADDR", &c.HTTPAddr)
+	r.duration("WEEX_HEALTH_STALE_AFTER", &c.StaleAfter)
+	r.int("WEEX_HEALTH_MAX_DRIFT_MS", &c.MaxDriftMs)
+	r.float("WEEX_HEALTH_MAX_RATE_USAGE", &c.MaxRateUsage)
+	r.str("WEEX_ADMIN_ADDR", &c.AdminAddr)
+	r.secret("WEEX_ADMIN_TOKEN", &c.AdminToken)
+	r.duration("WEEX_CONFIG_WATCH_INTERVAL", &c.WatchInterval)
+	r.str("WEEX_HTTP_RECORD", &c.HTTPRecord)
+	r.str("WEEX_HTTP_REPLAY", &c.HTTPReplay)
+	r.bool("WEEX_HTTP_REPLAY_LATENCY", &c.ReplayLatency)
+	r.float("WEEX_CLOCK_SPEED", &c.ClockSpeed)
+	r.duration("WEEX_TIME_SYNC_INTERVAL", &c.TimeSync)
+	r.int("WEEX_DRIFT_ALERT_MS", &c.DriftAlertMs)
+	r.int("WEEX_DEPTH_LIMIT", &c.DepthLimit)
+	r.float("WEEX_MAX_SLIPPAGE_BPS", &c.MaxSlippageBps)
+	r.float("WEEX_STOP_LOSS_BPS", &c.StopLossBps)
+	r.float("WEEX_TAKE_PROFIT_BPS", &c.TakeProfitBps)
+	r.float("WEEX_LIQUIDITY_BPS", &c.LiquidityBps)
+	r.float("WEEX_MAX_BOOK_SHARE", &c.MaxBookShare)
+	r.float("WEEX_MAX_ADVERSE_IMBALANCE", &c.MaxAdverseImbalance)
+	r.floatMap("WEEX_FACTOR_WEIGHTS", c.FactorWeights)
+	r.float("WEEX_FACTOR_MIN_SCORE", &c.FactorMinScore)
+}
+
+func (r *envReader) fail(key, v string, err error) {
+	r.errs = append(r.errs, fmt.Sprintf("%s=%q: %v", key, v, err))
+}
+
+func (r *envReader) str(key string, dst *string) {
+	if v := os.Getenv(key); v != "" {
+		*dst = v
+	}
+}
+
+// secret reads key, or the file named by key+"_FILE"; setting both is an error.
+func (r *envReader) secret(key string, dst *Secret) {
+	v, f := os.Getenv(key), os.Getenv(key+"_FILE")
+	switch {
+	case v != "" && f != "":
+		r.errs = append(r.errs, fmt.Sprintf("set only one of %s and %s_FILE", key, key))
+	case f != "":
+		s, err := readSecretFile(f)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Sprintf("%s_FILE: %v", key, err))
+			return
 		}
+		*dst = s
+	case v != "":
+		*dst = Secret(v)
 	}
-	qi := getenvDuration("WEEX_QUERY_INTERVAL", 1*time.Second)
-	logDir := getenv("WEEX_LOG_DIR", "../log")
-	z := getenvFloat("WEEX_Z_THRESHOLD", 1.2)
-	frMax := getenvFloat("WEEX_FUND_RATE_MAX_ABS", 0.01)
-	spMax := getenvFloat("WEEX_SPREAD_MAX_RATIO", 0.005)
-	cd := getenvDuration("WEEX_COOLDOWN", 1*time.Minute)
-	hd := getenvDuration("WEEX_HOLD_DURATION", 3*time.Minute)
-	tm := getenv("WEEX_TRADER_MODE", "mock")
-	mi := getenvDuration("WEEX_METRICS_INTERVAL", 10*time.Second)
-	msm := getenvFloatMap("WEEX_MIN_SIZE_MAP")
-	mnu := getenvFloat("WEEX_MAX_NOTIONAL_USD", 300)
-	fos := getenv("WEEX_FLATTEN_ON_START", "false") == "true"
+}
 
-	return Config{
-		BaseURL:         baseURL,
-		APIKey:          apiKey,
-		APISecret:       apiSecret,
-		Passphrase:      pass,
-		Symbols:         syms,
-		QueryInterval:   qi,
-		LogDir:          logDir,
-		ZThreshold:      z,
-		FundingAbsMax:   frMax,
-		SpreadMaxRatio:  spMax,
-		Cooldown:        cd,
-		HoldDuration:    hd,
-		TraderMode:      tm,
-		MetricsInterval: mi,
-		MinSizeMap:      msm,
-		MaxNotionalUSD:  mnu,
-		FlattenOnStart:  fos,
-	}
-}
-
-func getenv(key, def string) string {
+func (r *envReader) duration(key string, dst *time.Duration) {
+	if v := os.Getenv(key); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			r.fail(key, v, err)
+			return
+		}
+		*dst = d
+	}
+}
+
+func (r *envReader) int(key string, dst *int) {
 	if v := os.Getenv(key); v != "" {
-		return v
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			r.fail(key, v, err)
+			return
+		}
+		*dst = n
 	}
-	return def
 }
 
-func getenvDuration(key string, def time.Duration) time.Duration {
+func (r *envReader) float(key string, dst *float64) {
 	if v := os.Getenv(key); v != "" {
-		if d, err := time.ParseDuration(v); err == nil {
-			return d
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			r.fail(key, v, err)
+			return
 		}
+		*dst = f
 	}
-	return def
 }
 
-func getenvFloat(key string, def float64) float64 {
+func (r *envReader) bool(key string, dst *bool) {
 	if v := os.Getenv(key); v != "" {
-		if f, err := strconv.ParseFloat(v, 64); err == nil {
-			return f
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			r.fail(key, v, err)
+			return
 		}
+		*dst = b
 	}
-	return def
 }
 
-func getenvFloatMap(key string) map[string]float64 {
-	out := make(map[string]float64)
+// floatMap parses "sym:val,sym:val" into dst.
+func (r *envReader) floatMap(key string, dst map[string]float64) {
 	v := os.Getenv(key)
 	if v == "" {
-		return out
+		return
 	}
-	parts := strings.Split(v, ",")
-	for _, p := range parts {
-		p = strings.TrimSpace(p)
-		if p == "" {
-			continue
-		}
+	for _, p := range splitList(v) {
 		kv := strings.SplitN(p, ":", 2)
-		if len(kv) != 2 {
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			r.fail(key, p, fmt.Errorf("want symbol:value"))
 			continue
 		}
-		sym := strings.TrimSpace(kv[0])
 		f, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
 		if err != nil {
+			r.fail(key, p, err)
 			continue
 		}
-		if sym != "" && f > 0 {
-			out[sym] = f
+		dst[strings.TrimSpace(kv[0])] = f
+	}
+}
+
+func splitList(v string) []string {
+	parts := strings.Split(v, ",")
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			out = append(out, p)
 		}
 	}
 	return out
@@ -0,0 +1,331 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the on-disk schema shared by YAML, TOML and JSON. Keys are
+// snake_case; absent keys keep the default. Durations use Go syntax ("90s").
+type fileConfig struct {
+	BaseURL             *string                 `json:"base_url" yaml:"base_url" toml:"base_url"`
+	APIKey              *string                 `json:"api_key" yaml:"api_key" toml:"api_key"`
+	APISecret           *string                 `json:"api_secret" yaml:"api_secret" toml:"api_secret"`
+	Passphrase          *string                 `json:"api_passphrase" yaml:"api_passphrase" toml:"api_passphrase"`
+	APIKeyFile          *string                 `json:"api_key_file" yaml:"api_key_file" toml:"api_key_file"`
+	APISecretFile       *string                 `json:"api_secret_file" yaml:"api_secret_file" toml:"api_secret_file"`
+	PassphraseFile      *string                 `json:"api_passphrase_file" yaml:"api_passphrase_file" toml:"api_passphrase_file"`
+	Keystore            *string                 `json:"keystore" yaml:"keystore" toml:"keystore"`
+	Symbols             []string                `json:"symbols" yaml:"symbols" toml:"symbols"`
+	QueryInterval       *string                 `json:"query_interval" yaml:"query_interval" toml:"query_interval"`
+	LogDir              *string                 `json:"log_dir" yaml:"log_dir" toml:"log_dir"`
+	ZThreshold          *float64                `json:"z_threshold" yaml:"z_threshold" toml:"z_threshold"`
+	FundingAbsMax       *float64                `json:"funding_abs_max" yaml:"funding_abs_max" toml:"funding_abs_max"`
+	SpreadMaxRatio      *float64                `json:"spread_max_ratio" yaml:"spread_max_ratio" toml:"spread_max_ratio"`
+	BaseSize            *float64                `json:"base_size" yaml:"base_size" toml:"base_size"`
+	Cooldown            *string                 `json:"cooldown" yaml:"cooldown" toml:"cooldown"`
+	HoldDuration        *string                 `json:"hold_duration" yaml:"hold_duration" toml:"hold_duration"`
+	TraderMode          *string                 `json:"trader_mode" yaml:"trader_mode" toml:"trader_mode"`
+	MetricsInterval     *string                 `json:"metrics_interval" yaml:"metrics_interval" toml:"metrics_interval"`
+	MinSizeMap          map[string]float64      `json:"min_size" yaml:"min_size" toml:"min_size"`
+	MaxNotionalUSD      *float64                `json:"max_notional_usd" yaml:"max_notional_usd" toml:"max_notional_usd"`
+	BasisEstimator      *string                 `json:"basis_estimator" yaml:"basis_estimator" toml:"basis_estimator"`
+	BasisHalfLife       *string                 `json:"basis_half_life" yaml:"basis_half_life" toml:"basis_half_life"`
+	BasisOutlierZ       *float64                `json:"basis_outlier_z" yaml:"basis_outlier_z" toml:"basis_outlier_z"`
+	BasisWindow         *string                 `json:"basis_window" yaml:"basis_window" toml:"basis_window"`
+	BasisStep           *string                 `json:"basis_step" yaml:"basis_step" toml:"basis_step"`
+	BasisMaxGap         *string                 `json:"basis_max_gap" yaml:"basis_max_gap" toml:"basis_max_gap"`
+	SizingMethod        *string                 `json:"sizing_method" yaml:"sizing_method" toml:"sizing_method"`
+	RiskPerTrade        *float64                `json:"risk_per_trade" yaml:"risk_per_trade" toml:"risk_per_trade"`
+	EquityFraction      *float64                `json:"equity_fraction" yaml:"equity_fraction" toml:"equity_fraction"`
+	VolHalfLife         *string                 `json:"vol_half_life" yaml:"vol_half_life" toml:"vol_half_life"`
+	SizingEquity        *float64                `json:"sizing_equity" yaml:"sizing_equity" toml:"sizing_equity"`
+	Leverage            *float64                `json:"leverage" yaml:"leverage" toml:"leverage"`
+	MarginMode          *string                 `json:"margin_mode" yaml:"margin_mode" toml:"margin_mode"`
+	AccountSetup        *string                 `json:"account_setup" yaml:"account_setup" toml:"account_setup"`
+	ExecAlgo            *string                 `json:"exec_algo" yaml:"exec_algo" toml:"exec_algo"`
+	ExecUrgentZ         *float64                `json:"exec_urgent_z" yaml:"exec_urgent_z" toml:"exec_urgent_z"`
+	ExecUrgentAlgo      *string                 `json:"exec_urgent_algo" yaml:"exec_urgent_algo" toml:"exec_urgent_algo"`
+	ExecReprice         *string                 `json:"exec_reprice" yaml:"exec_reprice" toml:"exec_reprice"`
+	ExecTimeout         *string                 `json:"exec_timeout" yaml:"exec_timeout" toml:"exec_timeout"`
+	IcebergShow         *float64                `json:"iceberg_show" yaml:"iceberg_show" toml:"iceberg_show"`
+	TWAPDuration        *string                 `json:"twap_duration" yaml:"twap_duration" toml:"twap_duration"`
+	TWAPSlices          *int                    `json:"twap_slices" yaml:"twap_slices" toml:"twap_slices"`
+	FlattenOnStart      *bool                   `json:"flatten_on_start" yaml:"flatten_on_start" toml:"flatten_on_start"`
+	LogBufferSize       *int                    `json:"log_buffer_size" yaml:"log_buffer_size" toml:"log_buffer_size"`
+	LogOverflow         *string                 `json:"log_overflow" yaml:"log_overflow" toml:"log_overflow"`
+	LogFlushEvery       *string                 `json:"log_flush_interval" yaml:"log_flush_interval" toml:"log_flush_interval"`
+	LogLang             *string                 `json:"log_lang" yaml:"log_lang" toml:"log_lang"`
+	ShutdownAction      *string                 `json:"shutdown_action" yaml:"shutdown_action" toml:"shutdown_action"`
+	ShutdownTimeout     *string                 `json:"shutdown_timeout" yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	HTTPAddr            *string                 `json:"http_addr" yaml:"http_addr" toml:"http_addr"`
+	StaleAfter          *string                 `json:"health_stale_after" yaml:"health_stale_after" toml:"health_stale_after"`
+	MaxDriftMs          *int                    `json:"health_max_drift_ms" yaml:"health_max_drift_ms" toml:"health_max_drift_ms"`
+	MaxRateUsage        *float64                `json:"health_max_rate_usage" yaml:"health_max_rate_usage" toml:"health_max_rate_usage"`
+	AdminAddr           *string                 `json:"admin_addr" yaml:"admin_addr" toml:"admin_addr"`
+	AdminToken          *string                 `json:"admin_token" yaml:"admin_token" toml:"admin_token"`
+	AdminTokenFile      *string                 `json:"admin_token_file" yaml:"admin_token_file" toml:"admin_token_file"`
+	WatchInterval       *string                 `json:"config_watch_interval" yaml:"config_watch_interval" toml:"config_watch_interval"`
+	HTTPRecord          *string                 `json:"http_record" yaml:"http_record" toml:"http_record"`
+	HTTPReplay          *string                 `json:"http_replay" yaml:"http_replay" toml:"http_replay"`
+	ReplayLatency       *bool                   `json:"http_replay_latency" yaml:"http_replay_latency" toml:"http_replay_latency"`
+	ClockSpeed          *float64                `json:"clock_speed" yaml:"clock_speed" toml:"clock_speed"`
+	TimeSync            *string                 `json:"time_sync_interval" yaml:"time_sync_interval" toml:"time_sync_interval"`
+	DriftAlertMs        *int                    `json:"drift_alert_ms" yaml:"drift_alert_ms" toml:"drift_alert_ms"`
+	DepthLimit          *int                    `json:"depth_limit" yaml:"depth_limit" toml:"depth_limit"`
+	MaxSlippageBps      *float64                `json:"max_slippage_bps" yaml:"max_slippage_bps" toml:"max_slippage_bps"`
+	StopLossBps         *float64                `json:"stop_loss_bps" yaml:"stop_loss_bps" toml:"stop_loss_bps"`
+	TakeProfitBps       *float64                `json:"take_profit_bps" yaml:"take_profit_bps" toml:"take_profit_bps"`
+	LiquidityBps        *float64                `json:"liquidity_bps" yaml:"liquidity_bps" toml:"liquidity_bps"`
+	MaxBookShare        *float64                `json:"max_book_share" yaml:"max_book_share" toml:"max_book_share"`
+	MaxAdverseImbalance *float64                `json:"max_adverse_imbalance" yaml:"max_adverse_imbalance" toml:"max_adverse_imbalance"`
+	FactorWeights       map[string]float64      `json:"factor_weights" yaml:"factor_weights" toml:"factor_weights"`
+	FactorMinScore      *float64                `json:"factor_min_score" yaml:"factor_min_score" toml:"factor_min_score"`
+	Overrides           map[string]fileOverride `json:"symbol_overrides" yaml:"symbol_overrides" toml:"symbol_overrides"`
+}
+
+type fileOverride struct {
+	ZThreshold     *float64 `json:"z_threshold" yaml:"z_threshold" toml:"z_threshold"`
+	SpreadMaxRatio *float64 `json:"spread_max_ratio" yaml:"spread_max_ratio" toml:"spread_max_ratio"`
+	FundingAbsMax  *float64 `json:"funding_abs_max" yaml:"funding_abs_max" toml:"funding_abs_max"`
+	BaseSize       *float64 `json:"base_size" yaml:"base_size" toml:"base_size"`
+	Cooldown       *string  `json:"cooldown" yaml:"cooldown" toml:"cooldown"`
+	HoldDuration   *string  `json:"hold_duration" yaml:"hold_duration" toml:"hold_duration"`
+	MaxNotionalUSD *float64 `json:"max_notional_usd" yaml:"max_notional_usd" toml:"max_notional_usd"`
+	MaxSlippageBps *float64 `json:"max_slippage_bps" yaml:"max_slippage_bps" toml:"max_slippage_bps"`
+	StopLossBps    *float64 `json:"stop_loss_bps" yaml:"stop_loss_bps" toml:"stop_loss_bps"`
+	TakeProfitBps  *float64 `json:"take_profit_bps" yaml:"take_profit_bps" toml:"take_profit_bps"`
+	BasisEstimator *string  `json:"basis_estimator" yaml:"basis_estimator" toml:"basis_estimator"`
+	BasisHalfLife  *string  `json:"basis_half_life" yaml:"basis_half_life" toml:"basis_half_life"`
+	BasisOutlierZ  *float64 `json:"basis_outlier_z" yaml:"basis_outlier_z" toml:"basis_outlier_z"`
+	BasisWindow    *string  `json:"basis_window" yaml:"basis_window" toml:"basis_window"`
+	Leverage       *float64 `json:"leverage" yaml:"leverage" toml:"leverage"`
+	MarginMode     *string  `json:"margin_mode" yaml:"margin_mode" toml:"margin_mode"`
+	ExecAlgo       *string  `json:"exec_algo" yaml:"exec_algo" toml:"exec_algo"`
+}
+
+// decodeFile parses path strictly: unknown keys are errors.
+func decodeFile(path string) (fileConfig, error) {
+	var fc fileConfig
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fc, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		if err := dec.Decode(&fc); err != nil {
+			return fc, fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(b), &fc)
+		if err != nil {
+			return fc, fmt.Errorf("%s: %w", path, err)
+		}
+		if und := md.Undecoded(); len(und) > 0 {
+			keys := make([]string, len(und))
+			for i, k := range und {
+				keys[i] = k.String()
+			}
+			return fc, fmt.Errorf("%s: unknown keys %s", path, strings.Join(keys, ", "))
+		}
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&fc); err != nil {
+			return fc, fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return fc, fmt.Errorf("%s: unsupported config format (want .yaml, .yml, .toml or .json)", path)
+	}
+	return fc, nil
+}
+
+// applyFile overlays path onto c. A read or syntax error is returned as err;
+// bad individual values are returned as problems so they can be reported
+// together with validation failures.
+func applyFile(c *Config, path string) (problems []string, err error) {
+	fc, err := decodeFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dur := func(key string, src *string, dst *time.Duration) {
+		if src == nil {
+			return
+		}
+		d, err := time.ParseDuration(*src)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s=%q: %v", path, key, *src, err))
+			return
+		}
+		*dst = d
+	}
+	secret := func(key string, val, file *string, dst *Secret) {
+		switch {
+		case val != nil && file != nil:
+			problems = append(problems, fmt.Sprintf("%s: set only one of %s and %s_file", path, key, key))
+		case file != nil:
+			s, err := readSecretFile(*file)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %s_file: %v", path, key, err))
+				return
+			}
+			*dst = s
+		case val != nil:
+			*dst = Secret(*val)
+		}
+	}
+	setStr(&c.BaseURL, fc.BaseURL)
+	secret("api_key", fc.APIKey, fc.APIKeyFile, &c.APIKey)
+	secret("api_secret", fc.APISecret, fc.APISecretFile, &c.APISecret)
+	secret("api_passphrase", fc.Passphrase, fc.PassphraseFile, &c.Passphrase)
+	setStr(&c.Keystore, fc.Keystore)
+	if fc.Symbols != nil {
+		c.Symbols = fc.Symbols
+	}
+	dur("query_interval", fc.QueryInterval, &c.QueryInterval)
+	setStr(&c.LogDir, fc.LogDir)
+	setFloat(&c.ZThreshold, fc.ZThreshold)
+	setFloat(&c.FundingAbsMax, fc.FundingAbsMax)
+	setFloat(&c.SpreadMaxRatio, fc.SpreadMaxRatio)
+	setFloat(&c.BaseSize, fc.BaseSize)
+	dur("cooldown", fc.Cooldown, &c.Cooldown)
+	dur("hold_duration", fc.HoldDuration, &c.HoldDuration)
+	setStr(&c.TraderMode, fc.TraderMode)
+	dur("metrics_interval", fc.MetricsInterval, &c.MetricsInterval)
+	for k, v := range fc.MinSizeMap {
+		c.MinSizeMap[k] = v
+	}
+	setFloat(&c.MaxNotionalUSD, fc.MaxNotionalUSD)
+	setStr(&c.BasisEstimator, fc.BasisEstimator)
+	dur("basis_half_life", fc.BasisHalfLife, &c.BasisHalfLife)
+	setFloat(&c.BasisOutlierZ, fc.BasisOutlierZ)
+	dur("basis_window", fc.BasisWindow, &c.BasisWindow)
+	dur("basis_step", fc.BasisStep, &c.BasisStep)
+	dur("basis_max_gap", fc.BasisMaxGap, &c.BasisMaxGap)
+	setStr(&c.SizingMethod, fc.SizingMethod)
+	setFloat(&c.RiskPerTrade, fc.RiskPerTrade)
+	setFloat(&c.EquityFraction, fc.EquityFraction)
+	dur("vol_half_life", fc.VolHalfLife, &c.VolHalfLife)
+	setFloat(&c.SizingEquity, fc.SizingEquity)
+	setFloat(&c.Leverage, fc.Leverage)
+	setStr(&c.MarginMode, fc.MarginMode)
+	setStr(&c.AccountSetup, fc.AccountSetup)
+	setStr(&c.ExecAlgo, fc.ExecAlgo)
+	setFloat(&c.ExecUrgentZ, fc.ExecUrgentZ)
+	setStr(&c.ExecUrgentAlgo, fc.ExecUrgentAlgo)
+	dur("exec_reprice", fc.ExecReprice, &c.ExecReprice)
+	dur("exec_timeout", fc.ExecTimeout, &c.ExecTimeout)
+	setFloat(&c.IcebergShow, fc.IcebergShow)
+	dur("twap_duration", fc.TWAPDuration, &c.TWAPDuration)
+	if fc.TWAPSlices != nil {
+		c.TWAPSlices = *fc.TWAPSlices
+	}
+	if fc.FlattenOnStart != nil {
+		c.FlattenOnStart = *fc.FlattenOnStart
+	}
+	if fc.LogBufferSize != nil {
+		c.LogBufferSize = *fc.LogBufferSize
+	}
+	setStr(&c.LogOverflow, fc.LogOverflow)
+	dur("log_flush_interval", fc.LogFlushEvery, &c.LogFlushEvery)
+	setStr(&c.LogLang, fc.LogLang)
+	setStr(&c.ShutdownAction, fc.ShutdownAction)
+	dur("shutdown_timeout", fc.ShutdownTimeout, &c.ShutdownTimeout)
+	setStr(&c.HTTPAddr, fc.HTTPAddr)
+	dur("health_stale_after", fc.StaleAfter, &c.StaleAfter)
+	if fc.MaxDriftMs != nil {
+		c.MaxDriftMs = *fc.MaxDriftMs
+	}
+	setFloat(&c.MaxRateUsage, fc.MaxRateUsage)
+	setStr(&c.AdminAddr, fc.AdminAddr)
+	secret("admin_token", fc.AdminToken, fc.AdminTokenFile, &c.AdminToken)
+	dur("config_watch_interval", fc.WatchInterval, &c.WatchInterval)
+	setStr(&c.HTTPRecord, fc.HTTPRecord)
+	setStr(&c.HTTPReplay, fc.HTTPReplay)
+	if fc.ReplayLatency != nil {
+		c.ReplayLatency = *fc.ReplayLatency
+	}
+	setFloat(&c.ClockSpeed, fc.ClockSpeed)
+	dur("time_sync_interval", fc.TimeSync, &c.TimeSync)
+	if fc.DriftAlertMs != nil {
+		c.DriftAlertMs = *fc.DriftAlertMs
+	}
+	if fc.DepthLimit != nil {
+		c.DepthLimit = *fc.DepthLimit
+	}
+	setFloat(&c.MaxSlippageBps, fc.MaxSlippageBps)
+	setFloat(&c.StopLossBps, fc.StopLossBps)
+	setFloat(&c.TakeProfitBps, fc.TakeProfitBps)
+	setFloat(&c.LiquidityBps, fc.LiquidityBps)
+	setFloat(&c.MaxBookShare, fc.MaxBookShare)
+	setFloat(&c.MaxAdverseImbalance, fc.MaxAdverseImbalance)
+	for k, v := range fc.FactorWeights {
+		c.FactorWeights[k] = v
+	}
+	setFloat(&c.FactorMinScore, fc.FactorMinScore)
+
+	syms := make([]string, 0, len(fc.Overrides))
+	for s := range fc.Overrides {
+		syms = append(syms, s)
+	}
+	sort.Strings(syms)
+	for _, s := range syms {
+		fo := fc.Overrides[s]
+		o := SymbolOverride{
+			ZThreshold:     fo.ZThreshold,
+			SpreadMaxRatio: fo.SpreadMaxRatio,
+			FundingAbsMax:  fo.FundingAbsMax,
+			BaseSize:       fo.BaseSize,
+			MaxNotionalUSD: fo.MaxNotionalUSD,
+			MaxSlippageBps: fo.MaxSlippageBps,
+			StopLossBps:    fo.StopLossBps,
+			TakeProfitBps:  fo.TakeProfitBps,
+			BasisEstimator: fo.BasisEstimator,
+			BasisOutlierZ:  fo.BasisOutlierZ,
+			Leverage:       fo.Leverage,
+			MarginMode:     fo.MarginMode,
+			ExecAlgo:       fo.ExecAlgo,
+		}
+		if fo.BasisWindow != nil {
+			o.BasisWindow = new(time.Duration)
+			dur("symbol_overrides."+s+".basis_window", fo.BasisWindow, o.BasisWindow)
+		}
+		if fo.BasisHalfLife != nil {
+			o.BasisHalfLife = new(time.Duration)
+			dur("symbol_overrides."+s+".basis_half_life", fo.BasisHalfLife, o.BasisHalfLife)
+		}
+		if fo.Cooldown != nil {
+			o.Cooldown = new(time.Duration)
+			dur("symbol_overrides."+s+".cooldown", fo.Cooldown, o.Cooldown)
+		}
+		if fo.HoldDuration != nil {
+			o.HoldDuration = new(time.Duration)
+			dur("symbol_overrides."+s+".hold_duration", fo.HoldDuration, o.HoldDuration)
+		}
+		c.Overrides[s] = o
+	}
+	return problems, nil
+}
+
+func setStr(dst *string, src *string) {
+	if src != nil {
+		*dst = *src
+	}
+}
+
+func setFloat(dst *float64, src *float64) {
+	if src != nil {
+		*dst = *src
+	}
+}
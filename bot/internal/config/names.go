@@ -0,0 +1,45 @@
+package config
+
+import (
+	"sort"
+	"sync"
+)
+
+// Name kinds whose valid values belong to other packages. Those packages
+// register them from init, so config imports none of them.
+const (
+	NamesExecAlgo = "exec_algo" // execution algorithms
+	NamesFactor   = "factor"    // factor_weights keys
+)
+
+var (
+	namesMu sync.RWMutex
+	names   = make(map[string]func() []string)
+)
+
+// RegisterNames makes Validate accept for kind only what list returns at
+// validation time. A kind nobody registered is not checked.
+func RegisterNames(kind string, list func() []string) {
+	namesMu.Lock()
+	defer namesMu.Unlock()
+	names[kind] = list
+}
+
+// knownName reports whether v is a registered name of kind, along with
+// the sorted names to suggest when it is not.
+func knownName(kind, v string) (bool, []string) {
+	namesMu.RLock()
+	list := names[kind]
+	namesMu.RUnlock()
+	if list == nil {
+		return true, nil
+	}
+	known := append([]string(nil), list()...)
+	sort.Strings(known)
+	for _, n := range known {
+		if n == v {
+			return true, known
+		}
+	}
+	return false, known
+}
@@ -0,0 +1,195 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// reloadable lists the fields a running bot can pick up without a restart.
+// Everything else (endpoints, credentials, trader mode, listeners, logging)
+// is refused on reload and keeps its startup value.
+var reloadable = map[string]bool{
+	"Symbols":             true,
+	"QueryInterval":       true,
+	"MetricsInterval":     true,
+	"ZThreshold":          true,
+	"FundingAbsMax":       true,
+	"SpreadMaxRatio":      true,
+	"BaseSize":            true,
+	"Cooldown":            true,
+	"HoldDuration":        true,
+	"MinSizeMap":          true,
+	"MaxNotionalUSD":      true,
+	"Leverage":            true,
+	"MarginMode":          true,
+	"ShutdownAction":      true,
+	"Overrides":           true,
+	"BasisEstimator":      true,
+	"BasisHalfLife":       true,
+	"BasisOutlierZ":       true,
+	"BasisWindow":         true,
+	"BasisStep":           true,
+	"BasisMaxGap":         true,
+	"SizingMethod":        true,
+	"RiskPerTrade":        true,
+	"EquityFraction":      true,
+	"VolHalfLife":         true,
+	"SizingEquity":        true,
+	"DepthLimit":          true,
+	"MaxSlippageBps":      true,
+	"StopLossBps":         true,
+	"TakeProfitBps":       true,
+	"LiquidityBps":        true,
+	"MaxBookShare":        true,
+	"MaxAdverseImbalance": true,
+	"FactorWeights":       true,
+	"FactorMinScore":      true,
+	"ExecAlgo":            true,
+	"ExecUrgentZ":         true,
+	"ExecUrgentAlgo":      true,
+}
+
+// Change is one field that differs between two configs.
+type Change struct {
+	Field string
+	Old   string
+	New   string
+	Safe  bool
+}
+
+// Merge returns cur with every reloadable field taken from next, plus the
+// full list of differences; changes with Safe=false were not applied.
+func Merge(cur, next Config) (Config, []Change) {
+	merged := cur
+	mv := reflect.ValueOf(&merged).Elem()
+	cv := reflect.ValueOf(cur)
+	nv := reflect.ValueOf(next)
+	t := cv.Type()
+	var changes []Change
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Name
+		a, b := cv.Field(i).Interface(), nv.Field(i).Interface()
+		if reflect.DeepEqual(a, b) {
+			continue
+		}
+		ch := Change{Field: name, Old: formatValue(a), New: formatValue(b), Safe: reloadable[name]}
+		if ch.Safe {
+			mv.Field(i).Set(nv.Field(i))
+		}
+		changes = append(changes, ch)
+	}
+	return merged, changes
+}
+
+// Dump writes every field as "Name = value", one per line. Secret fields
+// print as "***", so the output is safe to share.
+func (c Config) Dump(w io.Writer) {
+	v := reflect.ValueOf(c)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		fmt.Fprintf(w, "%s = %s\n", t.Field(i).Name, formatValue(v.Field(i).Interface()))
+	}
+}
+
+// formatValue renders v for a change log; Secret fields print as "***".
+func formatValue(v any) string {
+	switch x := v.(type) {
+	case []string:
+		return strings.Join(x, ",")
+	case map[string]float64:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = fmt.Sprintf("%s:%g", k, x[k])
+		}
+		return strings.Join(parts, ",")
+	case map[string]SymbolOverride:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = k + "{" + x[k].String() + "}"
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(v)
+}
+
+func (o SymbolOverride) String() string {
+	var parts []string
+	f := func(name string, p *float64) {
+		if p != nil {
+			parts = append(parts, fmt.Sprintf("%s=%g", name, *p))
+		}
+	}
+	d := func(name string, p *time.Duration) {
+		if p != nil {
+			parts = append(parts, name+"="+p.String())
+		}
+	}
+	f("z_threshold", o.ZThreshold)
+	f("spread_max_ratio", o.SpreadMaxRatio)
+	f("funding_abs_max", o.FundingAbsMax)
+	f("base_size", o.BaseSize)
+	d("cooldown", o.Cooldown)
+	d("hold_duration", o.HoldDuration)
+	f("max_notional_usd", o.MaxNotionalUSD)
+	f("max_slippage_bps", o.MaxSlippageBps)
+	f("stop_loss_bps", o.StopLossBps)
+	f("take_profit_bps", o.TakeProfitBps)
+	if o.BasisEstimator != nil {
+		parts = append(parts, "basis_estimator="+*o.BasisEstimator)
+	}
+	d("basis_half_life", o.BasisHalfLife)
+	f("basis_outlier_z", o.BasisOutlierZ)
+	d("basis_window", o.BasisWindow)
+	f("leverage", o.Leverage)
+	if o.MarginMode != nil {
+		parts = append(parts, "margin_mode="+*o.MarginMode)
+	}
+	if o.ExecAlgo != nil {
+		parts = append(parts, "exec_algo="+*o.ExecAlgo)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Watch polls path every interval and calls fn when its size or mtime
+// changes. It returns when ctx is done.
+func Watch(ctx context.Context, path string, interval time.Duration, fn func()) {
+	stat := func() (time.Time, int64) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, -1
+		}
+		return fi.ModTime(), fi.Size()
+	}
+	mt, sz := stat()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			m, s := stat()
+			if s < 0 || (m.Equal(mt) && s == sz) {
+				continue
+			}
+			mt, sz = m, s
+			fn()
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/weex/ai_trading/bot/internal/keystore"
+)
+
+// Secret holds a credential. It prints, marshals and %v-formats as "***"
+// so a Config can be logged or dumped as a whole; use Reveal where the
+// plain value is actually needed.
+type Secret string
+
+func (s Secret) Reveal() string { return string(s) }
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "***"
+}
+
+func (s Secret) GoString() string { return fmt.Sprintf("%q", s.String()) }
+
+func (s Secret) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+// Secrets returns every non-empty credential in c, for log redaction.
+func (c Config) Secrets() []string {
+	var out []string
+	for _, s := range []Secret{c.APIKey, c.APISecret, c.Passphrase, c.AdminToken} {
+		if s != "" {
+			out = append(out, s.Reveal())
+		}
+	}
+	return out
+}
+
+// readSecretFile reads a mounted secret (Docker/K8s style): the whole file,
+// surrounding whitespace trimmed.
+func readSecretFile(path string) (Secret, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	v := strings.TrimSpace(string(b))
+	if v == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return Secret(v), nil
+}
+
+// applyKeystore fills credentials still unset after file and env from the
+// encrypted keystore at c.Keystore. The passphrase comes from
+// WEEX_KEYSTORE_PASSPHRASE or the file named by WEEX_KEYSTORE_PASSPHRASE_FILE.
+func applyKeystore(c *Config) []string {
+	if c.Keystore == "" {
+		return nil
+	}
+	pass := os.Getenv("WEEX_KEYSTORE_PASSPHRASE")
+	if f := os.Getenv("WEEX_KEYSTORE_PASSPHRASE_FILE"); f != "" {
+		if pass != "" {
+			return []string{"set only one of WEEX_KEYSTORE_PASSPHRASE and WEEX_KEYSTORE_PASSPHRASE_FILE"}
+		}
+		s, err := readSecretFile(f)
+		if err != nil {
+			return []string{fmt.Sprintf("WEEX_KEYSTORE_PASSPHRASE_FILE: %v", err)}
+		}
+		pass = s.Reveal()
+	}
+	if pass == "" {
+		return []string{"keystore " + c.Keystore + " needs WEEX_KEYSTORE_PASSPHRASE or WEEX_KEYSTORE_PASSPHRASE_FILE"}
+	}
+	creds, err := keystore.ReadFile(c.Keystore, pass)
+	if err != nil {
+		return []string{fmt.Sprintf("keystore %s: %v", c.Keystore, err)}
+	}
+	fill := func(dst *Secret, v string) {
+		if *dst == "" {
+			*dst = Secret(v)
+		}
+	}
+	fill(&c.APIKey, creds.APIKey)
+	fill(&c.APISecret, creds.APISecret)
+	fill(&c.Passphrase, creds.Passphrase)
+	return nil
+}
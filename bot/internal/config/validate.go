@@ -0,0 +1,322 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// ValidationError lists every problem found while loading the config.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid config:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+func (c Config) Validate() error {
+	if p := c.problems(); len(p) > 0 {
+		return &ValidationError{Problems: p}
+	}
+	return nil
+}
+
+// ValidateParams applies the per-symbol rules of Validate alone, to the
+// global params and every symbol override, for params changed at runtime.
+func (c Config) ValidateParams() error {
+	ps := checkParams(c.ForSymbol(""))
+	for _, s := range c.Symbols {
+		ps = append(ps, c.overrideProblems(s)...)
+	}
+	if len(ps) > 0 {
+		return &ValidationError{Problems: ps}
+	}
+	return nil
+}
+
+func (c Config) problems() []string {
+	var ps []string
+	add := func(format string, args ...any) {
+		ps = append(ps, fmt.Sprintf(format, args...))
+	}
+
+	if u, err := url.Parse(c.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		add("base_url %q is not an absolute URL", c.BaseURL)
+	}
+	if len(c.Symbols) == 0 {
+		add("symbols: at least one symbol is required")
+	}
+	seen := make(map[string]bool, len(c.Symbols))
+	for _, s := range c.Symbols {
+		if seen[s] {
+			add("symbols: %s listed twice", s)
+		}
+		seen[s] = true
+	}
+	switch strings.ToLower(c.TraderMode) {
+	case "mock":
+	case "real":
+		if c.APIKey == "" || c.APISecret == "" || c.Passphrase == "" {
+			add("trader_mode real requires api key, secret and passphrase")
+		}
+	default:
+		add("trader_mode %q: want mock or real", c.TraderMode)
+	}
+	if c.QueryInterval <= 0 {
+		add("query_interval must be > 0")
+	}
+	if c.MetricsInterval <= 0 {
+		add("metrics_interval must be > 0")
+	}
+	ps = append(ps, checkParams(c.ForSymbol(""))...)
+	for sym, v := range c.MinSizeMap {
+		if v <= 0 {
+			add("min_size.%s must be > 0", sym)
+		}
+	}
+	if c.LogBufferSize <= 0 {
+		add("log_buffer_size must be > 0")
+	}
+	if o := strings.ToLower(c.LogOverflow); o != "block" && o != "drop" {
+		add("log_overflow %q: want block or drop", c.LogOverflow)
+	}
+	if l := strings.ToLower(c.LogLang); l != "en" && l != "zh" && l != "both" {
+		add("log_lang %q: want en, zh or both", c.LogLang)
+	}
+	if a := strings.ToLower(c.ShutdownAction); a != "none" && a != "cancel" && a != "flatten" {
+		add("shutdown_action %q: want none, cancel or flatten", c.ShutdownAction)
+	}
+	if c.ShutdownTimeout <= 0 {
+		add("shutdown_timeout must be > 0")
+	}
+	if c.StaleAfter <= 0 {
+		add("health_stale_after must be > 0")
+	}
+	if c.MaxDriftMs <= 0 {
+		add("health_max_drift_ms must be > 0")
+	}
+	if c.MaxRateUsage <= 0 || c.MaxRateUsage > 1 {
+		add("health_max_rate_usage must be in (0, 1]")
+	}
+	if c.WatchInterval < 0 {
+		add("config_watch_interval must be >= 0")
+	}
+	if c.HTTPRecord != "" && c.HTTPReplay != "" {
+		add("http_record and http_replay are mutually exclusive")
+	}
+	if c.TimeSync < 0 {
+		add("time_sync_interval must be >= 0")
+	}
+	if c.DriftAlertMs < 0 {
+		add("drift_alert_ms must be >= 0")
+	}
+	if c.DepthLimit < 1 || c.DepthLimit > 200 {
+		add("depth_limit must be in [1, 200]")
+	}
+	if c.LiquidityBps <= 0 {
+		add("liquidity_bps must be > 0")
+	}
+	if c.MaxBookShare <= 0 || c.MaxBookShare > 1 {
+		add("max_book_share must be in (0, 1]")
+	}
+	if c.MaxAdverseImbalance < 0 || c.MaxAdverseImbalance > 1 {
+		add("max_adverse_imbalance must be in [0, 1]")
+	}
+	switch c.SizingMethod {
+	case "fixed", "equity", "vol":
+	default:
+		add("sizing_method %q: want fixed, equity or vol", c.SizingMethod)
+	}
+	if c.RiskPerTrade <= 0 || c.RiskPerTrade > 1 {
+		add("risk_per_trade must be in (0, 1]")
+	}
+	if c.EquityFraction <= 0 || c.EquityFraction > 1 {
+		add("equity_fraction must be in (0, 1]")
+	}
+	if c.VolHalfLife <= 0 {
+		add("vol_half_life must be > 0")
+	}
+	if c.SizingEquity < 0 {
+		add("sizing_equity must be >= 0")
+	}
+	switch c.AccountSetup {
+	case "enforce", "check", "off":
+	default:
+		add("account_setup %q: want enforce, check or off", c.AccountSetup)
+	}
+	if c.ExecUrgentZ < 0 {
+		add("exec_urgent_z must be >= 0")
+	}
+	if ok, known := knownName(NamesExecAlgo, c.ExecUrgentAlgo); !ok {
+		add("exec_urgent_algo %q: want %s", c.ExecUrgentAlgo, strings.Join(known, ", "))
+	}
+	if c.ExecReprice <= 0 {
+		add("exec_reprice must be > 0")
+	}
+	if c.ExecTimeout < 0 {
+		add("exec_timeout must be >= 0")
+	}
+	if c.IcebergShow <= 0 || c.IcebergShow > 1 {
+		add("iceberg_show must be in (0, 1]")
+	}
+	if c.TWAPDuration <= 0 {
+		add("twap_duration must be > 0")
+	}
+	if c.TWAPSlices < 1 {
+		add("twap_slices must be >= 1")
+	}
+	fnames := make([]string, 0, len(c.FactorWeights))
+	for n := range c.FactorWeights {
+		fnames = append(fnames, n)
+	}
+	sort.Strings(fnames)
+	for _, n := range fnames {
+		if ok, known := knownName(NamesFactor, n); !ok {
+			add("factor_weights.%s: unknown factor (known: %s)", n, strings.Join(known, ", "))
+		}
+	}
+	if c.ClockSpeed <= 0 {
+		add("clock_speed must be > 0")
+	} else if c.ClockSpeed != 1 && strings.EqualFold(c.TraderMode, "real") && c.HTTPReplay == "" {
+		// cooldowns and holds would run on simulated time against a live account
+		add("clock_speed other than 1 needs trader_mode mock or http_replay")
+	}
+
+	syms := make([]string, 0, len(c.Overrides))
+	for s := range c.Overrides {
+		syms = append(syms, s)
+	}
+	sort.Strings(syms)
+	for _, s := range syms {
+		if !seen[s] {
+			add("symbol_overrides.%s: symbol is not in symbols", s)
+			continue
+		}
+		ps = append(ps, c.overrideProblems(s)...)
+	}
+	return ps
+}
+
+// overrideProblems checks the effective params of symbol, reporting only
+// fields its override sets; the globals are checked on their own.
+func (c Config) overrideProblems(symbol string) []string {
+	o, ok := c.Overrides[symbol]
+	if !ok {
+		return nil
+	}
+	var ps []string
+	for _, msg := range checkParams(c.ForSymbol(symbol)) {
+		if o.sets(strings.Fields(msg)[0]) {
+			ps = append(ps, fmt.Sprintf("symbol_overrides.%s.%s", symbol, msg))
+		}
+	}
+	return ps
+}
+
+func checkParams(p SymbolParams) []string {
+	var ps []string
+	if p.ZThreshold <= 0 {
+		ps = append(ps, "z_threshold must be > 0")
+	}
+	if p.SpreadMaxRatio <= 0 {
+		ps = append(ps, "spread_max_ratio must be > 0")
+	}
+	if p.FundingAbsMax < 0 {
+		ps = append(ps, "funding_abs_max must be >= 0")
+	}
+	if p.BaseSize <= 0 {
+		ps = append(ps, "base_size must be > 0")
+	}
+	if p.Cooldown < 0 {
+		ps = append(ps, "cooldown must be >= 0")
+	}
+	if p.HoldDuration <= 0 {
+		ps = append(ps, "hold_duration must be > 0")
+	}
+	if p.MaxNotionalUSD <= 0 {
+		ps = append(ps, "max_notional_usd must be > 0")
+	}
+	if p.MaxSlippageBps <= 0 {
+		ps = append(ps, "max_slippage_bps must be > 0")
+	}
+	if p.StopLossBps < 0 || p.StopLossBps >= 10000 {
+		ps = append(ps, "stop_loss_bps must be in [0, 10000)")
+	}
+	if p.TakeProfitBps < 0 {
+		ps = append(ps, "take_profit_bps must be >= 0")
+	}
+	switch p.BasisEstimator {
+	case "window", "ewma", "robust":
+	default:
+		ps = append(ps, fmt.Sprintf("basis_estimator %q: want window, ewma or robust", p.BasisEstimator))
+	}
+	if p.BasisHalfLife <= 0 {
+		ps = append(ps, "basis_half_life must be > 0")
+	}
+	if p.BasisOutlierZ < 0 {
+		ps = append(ps, "basis_outlier_z must be >= 0")
+	}
+	// bound the slot buffer: 1e5 slots of float64 per symbol
+	if p.BasisStep <= 0 {
+		ps = append(ps, "basis_step must be > 0")
+	} else if p.BasisWindow < 2*p.BasisStep || p.BasisWindow/p.BasisStep > 100000 {
+		ps = append(ps, "basis_window must be between 2 and 100000 basis_step")
+	}
+	if p.BasisMaxGap < 0 {
+		ps = append(ps, "basis_max_gap must be >= 0")
+	}
+	if p.Leverage < 1 || p.Leverage > 125 {
+		ps = append(ps, "leverage must be in [1, 125]")
+	}
+	switch p.MarginMode {
+	case "cross", "isolated":
+	default:
+		ps = append(ps, fmt.Sprintf("margin_mode %q: want cross or isolated", p.MarginMode))
+	}
+	if ok, known := knownName(NamesExecAlgo, p.ExecAlgo); !ok {
+		ps = append(ps, fmt.Sprintf("exec_algo %q: want %s", p.ExecAlgo, strings.Join(known, ", ")))
+	}
+	return ps
+}
+
+func (o SymbolOverride) sets(field string) bool {
+	switch field {
+	case "z_threshold":
+		return o.ZThreshold != nil
+	case "spread_max_ratio":
+		return o.SpreadMaxRatio != nil
+	case "funding_abs_max":
+		return o.FundingAbsMax != nil
+	case "base_size":
+		return o.BaseSize != nil
+	case "cooldown":
+		return o.Cooldown != nil
+	case "hold_duration":
+		return o.HoldDuration != nil
+	case "max_notional_usd":
+		return o.MaxNotionalUSD != nil
+	case "max_slippage_bps":
+		return o.MaxSlippageBps != nil
+	case "stop_loss_bps":
+		return o.StopLossBps != nil
+	case "take_profit_bps":
+		return o.TakeProfitBps != nil
+	case "basis_estimator":
+		return o.BasisEstimator != nil
+	case "basis_half_life":
+		return o.BasisHalfLife != nil
+	case "basis_outlier_z":
+		return o.BasisOutlierZ != nil
+	case "basis_window":
+		return o.BasisWindow != nil
+	case "leverage":
+		return o.Leverage != nil
+	case "margin_mode":
+		return o.MarginMode != nil
+	case "exec_algo":
+		return o.ExecAlgo != nil
+	}
+	return false
+}
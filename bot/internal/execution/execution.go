@@ -0,0 +1,634 @@
+// Package execution works a parent order through child orders on a Venue
+// with one of several algorithms and aggregates their fills into one
+// result.
+package execution
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/weex/ai_trading/bot/internal/clock"
+	"github.com/weex/ai_trading/bot/internal/config"
+	"github.com/weex/ai_trading/bot/internal/logger"
+)
+
+// Algorithms.
+const (
+	Limit           = "limit"             // one limit order at the given price, rested until the timeout
+	Market          = "market"            // one market order
+	PostOnly        = "post_only"         // join the touch, repriced as it moves
+	Iceberg         = "iceberg"           // show a slice at a time at the given price
+	TWAP            = "twap"              // equal slices at the touch over a duration
+	LimitThenMarket = "limit_then_market" // limit, then market for the rest after a timeout
+)
+
+// Algos lists the valid algorithm names.
+var Algos = []string{Limit, Market, PostOnly, Iceberg, TWAP, LimitThenMarket}
+
+func init() {
+	config.RegisterNames(config.NamesExecAlgo, func() []string { return Algos })
+}
+
+// Taker reports whether algo may cross the spread, so fees should be
+// assumed at the taker rate.
+func Taker(algo string) bool {
+	return algo == Market || algo == TWAP || algo == LimitThenMarket
+}
+
+// Venue is what the algorithms need from an exchange.
+type Venue interface {
+	Place(ctx context.Context, c ChildReq) (string, error)
+	Cancel(ctx context.Context, symbol, id string) error
+	Status(ctx context.Context, id string) (Fill, error)
+	Top(ctx context.Context, symbol string) (bid, ask float64, err error)
+}
+
+type ChildReq struct {
+	Symbol   string
+	Buy      bool
+	Size     float64
+	Price    float64 // 0 for a market order
+	PostOnly bool
+}
+
+// Fill is the state of one child order on the venue.
+type Fill struct {
+	Filled   float64
+	AvgPrice float64
+	Done     bool
+}
+
+type Params struct {
+	Algo string
+	// Price is the limit price of limit, iceberg and limit_then_market; 0
+	// means the touch.
+	Price float64
+	// Poll is how often working children are checked, and how often
+	// post_only compares its price with the touch.
+	Poll time.Duration
+	// Timeout ends limit, post_only and iceberg, bounds each market child
+	// and sends limit_then_market to market; 0 means none.
+	Timeout  time.Duration
+	Show     float64 // iceberg: visible share of the size
+	Duration time.Duration
+	Slices   int
+	Step     float64 // size increment; 0 means none
+	Tick     float64 // price increment; 0 means none
+}
+
+type Child struct {
+	ID       string
+	Price    float64 // 0 for market
+	Size     float64
+	Filled   float64
+	AvgPrice float64
+	PostOnly bool
+	Done     bool
+}
+
+// Result is a parent order's state; Status is working, filled, partial,
+// unfilled or error.
+type Result struct {
+	ID       string
+	Symbol   string
+	Algo     string
+	Buy      bool
+	Size     float64
+	Filled   float64
+	AvgPrice float64
+	// Arrival is the mid when the parent started, the benchmark for
+	// slippage.
+	Arrival  float64
+	Children int
+	Status   string
+	Err      error
+	Started  time.Time
+	Finished time.Time
+}
+
+// SlippageBps is the average fill against the arrival mid, positive when
+// worse for the side.
+func (r Result) SlippageBps() float64 {
+	if r.Arrival <= 0 || r.AvgPrice <= 0 {
+		return 0
+	}
+	s := (r.AvgPrice - r.Arrival) / r.Arrival * 1e4
+	if !r.Buy {
+		s = -s
+	}
+	return s
+}
+
+type Parent struct {
+	mu       sync.Mutex
+	res      Result
+	prm      Params
+	children []Child
+	cancel   context.CancelFunc
+	working  chan struct{}
+	once     sync.Once
+	done     chan struct{}
+}
+
+// Working is closed once the first child is on the venue or the parent
+// has finished, whichever comes first.
+func (p *Parent) Working() <-chan struct{} { return p.working }
+
+func (p *Parent) markWorking() { p.once.Do(func() { close(p.working) }) }
+
+// Done is closed when the parent has finished and no child is working.
+func (p *Parent) Done() <-chan struct{} { return p.done }
+
+// Cancel stops the algorithm; working children are cancelled before Done
+// closes.
+func (p *Parent) Cancel() { p.cancel() }
+
+func (p *Parent) Result() Result {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r := p.res
+	r.Children = len(p.children)
+	var notional float64
+	for _, c := range p.children {
+		r.Filled += c.Filled
+		notional += c.Filled * c.AvgPrice
+	}
+	if r.Filled > 0 {
+		r.AvgPrice = notional / r.Filled
+	}
+	return r
+}
+
+func (p *Parent) Children() []Child {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Child(nil), p.children...)
+}
+
+type Executor struct {
+	Venue Venue
+	Clock clock.Clock
+	Log   *logger.Logger
+}
+
+// Start works size of symbol with prm.Algo in the background and returns
+// at once.
+func (x *Executor) Start(id, symbol string, buy bool, size float64, prm Params) *Parent {
+	ctx, cancel := context.WithCancel(context.Background())
+	clk := clock.Or(x.Clock)
+	p := &Parent{
+		res:     Result{ID: id, Symbol: symbol, Algo: prm.Algo, Buy: buy, Size: size, Status: "working", Started: clk.Now()},
+		prm:     prm,
+		cancel:  cancel,
+		working: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if p.prm.Poll <= 0 {
+		p.prm.Poll = time.Second
+	}
+	r := &run{x: x, p: p, clk: clk}
+	if bid, ask, err := x.Venue.Top(ctx, symbol); err == nil && bid > 0 && ask > 0 {
+		p.res.Arrival = (bid + ask) / 2
+	}
+	go r.work(ctx)
+	return p
+}
+
+// errGiveUp ends an algorithm after repeated placement failures.
+var errGiveUp = errors.New("child orders keep failing")
+
+// maxPlaceErrors is how many placements in a row may fail before the
+// parent gives up.
+const maxPlaceErrors = 3
+
+// errNoProgress ends a market sweep whose children keep finishing, or
+// timing out, without a fill.
+var errNoProgress = errors.New("market orders keep finishing unfilled")
+
+// maxMarketTries is how many market children in a row may end without a
+// fill before the parent gives up.
+const maxMarketTries = 3
+
+// errCancelFailed ends an algorithm whose child could not be cancelled
+// and may still fill; placing another child could overfill the parent.
+var errCancelFailed = errors.New("child order could not be cancelled")
+
+// maxCancelTries is how many times a child is cancelled, Poll apart,
+// before the parent gives up on it.
+const maxCancelTries = 3
+
+type run struct {
+	x      *Executor
+	p      *Parent
+	clk    clock.Clock
+	errRun int
+}
+
+func (r *run) work(ctx context.Context) {
+	var err error
+	switch r.p.prm.Algo {
+	case Market:
+		err = r.market(ctx)
+	case PostOnly:
+		err = r.postOnly(ctx)
+	case Iceberg:
+		err = r.iceberg(ctx)
+	case TWAP:
+		err = r.twap(ctx)
+	case LimitThenMarket:
+		err = r.limitThenMarket(ctx)
+	default:
+		err = r.limit(ctx)
+	}
+	r.p.mu.Lock()
+	r.p.res.Finished = r.clk.Now()
+	r.p.res.Err = err
+	r.p.mu.Unlock()
+	res := r.p.Result()
+	switch {
+	case res.Filled >= res.Size-r.half():
+		res.Status = "filled"
+	case res.Filled > 0:
+		res.Status = "partial"
+	case err != nil:
+		res.Status = "error"
+	default:
+		res.Status = "unfilled"
+	}
+	r.p.mu.Lock()
+	r.p.res.Status = res.Status
+	r.p.mu.Unlock()
+	kv := []string{logger.KOrderID, res.ID, logger.KSymbol, res.Symbol, logger.KAlgo, res.Algo, logger.KResult, res.Status,
+		logger.KSize, fmtF(res.Size), logger.KFilled, fmtF(res.Filled), logger.KAvgPrice, fmtF(res.AvgPrice),
+		logger.KArrival, fmtF(res.Arrival), logger.KSlippageBps, strconv.FormatFloat(res.SlippageBps(), 'f', 2, 64),
+		logger.KChildren, strconv.Itoa(res.Children), logger.KElapsed, res.Finished.Sub(res.Started).String()}
+	if err != nil {
+		kv = append(kv, logger.KErr, err.Error())
+	}
+	r.x.Log.Trade(logger.EvExecDone, kv...)
+	r.p.markWorking()
+	close(r.p.done)
+}
+
+func (r *run) half() float64 { return r.p.prm.Step / 2 }
+
+// remaining is the size still to fill, rounded down to the step.
+func (r *run) remaining() float64 {
+	res := r.p.Result()
+	return r.roundSize(res.Size - res.Filled)
+}
+
+func (r *run) roundSize(v float64) float64 {
+	if s := r.p.prm.Step; s > 0 {
+		return math.Floor(v/s+1e-9) * s
+	}
+	return v
+}
+
+// passive rounds a price away from the spread: down for buys, up for
+// sells.
+func (r *run) passive(px float64) float64 {
+	t := r.p.prm.Tick
+	if t <= 0 {
+		return px
+	}
+	if r.p.res.Buy {
+		return math.Floor(px/t+1e-9) * t
+	}
+	return math.Ceil(px/t-1e-9) * t
+}
+
+// touch is the best price on the order's own side.
+func (r *run) touch(ctx context.Context) (float64, error) {
+	bid, ask, err := r.x.Venue.Top(ctx, r.p.res.Symbol)
+	if err != nil {
+		return 0, err
+	}
+	if r.p.res.Buy {
+		return bid, nil
+	}
+	return ask, nil
+}
+
+// limitPrice is prm.Price, or the touch when unset.
+func (r *run) limitPrice(ctx context.Context) (float64, error) {
+	if r.p.prm.Price > 0 {
+		return r.passive(r.p.prm.Price), nil
+	}
+	px, err := r.touch(ctx)
+	return r.passive(px), err
+}
+
+// place sends one child. A failure is logged and counted; after
+// maxPlaceErrors in a row it returns errGiveUp.
+func (r *run) place(ctx context.Context, px, size float64, postOnly bool) (string, error) {
+	req := ChildReq{Symbol: r.p.res.Symbol, Buy: r.p.res.Buy, Size: size, Price: px, PostOnly: postOnly}
+	id, err := r.x.Venue.Place(ctx, req)
+	kv := []string{logger.KOrderID, r.p.res.ID, logger.KSymbol, r.p.res.Symbol, logger.KAlgo, r.p.prm.Algo, logger.KPrice, fmtF(px), logger.KSize, fmtF(size)}
+	if err != nil {
+		r.x.Log.Error(logger.EvExecChild, append(kv, logger.KAction, "place", logger.KErr, err.Error())...)
+		if r.errRun++; r.errRun >= maxPlaceErrors {
+			return "", errGiveUp
+		}
+		return "", nil
+	}
+	r.errRun = 0
+	r.p.mu.Lock()
+	r.p.children = append(r.p.children, Child{ID: id, Price: px, Size: size, PostOnly: postOnly})
+	r.p.mu.Unlock()
+	r.p.markWorking()
+	r.x.Log.Trade(logger.EvExecChild, append(kv, logger.KAction, "placed", logger.KChildID, id)...)
+	return id, nil
+}
+
+func (r *run) record(id string, f Fill) {
+	r.p.mu.Lock()
+	defer r.p.mu.Unlock()
+	for i := range r.p.children {
+		if c := &r.p.children[i]; c.ID == id {
+			c.Filled, c.AvgPrice, c.Done = f.Filled, f.AvgPrice, f.Done
+		}
+	}
+}
+
+// await polls child id until it is done, ctx ends or deadline passes
+// (zero: none), cancelling it in the latter two cases. ok is true when
+// the child finished on its own; err is errCancelFailed when it could not
+// be cancelled.
+func (r *run) await(ctx context.Context, id string, deadline time.Time, stop func() bool) (ok bool, err error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return false, r.cancel(id)
+		case <-r.clk.After(r.p.prm.Poll):
+		}
+		if f, err := r.x.Venue.Status(ctx, id); err == nil {
+			r.record(id, f)
+			if f.Done {
+				return true, nil
+			}
+		}
+		if (!deadline.IsZero() && !r.clk.Now().Before(deadline)) || (stop != nil && stop()) {
+			return false, r.cancel(id)
+		}
+	}
+}
+
+// cancel cancels child id and records its final fill. The child counts as
+// done only once the venue accepted the cancel or reports it done; after
+// maxCancelTries it is left working and errCancelFailed returned. It uses
+// its own context so it still runs once the parent is cancelled.
+func (r *run) cancel(id string) error {
+	ctx, done := context.WithTimeout(context.Background(), 10*time.Second)
+	defer done()
+	kv := []string{logger.KOrderID, r.p.res.ID, logger.KSymbol, r.p.res.Symbol, logger.KChildID, id}
+	for try := 1; ; try++ {
+		cerr := r.x.Venue.Cancel(ctx, r.p.res.Symbol, id)
+		if cerr != nil {
+			r.x.Log.Error(logger.EvExecChild, append(kv, logger.KAction, "cancel", logger.KErr, cerr.Error())...)
+		} else {
+			r.x.Log.Trade(logger.EvExecChild, append(kv, logger.KAction, "cancelled")...)
+		}
+		// a cancel can race a fill; the venue's final state is what counts
+		f, serr := r.x.Venue.Status(ctx, id)
+		if serr == nil {
+			if cerr == nil {
+				f.Done = true
+			}
+			r.record(id, f)
+			if f.Done {
+				return nil
+			}
+		}
+		if try >= maxCancelTries {
+			return fmt.Errorf("%w: child %s", errCancelFailed, id)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: child %s", errCancelFailed, id)
+		case <-r.clk.After(r.p.prm.Poll):
+		}
+	}
+}
+
+func (r *run) sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-r.clk.After(d):
+		return true
+	}
+}
+
+// limit rests one limit order until it fills or Timeout passes. A
+// rejected placement is retried every Poll within the timeout.
+func (r *run) limit(ctx context.Context) error {
+	px, err := r.limitPrice(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = r.rest(ctx, px)
+	return err
+}
+
+// rest places a limit child at px for what is left, retrying rejected
+// placements every Poll, and awaits it until Timeout. filled reports that
+// nothing is left.
+func (r *run) rest(ctx context.Context, px float64) (filled bool, err error) {
+	for rem := r.remaining(); rem > 0 && ctx.Err() == nil && !r.expired(); rem = r.remaining() {
+		id, err := r.place(ctx, px, rem, false)
+		if err != nil {
+			return false, err
+		}
+		if id == "" {
+			if !r.sleep(ctx, r.p.prm.Poll) {
+				return false, nil
+			}
+			continue
+		}
+		ok, err := r.await(ctx, id, r.deadline(), nil)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			break
+		}
+	}
+	return r.remaining() <= 0, nil
+}
+
+// market takes what is left with market children, each awaited for at
+// most Timeout. It gives up after maxMarketTries children in a row end
+// without a fill.
+func (r *run) market(ctx context.Context) error {
+	tries := 0
+	for rem := r.remaining(); rem > 0 && ctx.Err() == nil; rem = r.remaining() {
+		id, err := r.place(ctx, 0, rem, false)
+		if err != nil {
+			return err
+		}
+		if id == "" {
+			if !r.sleep(ctx, r.p.prm.Poll) {
+				return nil
+			}
+			continue
+		}
+		before := r.p.Result().Filled
+		if _, err := r.await(ctx, id, r.childDeadline(), nil); err != nil {
+			return err
+		}
+		if r.p.Result().Filled > before {
+			tries = 0
+			continue
+		}
+		if tries++; tries >= maxMarketTries {
+			return errNoProgress
+		}
+	}
+	return nil
+}
+
+// childDeadline is Timeout from now, or zero without a Timeout.
+func (r *run) childDeadline() time.Time {
+	if r.p.prm.Timeout <= 0 {
+		return time.Time{}
+	}
+	return r.clk.Now().Add(r.p.prm.Timeout)
+}
+
+func (r *run) deadline() time.Time {
+	if r.p.prm.Timeout <= 0 {
+		return time.Time{}
+	}
+	return r.p.res.Started.Add(r.p.prm.Timeout)
+}
+
+func (r *run) expired() bool {
+	d := r.deadline()
+	return !d.IsZero() && !r.clk.Now().Before(d)
+}
+
+// postOnly joins the touch with a maker-only order and, whenever the
+// touch moves off its price, cancels and rejoins with what is left.
+func (r *run) postOnly(ctx context.Context) error {
+	for rem := r.remaining(); rem > 0 && ctx.Err() == nil && !r.expired(); rem = r.remaining() {
+		px, err := r.touch(ctx)
+		if err != nil || px <= 0 {
+			if !r.sleep(ctx, r.p.prm.Poll) {
+				return nil
+			}
+			continue
+		}
+		px = r.passive(px)
+		id, err := r.place(ctx, px, rem, true)
+		if err != nil {
+			return err
+		}
+		if id == "" {
+			// rejected, e.g. the book moved through the price
+			if !r.sleep(ctx, r.p.prm.Poll) {
+				return nil
+			}
+			continue
+		}
+		moved := func() bool {
+			t, err := r.touch(ctx)
+			return err == nil && t > 0 && r.passive(t) != px
+		}
+		if _, err := r.await(ctx, id, r.deadline(), moved); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// iceberg shows at most Show of the size at a time, replacing each slice
+// as it fills.
+func (r *run) iceberg(ctx context.Context) error {
+	px, err := r.limitPrice(ctx)
+	if err != nil {
+		return err
+	}
+	show := r.roundSize(r.p.res.Size * r.p.prm.Show)
+	if show <= 0 {
+		show = r.p.res.Size
+		if r.p.prm.Step > 0 {
+			show = r.p.prm.Step
+		}
+	}
+	for rem := r.remaining(); rem > 0 && ctx.Err() == nil && !r.expired(); rem = r.remaining() {
+		id, err := r.place(ctx, px, math.Min(show, rem), false)
+		if err != nil {
+			return err
+		}
+		if id == "" {
+			if !r.sleep(ctx, r.p.prm.Poll) {
+				return nil
+			}
+			continue
+		}
+		if ok, err := r.await(ctx, id, r.deadline(), nil); !ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// twap splits the size into Slices equal parts over Duration. Each slice
+// rests at the touch until the next one is due, when whatever it left is
+// rolled into that slice; after the last slice the rest goes at market.
+func (r *run) twap(ctx context.Context) error {
+	n := r.p.prm.Slices
+	if n < 1 {
+		n = 1
+	}
+	interval := r.p.prm.Duration / time.Duration(n)
+	start := r.p.res.Started
+	for i := 1; i <= n && ctx.Err() == nil; i++ {
+		res := r.p.Result()
+		slice := r.roundSize(res.Size*float64(i)/float64(n) - res.Filled)
+		due := start.Add(time.Duration(i) * interval)
+		if slice > 0 {
+			px, err := r.touch(ctx)
+			if err == nil && px > 0 {
+				id, err := r.place(ctx, r.passive(px), slice, false)
+				if err != nil {
+					return err
+				}
+				if id != "" {
+					if _, err := r.await(ctx, id, due, nil); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		if d := due.Sub(r.clk.Now()); d > 0 && !r.sleep(ctx, d) {
+			return nil
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return r.market(ctx)
+}
+
+// limitThenMarket rests a limit until Timeout, retrying rejected
+// placements, then takes the rest.
+func (r *run) limitThenMarket(ctx context.Context) error {
+	px, err := r.limitPrice(ctx)
+	if err != nil {
+		return err
+	}
+	filled, err := r.rest(ctx, px)
+	if err != nil || filled || ctx.Err() != nil {
+		return err
+	}
+	return r.market(ctx)
+}
+
+func fmtF(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
@@ -0,0 +1,158 @@
+package execution
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/weex/ai_trading/bot/internal/logger"
+)
+
+// venue is a scripted Venue: the first reject placements fail, limit
+// children fill only when fillLimit is set and market children fill only
+// when fillMarket is set. A child that does not fill stays open until
+// cancelled; the first failCancel cancels fail.
+type venue struct {
+	mu         sync.Mutex
+	reject     int
+	failCancel int
+	fillLimit  bool
+	fillMarket bool
+	seq        int
+	children   map[string]*venueChild
+	placed     []ChildReq
+}
+
+type venueChild struct {
+	req  ChildReq
+	fill Fill
+}
+
+func (v *venue) Place(_ context.Context, c ChildReq) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.reject > 0 {
+		v.reject--
+		return "", errors.New("rejected")
+	}
+	v.seq++
+	id := strconv.Itoa(v.seq)
+	ch := &venueChild{req: c}
+	if (c.Price > 0 && v.fillLimit) || (c.Price == 0 && v.fillMarket) {
+		ch.fill = Fill{Filled: c.Size, AvgPrice: 100, Done: true}
+	}
+	v.children[id] = ch
+	v.placed = append(v.placed, c)
+	return id, nil
+}
+
+func (v *venue) Cancel(_ context.Context, _, id string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.failCancel > 0 {
+		v.failCancel--
+		return errors.New("cancel failed")
+	}
+	v.children[id].fill.Done = true
+	return nil
+}
+
+func (v *venue) Status(_ context.Context, id string) (Fill, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.children[id].fill, nil
+}
+
+func (v *venue) Top(context.Context, string) (float64, float64, error) { return 99.9, 100.1, nil }
+
+func (v *venue) Placed() []ChildReq {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return append([]ChildReq(nil), v.placed...)
+}
+
+func start(t *testing.T, v *venue, algo string) Result {
+	t.Helper()
+	v.children = make(map[string]*venueChild)
+	log := logger.New(logger.Config{Dir: t.TempDir()})
+	t.Cleanup(log.Close)
+	x := &Executor{Venue: v, Log: log}
+	p := x.Start("p1", "cmt_btcusdt", true, 1, Params{Algo: algo, Price: 99.9, Poll: time.Millisecond, Timeout: 50 * time.Millisecond})
+	select {
+	case <-p.Done():
+	case <-time.After(5 * time.Second):
+		p.Cancel()
+		t.Fatalf("%s parent still working", algo)
+	}
+	return p.Result()
+}
+
+func TestLimitEndsAtTimeout(t *testing.T) {
+	v := &venue{}
+	r := start(t, v, Limit)
+	if r.Status != "unfilled" || len(v.Placed()) != 1 {
+		t.Fatalf("status %s after %d children, want unfilled after 1", r.Status, len(v.Placed()))
+	}
+}
+
+func TestLimitRetriesRejectedPlacement(t *testing.T) {
+	v := &venue{reject: 2, fillLimit: true}
+	r := start(t, v, Limit)
+	if r.Status != "filled" {
+		t.Fatalf("status %s, want filled (err %v)", r.Status, r.Err)
+	}
+}
+
+func TestLimitThenMarketRetriesLimitFirst(t *testing.T) {
+	v := &venue{reject: 2, fillLimit: true, fillMarket: true}
+	r := start(t, v, LimitThenMarket)
+	if r.Status != "filled" {
+		t.Fatalf("status %s, want filled (err %v)", r.Status, r.Err)
+	}
+	for _, c := range v.Placed() {
+		if c.Price == 0 {
+			t.Fatalf("children %+v: went to market while the limit could still be placed", v.Placed())
+		}
+	}
+}
+
+func TestLimitThenMarketTakesRestAfterTimeout(t *testing.T) {
+	v := &venue{fillMarket: true}
+	r := start(t, v, LimitThenMarket)
+	placed := v.Placed()
+	if r.Status != "filled" || len(placed) != 2 || placed[0].Price == 0 || placed[1].Price != 0 {
+		t.Fatalf("status %s children %+v, want a limit then a market fill", r.Status, placed)
+	}
+}
+
+func TestMarketGivesUpWithoutFills(t *testing.T) {
+	v := &venue{}
+	r := start(t, v, Market)
+	if !errors.Is(r.Err, errNoProgress) || len(v.Placed()) != maxMarketTries {
+		t.Fatalf("err %v after %d children, want errNoProgress after %d", r.Err, len(v.Placed()), maxMarketTries)
+	}
+}
+
+func TestCancelFailureStopsBeforeNextChild(t *testing.T) {
+	tests := []struct {
+		name       string
+		failCancel int
+		wantErr    error
+		children   int
+	}{
+		{"retried cancel", maxCancelTries - 1, nil, 2},
+		{"child never cancelled", maxCancelTries, errCancelFailed, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &venue{failCancel: tt.failCancel, fillMarket: true}
+			r := start(t, v, LimitThenMarket)
+			if !errors.Is(r.Err, tt.wantErr) || len(v.Placed()) != tt.children {
+				t.Fatalf("err %v after %d children, want %v after %d", r.Err, len(v.Placed()), tt.wantErr, tt.children)
+			}
+		})
+	}
+}
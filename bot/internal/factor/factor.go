@@ -0,0 +1,164 @@
+// Package factor holds the named signal factors computed on each tick and
+// the weighted score that gates entries. Packages may Register their own
+// factors from init; names are then usable in factor_weights.
+package factor
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/weex/ai_trading/bot/internal/book"
+	"github.com/weex/ai_trading/bot/internal/config"
+)
+
+// Input is one tick's market data. Ticker fields the exchange did not
+// report are NaN.
+type Input struct {
+	Book           book.Book
+	BandBps        float64 // band around the mid for book factors
+	Last           float64
+	Volume24h      float64
+	PriceChange24h float64
+	Z              float64
+	FundingRate    float64
+}
+
+type Factor interface {
+	Name() string
+	// Directional factors are positive when they favour a long; the score
+	// flips their sign for shorts.
+	Directional() bool
+	// Compute returns the factor value, or false when the input lacks the
+	// data for it.
+	Compute(in Input) (float64, bool)
+}
+
+// Func adapts a function to Factor.
+type Func struct {
+	ID  string
+	Dir bool
+	Fn  func(Input) (float64, bool)
+}
+
+func (f Func) Name() string                     { return f.ID }
+func (f Func) Directional() bool                { return f.Dir }
+func (f Func) Compute(in Input) (float64, bool) { return f.Fn(in) }
+
+var (
+	mu       sync.RWMutex
+	registry = make(map[string]Factor)
+)
+
+// Register adds f; a duplicate name panics.
+func Register(f Factor) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := registry[f.Name()]; ok {
+		panic(fmt.Sprintf("factor: %q registered twice", f.Name()))
+	}
+	registry[f.Name()] = f
+}
+
+func Lookup(name string) (Factor, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	f, ok := registry[name]
+	return f, ok
+}
+
+// Names lists registered factors in sorted order.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	out := make([]string, 0, len(registry))
+	for n := range registry {
+		out = append(out, n)
+	}
+	sort.Strings(out)
+	return out
+}
+
+type Value struct {
+	Name        string
+	Value       float64
+	Directional bool
+}
+
+// Compute evaluates every registered factor, skipping those without data.
+func Compute(in Input) []Value {
+	var out []Value
+	for _, n := range Names() {
+		f, _ := Lookup(n)
+		if v, ok := f.Compute(in); ok && !math.IsNaN(v) && !math.IsInf(v, 0) {
+			out = append(out, Value{Name: n, Value: v, Directional: f.Directional()})
+		}
+	}
+	return out
+}
+
+// Score is the weighted sum of vals for an entry on the given side.
+// Factors without a weight, or missing from vals, contribute nothing.
+func Score(vals []Value, weights map[string]float64, long bool) float64 {
+	var s float64
+	for _, v := range vals {
+		w := weights[v.Name]
+		if w == 0 {
+			continue
+		}
+		x := v.Value
+		if v.Directional && !long {
+			x = -x
+		}
+		s += w * x
+	}
+	return s
+}
+
+func init() {
+	for _, f := range builtins {
+		Register(f)
+	}
+	config.RegisterNames(config.NamesFactor, Names)
+}
+
+var builtins = []Factor{
+	// bid minus ask size within the band, over their sum
+	Func{ID: "imbalance", Dir: true, Fn: func(in Input) (float64, bool) {
+		return in.Book.Imbalance(in.BandBps), in.Book.Mid() > 0
+	}},
+	// size-weighted top-of-book price vs mid, in bps; leans toward the
+	// side the thinner queue is on
+	Func{ID: "microprice_bps", Dir: true, Fn: func(in Input) (float64, bool) {
+		mid := in.Book.Mid()
+		if mid == 0 {
+			return 0, false
+		}
+		a, b := in.Book.Asks[0], in.Book.Bids[0]
+		micro := (a.Price*b.Size + b.Price*a.Size) / (a.Size + b.Size)
+		return (micro - mid) / mid * 1e4, true
+	}},
+	Func{ID: "spread_bps", Fn: func(in Input) (float64, bool) {
+		mid := in.Book.Mid()
+		if mid == 0 {
+			return 0, false
+		}
+		return (in.Book.Asks[0].Price - in.Book.Bids[0].Price) / mid * 1e4, true
+	}},
+	// log10 so one weight covers symbols whose volumes differ by orders of
+	// magnitude
+	Func{ID: "volume_24h", Fn: func(in Input) (float64, bool) {
+		return math.Log10(1 + in.Volume24h), !math.IsNaN(in.Volume24h) && in.Volume24h >= 0
+	}},
+	Func{ID: "price_change_24h", Dir: true, Fn: func(in Input) (float64, bool) {
+		return in.PriceChange24h, !math.IsNaN(in.PriceChange24h)
+	}},
+	Func{ID: "abs_z", Fn: func(in Input) (float64, bool) {
+		return math.Abs(in.Z), true
+	}},
+	// funding received by a long: positive when longs are paid
+	Func{ID: "funding_carry", Dir: true, Fn: func(in Input) (float64, bool) {
+		return 0 - in.FundingRate, true // 0 - keeps zero unsigned
+	}},
+}
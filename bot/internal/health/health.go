@@ -0,0 +1,208 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	Symbols []string
+	// StaleAfter is how old a symbol's last successful tick may be before the
+	// bot is considered not ready; the loop heartbeat uses the same limit.
+	StaleAfter time.Duration
+	MaxDriftMs int64
+	// MaxRateUsage is the rate-limit window share (0..1) above which the bot
+	// reports not ready.
+	MaxRateUsage float64
+	// RequirePrivate makes an unreachable private API fail readiness; mock
+	// trading does not need it.
+	RequirePrivate bool
+
+	Drift     func() int64
+	Private   func() (at time.Time, err error)
+	RateUsage func() map[string]float64
+}
+
+// RiskState is published by the engine after every tick.
+type RiskState struct {
+	OpenPositions int     `json:"open_positions"`
+	RealizedPnL   float64 `json:"realized_pnl"`
+	Halted        bool    `json:"halted"`
+	HaltReason    string  `json:"halt_reason,omitempty"`
+}
+
+type Monitor struct {
+	cfg     Config
+	started time.Time
+
+	mu        sync.Mutex
+	heartbeat time.Time
+	ticks     map[string]time.Time
+	risk      RiskState
+}
+
+func New(cfg Config) *Monitor {
+	if cfg.StaleAfter <= 0 {
+		cfg.StaleAfter = 30 * time.Second
+	}
+	if cfg.MaxDriftMs <= 0 {
+		cfg.MaxDriftMs = 5000
+	}
+	if cfg.MaxRateUsage <= 0 {
+		cfg.MaxRateUsage = 0.9
+	}
+	return &Monitor{cfg: cfg, started: time.Now(), ticks: make(map[string]time.Time)}
+}
+
+// Heartbeat marks one pass of the engine loop.
+func (m *Monitor) Heartbeat() {
+	m.mu.Lock()
+	m.heartbeat = time.Now()
+	m.mu.Unlock()
+}
+
+// MarkTick records that all market data for symbol was fetched successfully.
+func (m *Monitor) MarkTick(symbol string) {
+	m.mu.Lock()
+	m.ticks[symbol] = time.Now()
+	m.mu.Unlock()
+}
+
+func (m *Monitor) SetRisk(r RiskState) {
+	m.mu.Lock()
+	m.risk = r
+	m.mu.Unlock()
+}
+
+func (m *Monitor) SetSymbols(symbols []string) {
+	m.mu.Lock()
+	m.cfg.Symbols = append([]string(nil), symbols...)
+	m.mu.Unlock()
+}
+
+type SymbolStatus struct {
+	LastTick time.Time `json:"last_tick"`
+	AgeMs    int64     `json:"age_ms"`
+	Fresh    bool      `json:"fresh"`
+}
+
+type PrivateStatus struct {
+	OK        bool      `json:"ok"`
+	CheckedAt time.Time `json:"checked_at"`
+	Err       string    `json:"err,omitempty"`
+}
+
+type Report struct {
+	Live      bool                    `json:"live"`
+	Ready     bool                    `json:"ready"`
+	Reasons   []string                `json:"reasons,omitempty"`
+	UptimeSec int64                   `json:"uptime_sec"`
+	Heartbeat time.Time               `json:"heartbeat"`
+	Symbols   map[string]SymbolStatus `json:"symbols"`
+	Private   PrivateStatus           `json:"private"`
+	DriftMs   int64                   `json:"drift_ms"`
+	RateUsage map[string]float64      `json:"rate_usage"`
+	Risk      RiskState               `json:"risk"`
+}
+
+func (m *Monitor) Report() Report {
+	now := time.Now()
+	m.mu.Lock()
+	syms := append([]string(nil), m.cfg.Symbols...)
+	ticks := make(map[string]time.Time, len(m.ticks))
+	for k, v := range m.ticks {
+		ticks[k] = v
+	}
+	hb := m.heartbeat
+	risk := m.risk
+	m.mu.Unlock()
+
+	r := Report{
+		UptimeSec: int64(now.Sub(m.started).Seconds()),
+		Heartbeat: hb,
+		Symbols:   make(map[string]SymbolStatus, len(syms)),
+		Risk:      risk,
+	}
+	// Before the first loop pass the process is live but not yet ready.
+	r.Live = now.Sub(hb) <= m.cfg.StaleAfter || (hb.IsZero() && now.Sub(m.started) <= m.cfg.StaleAfter)
+	if !r.Live {
+		r.Reasons = append(r.Reasons, "engine loop heartbeat stale")
+	}
+	sort.Strings(syms)
+	for _, s := range syms {
+		t := ticks[s]
+		st := SymbolStatus{LastTick: t, AgeMs: -1}
+		if !t.IsZero() {
+			st.AgeMs = now.Sub(t).Milliseconds()
+			st.Fresh = now.Sub(t) <= m.cfg.StaleAfter
+		}
+		if !st.Fresh {
+			r.Reasons = append(r.Reasons, "market data stale: "+s)
+		}
+		r.Symbols[s] = st
+	}
+	if m.cfg.Private != nil {
+		at, err := m.cfg.Private()
+		r.Private = PrivateStatus{OK: err == nil && !at.IsZero(), CheckedAt: at}
+		if err != nil {
+			r.Private.Err = err.Error()
+		}
+		if !r.Private.OK && m.cfg.RequirePrivate {
+			r.Reasons = append(r.Reasons, "private API unreachable")
+		}
+	}
+	if m.cfg.Drift != nil {
+		r.DriftMs = m.cfg.Drift()
+		if abs64(r.DriftMs) > m.cfg.MaxDriftMs {
+			r.Reasons = append(r.Reasons, "clock drift "+strconv.FormatInt(r.DriftMs, 10)+"ms exceeds limit")
+		}
+	}
+	if m.cfg.RateUsage != nil {
+		r.RateUsage = m.cfg.RateUsage()
+		for d, u := range r.RateUsage {
+			if u >= m.cfg.MaxRateUsage {
+				r.Reasons = append(r.Reasons, "rate limiter saturated: "+d)
+			}
+		}
+	}
+	if risk.Halted {
+		r.Reasons = append(r.Reasons, "trading halted: "+risk.HaltReason)
+	}
+	r.Ready = len(r.Reasons) == 0
+	return r
+}
+
+// Healthz is the liveness probe: non-200 only when the engine loop is stuck.
+func (m *Monitor) Healthz() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		r := m.Report()
+		writeJSON(w, r.Live, r)
+	})
+}
+
+// Readyz is the readiness probe: non-200 whenever the bot should not trade.
+func (m *Monitor) Readyz() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		r := m.Report()
+		writeJSON(w, r.Ready, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, ok bool, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,124 @@
+// Package keystore stores API credentials in a local file encrypted with a
+// passphrase: scrypt derives the key, AES-256-GCM seals the JSON payload.
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const version = 1
+
+// scrypt cost parameters for new keystores; existing files carry their own.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+var ErrPassphrase = errors.New("wrong passphrase or corrupted keystore")
+
+type Credentials struct {
+	APIKey     string `json:"api_key"`
+	APISecret  string `json:"api_secret"`
+	Passphrase string `json:"api_passphrase"`
+}
+
+type file struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func aead(pass string, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(pass), salt, n, r, p, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Seal encrypts creds under pass and returns the keystore file contents.
+func Seal(creds Credentials, pass string) ([]byte, error) {
+	if pass == "" {
+		return nil, errors.New("empty passphrase")
+	}
+	f := file{Version: version, KDF: "scrypt", N: scryptN, R: scryptR, P: scryptP, Salt: make([]byte, 16)}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return nil, err
+	}
+	gcm, err := aead(pass, f.Salt, f.N, f.R, f.P)
+	if err != nil {
+		return nil, err
+	}
+	f.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return nil, err
+	}
+	plain, err := json.Marshal(creds)
+	if err != nil {
+		return nil, err
+	}
+	f.Ciphertext = gcm.Seal(nil, f.Nonce, plain, nil)
+	return json.MarshalIndent(f, "", "  ")
+}
+
+// Open decrypts keystore file contents.
+func Open(data []byte, pass string) (Credentials, error) {
+	var creds Credentials
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return creds, fmt.Errorf("parse keystore: %w", err)
+	}
+	if f.Version != version || f.KDF != "scrypt" {
+		return creds, fmt.Errorf("unsupported keystore version %d kdf %q", f.Version, f.KDF)
+	}
+	gcm, err := aead(pass, f.Salt, f.N, f.R, f.P)
+	if err != nil {
+		return creds, err
+	}
+	if len(f.Nonce) != gcm.NonceSize() {
+		return creds, ErrPassphrase
+	}
+	plain, err := gcm.Open(nil, f.Nonce, f.Ciphertext, nil)
+	if err != nil {
+		return creds, ErrPassphrase
+	}
+	if err := json.Unmarshal(plain, &creds); err != nil {
+		return creds, ErrPassphrase
+	}
+	return creds, nil
+}
+
+func ReadFile(path, pass string) (Credentials, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Credentials{}, err
+	}
+	return Open(data, pass)
+}
+
+// WriteFile seals creds into path with owner-only permissions.
+func WriteFile(path string, creds Credentials, pass string) error {
+	data, err := Seal(creds, pass)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
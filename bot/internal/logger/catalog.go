@@ -0,0 +1,377 @@
+package logger
+
+import "strings"
+
+// Lang selects how event names and field keys are rendered. The English
+// event key is always written first so grep and parsers see the same token
+// in every language.
+type Lang string
+
+const (
+	LangEN   Lang = "en"
+	LangZH   Lang = "zh"
+	LangBoth Lang = "both"
+)
+
+func ParseLang(s string) Lang {
+	switch Lang(strings.ToLower(strings.TrimSpace(s))) {
+	case LangEN:
+		return LangEN
+	case LangZH:
+		return LangZH
+	default:
+		return LangBoth
+	}
+}
+
+// Event names.
+const (
+	EvSyncTime             = "sync_time"
+	EvAccountPing          = "account_ping"
+	EvTraderMode           = "trader_mode"
+	EvHTTPPublic           = "http_public"
+	EvJSONPublic           = "json_public"
+	EvHTTPPrivate          = "http_private"
+	EvJSONPrivate          = "json_private"
+	EvQueryTicker          = "query_ticker"
+	EvQueryIndex           = "query_index"
+	EvQueryDepth           = "query_depth"
+	EvQueryFundRate        = "query_fund_rate"
+	EvStrategyTrigger      = "strategy_trigger"
+	EvSkipNotionalCap      = "skip_notional_cap"
+	EvSizeAdjust           = "size_adjust"
+	EvOrderOpen            = "order_open"
+	EvOrderOpenError       = "order_open_error"
+	EvOrderClose           = "order_close"
+	EvOrderCloseError      = "order_close_error"
+	EvOrderFilled          = "order_filled"
+	EvEntryFilled          = "entry_filled"
+	EvPositionClosed       = "position_closed"
+	EvFlatten              = "flatten"
+	EvCancelAll            = "cancel_all"
+	EvShutdown             = "shutdown"
+	EvShutdownSummary      = "shutdown_summary"
+	EvSummary              = "summary"
+	EvPositionDetail       = "position_detail"
+	EvMetricsStart         = "metrics_start"
+	EvMetricsStartPosition = "metrics_start_position"
+	EvLogDropped           = "log_dropped"
+	EvHTTPServer           = "http_server"
+	EvAdmin                = "admin"
+	EvConfigReload         = "config_reload"
+	EvCassette             = "cassette"
+	EvDriftAlert           = "drift_alert"
+	EvSkipBook             = "skip_book"
+	EvSkipFactor           = "skip_factor"
+	EvBasisOutlier         = "basis_outlier"
+	EvBasisGap             = "basis_gap"
+	EvSizing               = "sizing"
+	EvAccountSetup         = "account_setup"
+	EvProtect              = "protect"
+	EvExecChild            = "exec_child"
+	EvExecDone             = "exec_done"
+	EvTCA                  = "tca"
+	EvTCASummary           = "tca_summary"
+	EvReport               = "report"
+)
+
+// Field keys.
+const (
+	KSymbol        = "symbol"
+	KErr           = "err"
+	KMsg           = "msg"
+	KMode          = "mode"
+	KPath          = "path"
+	KCode          = "code"
+	KBody          = "body"
+	KServerTS      = "server_ts"
+	KDriftMs       = "drift_ms"
+	KOrderID       = "order_id"
+	KSide          = "side"
+	KOrderType     = "order_type"
+	KLast          = "last"
+	KBid           = "bid"
+	KAsk           = "ask"
+	KMark          = "mark"
+	KIndex         = "index"
+	KAsks          = "asks"
+	KBids          = "bids"
+	KFundingRate   = "funding_rate"
+	KDev           = "dev"
+	KZ             = "z"
+	KClipped       = "clipped"
+	KSize          = "size"
+	KPrice         = "price"
+	KNotional      = "notional"
+	KEntryPrice    = "entry_price"
+	KExitPrice     = "exit_price"
+	KGrossPnL      = "gross_pnl"
+	KFee           = "fee"
+	KNetPnL        = "net_pnl"
+	KSuggestedSize = "suggested_size"
+	KSizeStep      = "size_step"
+	KMinSize       = "min_size"
+	KFinalSize     = "final_size"
+	KOpenPositions = "open_positions"
+	KCumNetPnL     = "cum_net_pnl"
+	KLeverage      = "leverage"
+	KEquityUSDT    = "equity_usdt"
+	KAvailableUSDT = "available_usdt"
+	KTotal         = "total"
+	KSinceLast     = "since_last"
+	KAction        = "action"
+	KReason        = "reason"
+	KClosedCount   = "closed_count"
+	KElapsed       = "elapsed"
+	KCount         = "count"
+	KAddr          = "addr"
+	KRemote        = "remote"
+	KBefore        = "before"
+	KAfter         = "after"
+	KField         = "field"
+	KResult        = "result"
+	KRTTMs         = "rtt_ms"
+	KSampleMs      = "sample_ms"
+	KThresholdMs   = "threshold_ms"
+	KVWAP          = "vwap"
+	KSlippageBps   = "slippage_bps"
+	KLiquidity     = "liquidity"
+	KImbalance     = "imbalance"
+	KScore         = "score"
+	KMethod        = "method"
+	KVolPerSec     = "vol_per_sec"
+	KRiskPerTrade  = "risk_per_trade"
+	KMarginMode    = "margin_mode"
+	KActual        = "actual"
+	KStopLoss      = "stop_loss"
+	KTakeProfit    = "take_profit"
+	KPlanType      = "plan_type"
+	KPlanOrderID   = "plan_order_id"
+	KTrigger       = "trigger_price"
+	KAlgo          = "algo"
+	KChildID       = "child_id"
+	KChildren      = "children"
+	KFilled        = "filled"
+	KAvgPrice      = "avg_price"
+	KArrival       = "arrival"
+	KLeg           = "leg"
+	KDecision      = "decision"
+	KShortfallBps  = "shortfall_bps"
+	KDelayBps      = "delay_bps"
+	KFeeBps        = "fee_bps"
+	KCost          = "cost"
+	KTimeToFill    = "time_to_fill"
+	KLegs          = "legs"
+	KUnfilled      = "unfilled"
+	KSlippageP50   = "slippage_p50_bps"
+	KSlippageP90   = "slippage_p90_bps"
+	KEntryTime     = "entry_time"
+	KPnLUnit       = "pnl_unit"
+	KGroup         = "group"
+	KKey           = "key"
+	KTrades        = "trades"
+	KWinRate       = "win_rate"
+	KAvgWin        = "avg_win"
+	KAvgLoss       = "avg_loss"
+	KProfitFactor  = "profit_factor"
+	KMaxDrawdown   = "max_drawdown"
+	KSharpe        = "sharpe"
+	KSortino       = "sortino"
+	KTurnover      = "turnover"
+	KExposure      = "exposure"
+	// KFactorPrefix + factor name keys each factor value.
+	KFactorPrefix = "factor_"
+)
+
+var eventZh = map[string]string{
+	EvSyncTime:             "同步服务器时间",
+	EvAccountPing:          "私有接口检测",
+	EvTraderMode:           "交易模式",
+	EvHTTPPublic:           "公共接口请求",
+	EvJSONPublic:           "公共接口解析",
+	EvHTTPPrivate:          "私有接口请求",
+	EvJSONPrivate:          "私有接口解析",
+	EvQueryTicker:          "查询行情",
+	EvQueryIndex:           "查询指数",
+	EvQueryDepth:           "查询深度",
+	EvQueryFundRate:        "查询资金费率",
+	EvStrategyTrigger:      "策略触发",
+	EvSkipNotionalCap:      "跳过下单_名义金额上限",
+	EvSizeAdjust:           "数量调整",
+	EvOrderOpen:            "开仓委托",
+	EvOrderOpenError:       "开仓错误",
+	EvOrderClose:           "平仓委托",
+	EvOrderCloseError:      "平仓错误",
+	EvOrderFilled:          "委托成交",
+	EvEntryFilled:          "开仓成交",
+	EvPositionClosed:       "平仓收益",
+	EvFlatten:              "一键平仓",
+	EvCancelAll:            "撤销全部委托",
+	EvShutdown:             "停机",
+	EvShutdownSummary:      "停机汇总",
+	EvSummary:              "汇总",
+	EvPositionDetail:       "持仓明细",
+	EvMetricsStart:         "启动快照",
+	EvMetricsStartPosition: "启动持仓",
+	EvLogDropped:           "日志丢弃",
+	EvHTTPServer:           "HTTP服务",
+	EvAdmin:                "管理操作",
+	EvConfigReload:         "配置重载",
+	EvCassette:             "录制回放",
+	EvDriftAlert:           "时间偏移告警",
+	EvSkipBook:             "盘口条件不满足跳过",
+	EvSkipFactor:           "因子得分不足跳过",
+	EvBasisOutlier:         "基差异常值剔除",
+	EvBasisGap:             "基差数据中断",
+	EvSizing:               "仓位计算",
+	EvAccountSetup:         "账户设置",
+	EvProtect:              "止盈止损单",
+	EvExecChild:            "子委托",
+	EvExecDone:             "算法委托完成",
+	EvTCA:                  "交易成本分析",
+	EvTCASummary:           "交易成本汇总",
+	EvReport:               "绩效报告",
+}
+
+var fieldZh = map[string]string{
+	KSymbol:                   "币对",
+	KErr:                      "错误",
+	KMsg:                      "信息",
+	KMode:                     "模式",
+	KPath:                     "路径",
+	KCode:                     "状态码",
+	KBody:                     "响应",
+	KServerTS:                 "服务器时间",
+	KDriftMs:                  "时间偏移毫秒",
+	KOrderID:                  "委托ID",
+	KSide:                     "方向",
+	KOrderType:                "类型",
+	KLast:                     "最新价",
+	KBid:                      "买一",
+	KAsk:                      "卖一",
+	KMark:                     "标记价",
+	KIndex:                    "指数价",
+	KAsks:                     "卖盘档数",
+	KBids:                     "买盘档数",
+	KFundingRate:              "资金费率",
+	KDev:                      "基差",
+	KZ:                        "z值",
+	KClipped:                  "截断值",
+	KSize:                     "数量",
+	KPrice:                    "价格",
+	KNotional:                 "名义金额",
+	KEntryPrice:               "入场价",
+	KExitPrice:                "平仓价",
+	KGrossPnL:                 "毛利润",
+	KFee:                      "手续费",
+	KNetPnL:                   "净利润",
+	KSuggestedSize:            "建议数量",
+	KSizeStep:                 "步长",
+	KMinSize:                  "最小数量",
+	KFinalSize:                "最终数量",
+	KOpenPositions:            "持仓数",
+	KCumNetPnL:                "累计净收益",
+	KLeverage:                 "杠杆",
+	KEquityUSDT:               "权益USDT",
+	KAvailableUSDT:            "可用USDT",
+	KTotal:                    "总计",
+	KSinceLast:                "新增",
+	KAction:                   "动作",
+	KReason:                   "原因",
+	KClosedCount:              "已平仓数",
+	KElapsed:                  "耗时",
+	KCount:                    "数量统计",
+	KAddr:                     "监听地址",
+	KRemote:                   "来源",
+	KBefore:                   "调整前",
+	KAfter:                    "调整后",
+	KField:                    "字段",
+	KResult:                   "结果",
+	KRTTMs:                    "往返耗时毫秒",
+	KSampleMs:                 "本次偏移毫秒",
+	KThresholdMs:              "阈值毫秒",
+	KVWAP:                     "成交均价估计",
+	KSlippageBps:              "滑点基点",
+	KLiquidity:                "可用深度",
+	KImbalance:                "盘口失衡",
+	KScore:                    "因子得分",
+	KMethod:                   "方法",
+	KVolPerSec:                "每秒波动率",
+	KRiskPerTrade:             "单笔风险比例",
+	KMarginMode:               "保证金模式",
+	KActual:                   "实际",
+	KStopLoss:                 "止损价",
+	KTakeProfit:               "止盈价",
+	KPlanType:                 "计划类型",
+	KPlanOrderID:              "计划委托ID",
+	KTrigger:                  "触发价",
+	KAlgo:                     "执行算法",
+	KChildID:                  "子委托ID",
+	KChildren:                 "子委托数",
+	KFilled:                   "成交数量",
+	KAvgPrice:                 "成交均价",
+	KArrival:                  "到达中间价",
+	KLeg:                      "环节",
+	KDecision:                 "决策价",
+	KShortfallBps:             "执行差额基点",
+	KDelayBps:                 "延迟成本基点",
+	KFeeBps:                   "手续费基点",
+	KCost:                     "执行成本",
+	KTimeToFill:               "成交耗时",
+	KLegs:                     "委托数",
+	KUnfilled:                 "未成交数",
+	KSlippageP50:              "滑点中位数基点",
+	KSlippageP90:              "滑点P90基点",
+	KEntryTime:                "开仓时间",
+	KPnLUnit:                  "收益单位",
+	KGroup:                    "分组",
+	KKey:                      "分组值",
+	KTrades:                   "交易数",
+	KWinRate:                  "胜率",
+	KAvgWin:                   "平均盈利",
+	KAvgLoss:                  "平均亏损",
+	KProfitFactor:             "盈亏比",
+	KMaxDrawdown:              "最大回撤",
+	KSharpe:                   "夏普比率",
+	KSortino:                  "索提诺比率",
+	KTurnover:                 "成交额",
+	KExposure:                 "持仓时间占比",
+	"factor_imbalance":        "因子_盘口失衡",
+	"factor_microprice_bps":   "因子_微观价格偏离基点",
+	"factor_spread_bps":       "因子_价差基点",
+	"factor_volume_24h":       "因子_24小时成交量对数",
+	"factor_price_change_24h": "因子_24小时涨跌幅",
+	"factor_abs_z":            "因子_z绝对值",
+	"factor_funding_carry":    "因子_资金费率收益",
+}
+
+// renderTag returns the event token; non-English modes append the Chinese
+// label in brackets, e.g. "position_closed[平仓收益]".
+func renderTag(lang Lang, tag string) string {
+	if lang == LangEN {
+		return tag
+	}
+	if zh, ok := eventZh[tag]; ok {
+		return tag + "[" + zh + "]"
+	}
+	return tag
+}
+
+// renderKey returns "symbol" (en), "币对/symbol" (zh) or "symbol/币对"
+// (both). The English key is always written; in zh it comes last, so
+// "symbol=" greps the same as in en. Keys missing from the catalogue are
+// written unchanged.
+func renderKey(lang Lang, key string) string {
+	zh, ok := fieldZh[key]
+	if !ok {
+		return key
+	}
+	switch lang {
+	case LangZH:
+		return zh + "/" + key
+	case LangBoth:
+		return key + "/" + zh
+	default:
+		return key
+	}
+}
@@ -1,120 +1,283 @@
 package logger
 
 import (
+	"bufio"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/weex/ai_trading/bot/internal/clock"
+)
+
+type sink int
+
+const (
+	sinkInfo sink = iota
+	sinkError
+	sinkMetrics
+	sinkPnL
+	sinkTrade
+	sinkCount
+)
+
+var sinkDirs = [sinkCount]string{"info", "error", "metrics", "pnl", "trades"}
+
+type OverflowPolicy string
+
+const (
+	// Block makes callers wait for buffer space when the writer falls behind.
+	Block OverflowPolicy = "block"
+	// Drop discards the record and counts it; the trading loop never waits.
+	Drop OverflowPolicy = "drop"
 )
 
+type Config struct {
+	Dir           string
+	BufferSize    int
+	Overflow      OverflowPolicy
+	FlushInterval time.Duration
+	Lang          Lang
+	// Redact lists literal values (credentials) masked as *** in every line.
+	Redact []string
+	// Clock stamps records and drives day rotation; nil means wall time.
+	// Periodic flushing always runs on wall time.
+	Clock clock.Clock
+}
+
+type record struct {
+	t     time.Time
+	sink  sink
+	level string
+	tag   string
+	kv    []string
+}
+
 type Logger struct {
-	infoFile    *os.File
-	errorFile   *os.File
-	metricsFile *os.File
-	pnlFile     *os.File
-	tradesFile  *os.File
-	mu          sync.Mutex
-	baseDir     string
-	day         string
-}
-
-func New(baseDir string) *Logger {
-	l := &Logger{baseDir: baseDir}
-	l.rotateIfNeeded()
-	return l
+	cfg     Config
+	ch      chan record
+	flushCh chan chan struct{}
+	done    chan struct{}
+	mu      sync.RWMutex
+	closed  bool
+	dropped atomic.Uint64
+	redact  *strings.Replacer
+
+	// owned by the writer goroutine
+	files    [sinkCount]*os.File
+	bufs     [sinkCount]*bufio.Writer
+	day      string
+	nextDay  time.Time
+	reported uint64
 }
 
-func (l *Logger) Close() {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	if l.infoFile != nil {
-		_ = l.infoFile.Close()
+func New(cfg Config) *Logger {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 4096
+	}
+	if cfg.Overflow != Drop {
+		cfg.Overflow = Block
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.Lang == "" {
+		cfg.Lang = LangBoth
+	}
+	cfg.Clock = clock.Or(cfg.Clock)
+	l := &Logger{
+		cfg:     cfg,
+		ch:      make(chan record, cfg.BufferSize),
+		flushCh: make(chan chan struct{}),
+		done:    make(chan struct{}),
+	}
+	var pairs []string
+	for _, s := range cfg.Redact {
+		if s != "" {
+			pairs = append(pairs, s, "***")
+		}
+	}
+	if len(pairs) > 0 {
+		l.redact = strings.NewReplacer(pairs...)
 	}
-	if l.errorFile != nil {
-		_ = l.errorFile.Close()
+	l.rotateIfNeeded(cfg.Clock.Now())
+	go l.run()
+	return l
+}
+
+// Dropped reports how many records were discarded under the Drop policy.
+func (l *Logger) Dropped() uint64 {
+	return l.dropped.Load()
+}
+
+// Flush blocks until every record enqueued before the call is on disk.
+func (l *Logger) Flush() {
+	l.mu.RLock()
+	if l.closed {
+		l.mu.RUnlock()
+		return
 	}
+	ack := make(chan struct{})
+	l.flushCh <- ack
+	l.mu.RUnlock()
+	<-ack
 }
 
-func (l *Logger) rotateIfNeeded() {
+// Close drains the buffer, flushes and closes all files. Safe to call twice.
+func (l *Logger) Close() {
 	l.mu.Lock()
-	defer l.mu.Unlock()
-	day := time.Now().Format("2006-01-02")
-	if day == l.day && l.infoFile != nil && l.errorFile != nil && l.metricsFile != nil && l.pnlFile != nil && l.tradesFile != nil {
+	if l.closed {
+		l.mu.Unlock()
 		return
 	}
-	l.day = day
-	infoDir := filepath.Join(l.baseDir, "info")
-	errDir := filepath.Join(l.baseDir, "error")
-	metricsDir := filepath.Join(l.baseDir, "metrics")
-	pnlDir := filepath.Join(l.baseDir, "pnl")
-	tradesDir := filepath.Join(l.baseDir, "trades")
-	_ = os.MkdirAll(infoDir, 0o755)
-	_ = os.MkdirAll(errDir, 0o755)
-	_ = os.MkdirAll(metricsDir, 0o755)
-	_ = os.MkdirAll(pnlDir, 0o755)
-	_ = os.MkdirAll(tradesDir, 0o755)
-	infoPath := filepath.Join(infoDir, day+".log")
-	errPath := filepath.Join(errDir, day+".log")
-	metricsPath := filepath.Join(metricsDir, day+".log")
-	pnlPath := filepath.Join(pnlDir, day+".log")
-	tradesPath := filepath.Join(tradesDir, day+".log")
-	if l.infoFile != nil {
-		_ = l.infoFile.Close()
-	}
-	if l.errorFile != nil {
-		_ = l.errorFile.Close()
-	}
-	if l.metricsFile != nil {
-		_ = l.metricsFile.Close()
-	}
-	if l.pnlFile != nil {
-		_ = l.pnlFile.Close()
-	}
-	if l.tradesFile != nil {
-		_ = l.tradesFile.Close()
-	}
-	l.infoFile, _ = os.OpenFile(infoPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
-	l.errorFile, _ = os.OpenFile(errPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
-	l.metricsFile, _ = os.OpenFile(metricsPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
-	l.pnlFile, _ = os.OpenFile(pnlPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
-	l.tradesFile, _ = os.OpenFile(tradesPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	l.closed = true
+	close(l.ch)
+	l.mu.Unlock()
+	<-l.done
 }
 
 func (l *Logger) Info(tag string, kv ...string) {
-	l.rotateIfNeeded()
-	l.write(l.infoFile, "INFO", tag, kv...)
+	l.enqueue(sinkInfo, "INFO", tag, kv)
 }
 
 func (l *Logger) Error(tag string, kv ...string) {
-	l.rotateIfNeeded()
-	l.write(l.errorFile, "ERROR", tag, kv...)
+	l.enqueue(sinkError, "ERROR", tag, kv)
 }
 
 func (l *Logger) Metrics(tag string, kv ...string) {
-	l.rotateIfNeeded()
-	l.write(l.metricsFile, "METRICS", tag, kv...)
+	l.enqueue(sinkMetrics, "METRICS", tag, kv)
 }
 
 func (l *Logger) PnL(tag string, kv ...string) {
-	l.rotateIfNeeded()
-	l.write(l.pnlFile, "PNL", tag, kv...)
+	l.enqueue(sinkPnL, "PNL", tag, kv)
 }
 
 func (l *Logger) Trade(tag string, kv ...string) {
-	l.rotateIfNeeded()
-	l.write(l.tradesFile, "TRADE", tag, kv...)
+	l.enqueue(sinkTrade, "TRADE", tag, kv)
 }
 
-func (l *Logger) write(f *os.File, level, tag string, kv ...string) {
-	if f == nil {
+func (l *Logger) enqueue(s sink, level, tag string, kv []string) {
+	r := record{t: l.cfg.Clock.Now(), sink: s, level: level, tag: tag, kv: kv}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
 		return
 	}
-	ts := time.Now().Format(time.RFC3339)
-	line := fmt.Sprintf("%s %s %s", ts, level, tag)
-	for i := 0; i+1 < len(kv); i += 2 {
-		line += fmt.Sprintf(" %s=%s", kv[i], kv[i+1])
+	if l.cfg.Overflow == Drop {
+		select {
+		case l.ch <- r:
+		default:
+			l.dropped.Add(1)
+		}
+		return
+	}
+	l.ch <- r
+}
+
+func (l *Logger) run() {
+	defer close(l.done)
+	flush := time.NewTicker(l.cfg.FlushInterval)
+	defer flush.Stop()
+	for {
+		select {
+		case r, ok := <-l.ch:
+			if !ok {
+				l.flushAll()
+				l.closeFiles()
+				return
+			}
+			l.write(r)
+		case ack := <-l.flushCh:
+			l.drain()
+			l.flushAll()
+			close(ack)
+		case <-flush.C:
+			l.reportDropped()
+			l.flushAll()
+		}
+	}
+}
+
+// drain writes whatever is already buffered without waiting for more.
+func (l *Logger) drain() {
+	for {
+		select {
+		case r, ok := <-l.ch:
+			if !ok {
+				return
+			}
+			l.write(r)
+		default:
+			return
+		}
+	}
+}
+
+func (l *Logger) reportDropped() {
+	n := l.dropped.Load()
+	if n == l.reported {
+		return
+	}
+	l.write(record{t: l.cfg.Clock.Now(), sink: sinkError, level: "ERROR", tag: EvLogDropped, kv: []string{KTotal, strconv.FormatUint(n, 10), KSinceLast, strconv.FormatUint(n-l.reported, 10)}})
+	l.reported = n
+}
+
+func (l *Logger) rotateIfNeeded(now time.Time) {
+	if now.Before(l.nextDay) {
+		return
+	}
+	l.flushAll()
+	l.closeFiles()
+	l.day = now.Format("2006-01-02")
+	y, m, d := now.Date()
+	l.nextDay = time.Date(y, m, d+1, 0, 0, 0, 0, now.Location())
+	for i, dir := range sinkDirs {
+		p := filepath.Join(l.cfg.Dir, dir)
+		_ = os.MkdirAll(p, 0o755)
+		f, err := os.OpenFile(filepath.Join(p, l.day+".log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			continue
+		}
+		l.files[i] = f
+		l.bufs[i] = bufio.NewWriterSize(f, 32*1024)
+	}
+}
+
+func (l *Logger) flushAll() {
+	for _, b := range l.bufs {
+		if b != nil {
+			_ = b.Flush()
+		}
+	}
+}
+
+func (l *Logger) closeFiles() {
+	for i, f := range l.files {
+		if f != nil {
+			_ = f.Close()
+		}
+		l.files[i] = nil
+		l.bufs[i] = nil
+	}
+}
+
+func (l *Logger) write(r record) {
+	l.rotateIfNeeded(r.t)
+	w := l.bufs[r.sink]
+	if w == nil {
+		return
+	}
+	line := fmt.Sprintf("%s %s %s", r.t.Format(time.RFC3339), r.level, renderTag(l.cfg.Lang, r.tag))
+	for i := 0; i+1 < len(r.kv); i += 2 {
+		line += fmt.Sprintf(" %s=%s", renderKey(l.cfg.Lang, r.kv[i]), r.kv[i+1])
 	}
 	line += "\n"
-	_, _ = f.WriteString(line)
+	if l.redact != nil {
+		line = l.redact.Replace(line)
+	}
+	_, _ = w.WriteString(line)
 }
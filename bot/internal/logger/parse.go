@@ -0,0 +1,69 @@
+package logger
+
+import (
+	"strings"
+	"time"
+)
+
+// Entry is one log line read back.
+type Entry struct {
+	Time   time.Time
+	Level  string
+	Event  string
+	Fields map[string]string
+}
+
+var zhField = func() map[string]string {
+	m := make(map[string]string, len(fieldZh))
+	for k, zh := range fieldZh {
+		m[zh] = k
+	}
+	return m
+}()
+
+// ParseLine reads a line written in any Lang back into its event and
+// English keys. Values run to the next " key=", so a value with spaces
+// (an error message) stays whole.
+func ParseLine(line string) (Entry, bool) {
+	parts := strings.Fields(line)
+	if len(parts) < 3 {
+		return Entry{}, false
+	}
+	t, err := time.Parse(time.RFC3339, parts[0])
+	if err != nil {
+		return Entry{}, false
+	}
+	ev := parts[2]
+	if i := strings.IndexByte(ev, '['); i > 0 {
+		ev = ev[:i]
+	}
+	e := Entry{Time: t, Level: parts[1], Event: ev, Fields: make(map[string]string)}
+	var last string
+	for _, p := range parts[3:] {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok || k == "" {
+			if last != "" {
+				e.Fields[last] += " " + p
+			}
+			continue
+		}
+		last = parseKey(k)
+		e.Fields[last] = v
+	}
+	return e, true
+}
+
+// parseKey maps "symbol", "symbol/币对", "币对/symbol" and, from logs
+// written before zh kept the English key, "币对" to "symbol".
+func parseKey(k string) string {
+	if a, b, ok := strings.Cut(k, "/"); ok {
+		if _, zh := zhField[a]; zh {
+			return b
+		}
+		return a
+	}
+	if en, ok := zhField[k]; ok {
+		return en
+	}
+	return k
+}
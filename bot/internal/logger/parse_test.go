@@ -0,0 +1,50 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/weex/ai_trading/bot/internal/clock"
+)
+
+func TestParseLineEveryLang(t *testing.T) {
+	for _, tt := range []struct {
+		lang Lang
+		key  string
+	}{
+		{LangEN, "symbol="},
+		{LangZH, "币对/symbol="},
+		{LangBoth, "symbol/币对="},
+	} {
+		t.Run(string(tt.lang), func(t *testing.T) {
+			dir := t.TempDir()
+			clk := clock.NewManual(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+			log := New(Config{Dir: dir, Clock: clk, Lang: tt.lang})
+			log.Info(EvBasisOutlier, KSymbol, "cmt_btcusdt", KErr, "two words")
+			log.Close()
+			b, err := os.ReadFile(filepath.Join(dir, "info", "2024-01-01.log"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			line := strings.TrimSpace(string(b))
+			if !strings.Contains(line, " "+tt.key+"cmt_btcusdt") {
+				t.Fatalf("%q: want key %q", line, tt.key)
+			}
+			e, ok := ParseLine(line)
+			if !ok || e.Event != EvBasisOutlier || e.Fields[KSymbol] != "cmt_btcusdt" || e.Fields[KErr] != "two words" {
+				t.Fatalf("%q parsed as %+v", line, e)
+			}
+		})
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	for _, k := range []string{"symbol", "symbol/币对", "币对/symbol", "币对"} {
+		if got := parseKey(k); got != KSymbol {
+			t.Errorf("parseKey(%q) = %q, want symbol", k, got)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import "net/http"
+
+var latencyBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics holds every series the bot exports. One instance is created in
+// main and shared by the client, rate limiter hook and engine.
+type Metrics struct {
+	reg *Registry
+
+	Requests       *CounterVec
+	RequestErrors  *CounterVec
+	RequestLatency *HistogramVec
+
+	RateLimitWait *HistogramVec
+
+	Basis       *GaugeVec
+	ZScore      *GaugeVec
+	FundingRate *GaugeVec
+	// DataRejected counts market data kept out of the strategy as bad.
+	DataRejected *CounterVec
+
+	OpenPositions *GaugeVec
+	RealizedPnL   *GaugeVec
+	UnrealizedPnL *GaugeVec
+
+	OrdersPlaced   *CounterVec
+	OrdersRejected *CounterVec
+}
+
+func New() *Metrics {
+	r := NewRegistry()
+	return &Metrics{
+		reg:            r,
+		Requests:       r.NewCounterVec("weex_requests_total", "HTTP requests sent to WEEX.", "endpoint"),
+		RequestErrors:  r.NewCounterVec("weex_request_errors_total", "Failed WEEX requests by failure kind.", "endpoint", "kind"),
+		RequestLatency: r.NewHistogramVec("weex_request_duration_seconds", "WEEX request round-trip time.", latencyBuckets, "endpoint"),
+		RateLimitWait:  r.NewHistogramVec("ratelimit_wait_seconds", "Time spent waiting for rate-limit weight.", latencyBuckets, "domain"),
+		Basis:          r.NewGaugeVec("strategy_basis", "Latest (mark-index)/index per symbol.", "symbol"),
+		ZScore:         r.NewGaugeVec("strategy_zscore", "Latest basis z-score per symbol.", "symbol"),
+		FundingRate:    r.NewGaugeVec("strategy_funding_rate", "Latest funding rate per symbol.", "symbol"),
+		DataRejected:   r.NewCounterVec("strategy_data_rejected_total", "Market data samples treated as bad data per symbol.", "symbol", "reason"),
+		OpenPositions:  r.NewGaugeVec("strategy_open_positions", "Open engine positions per symbol.", "symbol"),
+		RealizedPnL:    r.NewGaugeVec("strategy_realized_pnl_usdt", "Cumulative realized net PnL per symbol.", "symbol"),
+		UnrealizedPnL:  r.NewGaugeVec("strategy_unrealized_pnl_usdt", "Mark-to-last PnL of open positions per symbol.", "symbol"),
+		OrdersPlaced:   r.NewCounterVec("orders_placed_total", "Entry orders accepted by the trader.", "symbol", "side"),
+		OrdersRejected: r.NewCounterVec("orders_rejected_total", "Entry orders rejected by the trader or a risk cap.", "symbol", "reason"),
+	}
+}
+
+// GaugeFunc registers a gauge sampled at scrape time.
+func (m *Metrics) GaugeFunc(name, help string, labels []string, fn func() []Sample) {
+	m.reg.NewGaugeFunc(name, help, labels, fn)
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return m.reg.Handler()
+}
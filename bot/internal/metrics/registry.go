@@ -0,0 +1,251 @@
+package metrics
+
+import (
+	"bufio"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A minimal Prometheus text-format (0.0.4) registry: labelled counters,
+// gauges, histograms and scrape-time gauge callbacks. It keeps the bot free of
+// third-party dependencies.
+
+type kind int
+
+const (
+	counterKind kind = iota
+	gaugeKind
+	histogramKind
+)
+
+func (k kind) String() string {
+	switch k {
+	case counterKind:
+		return "counter"
+	case histogramKind:
+		return "histogram"
+	default:
+		return "gauge"
+	}
+}
+
+type series struct {
+	values []string
+	val    float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    kind
+	labels  []string
+	buckets []float64
+	fn      func() []Sample
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// Sample is one labelled value returned by a GaugeFunc callback.
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(f *family) *family {
+	f.series = make(map[string]*series)
+	r.mu.Lock()
+	r.families = append(r.families, f)
+	r.mu.Unlock()
+	return f
+}
+
+type CounterVec struct{ f *family }
+type GaugeVec struct{ f *family }
+type HistogramVec struct{ f *family }
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{r.register(&family{name: name, help: help, kind: counterKind, labels: labels})}
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{r.register(&family{name: name, help: help, kind: gaugeKind, labels: labels})}
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &HistogramVec{r.register(&family{name: name, help: help, kind: histogramKind, labels: labels, buckets: b})}
+}
+
+// NewGaugeFunc registers a gauge whose samples are produced by fn at scrape time.
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, fn func() []Sample) {
+	r.register(&family{name: name, help: help, kind: gaugeKind, labels: labels, fn: fn})
+}
+
+func (f *family) get(values []string) *series {
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		if f.kind == histogramKind {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *family) delete(values []string) {
+	f.mu.Lock()
+	delete(f.series, strings.Join(values, "\xff"))
+	f.mu.Unlock()
+}
+
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *CounterVec) Add(v float64, values ...string) {
+	if v < 0 {
+		return
+	}
+	c.f.mu.Lock()
+	c.f.get(values).val += v
+	c.f.mu.Unlock()
+}
+
+func (g *GaugeVec) Set(v float64, values ...string) {
+	g.f.mu.Lock()
+	g.f.get(values).val = v
+	g.f.mu.Unlock()
+}
+
+func (g *GaugeVec) Add(v float64, values ...string) {
+	g.f.mu.Lock()
+	g.f.get(values).val += v
+	g.f.mu.Unlock()
+}
+
+// Delete drops one labelled series, e.g. when a symbol is removed.
+func (g *GaugeVec) Delete(values ...string) {
+	g.f.delete(values)
+}
+
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	h.f.mu.Lock()
+	s := h.f.get(values)
+	for i, ub := range h.f.buckets {
+		if v <= ub {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+	h.f.mu.Unlock()
+}
+
+// Handler serves every registered family in the Prometheus text format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		r.mu.Lock()
+		fams := append([]*family(nil), r.families...)
+		r.mu.Unlock()
+		for _, f := range fams {
+			f.write(bw)
+		}
+		_ = bw.Flush()
+	})
+}
+
+func (f *family) write(w *bufio.Writer) {
+	var snap []*series
+	if f.fn != nil {
+		for _, s := range f.fn() {
+			snap = append(snap, &series{values: s.Labels, val: s.Value})
+		}
+	} else {
+		f.mu.Lock()
+		for _, s := range f.series {
+			cp := *s
+			cp.counts = append([]uint64(nil), s.counts...)
+			snap = append(snap, &cp)
+		}
+		f.mu.Unlock()
+	}
+	sort.Slice(snap, func(i, j int) bool {
+		return strings.Join(snap[i].values, "\xff") < strings.Join(snap[j].values, "\xff")
+	})
+	w.WriteString("# HELP " + f.name + " " + f.help + "\n")
+	w.WriteString("# TYPE " + f.name + " " + f.kind.String() + "\n")
+	for _, s := range snap {
+		if f.kind != histogramKind {
+			w.WriteString(f.name + labelString(f.labels, s.values, "") + " " + formatFloat(s.val) + "\n")
+			continue
+		}
+		for i, ub := range f.buckets {
+			w.WriteString(f.name + "_bucket" + labelString(f.labels, s.values, formatFloat(ub)) + " " + strconv.FormatUint(s.counts[i], 10) + "\n")
+		}
+		w.WriteString(f.name + "_bucket" + labelString(f.labels, s.values, "+Inf") + " " + strconv.FormatUint(s.count, 10) + "\n")
+		w.WriteString(f.name + "_sum" + labelString(f.labels, s.values, "") + " " + formatFloat(s.sum) + "\n")
+		w.WriteString(f.name + "_count" + labelString(f.labels, s.values, "") + " " + strconv.FormatUint(s.count, 10) + "\n")
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labelString(names, values []string, le string) string {
+	if len(names) == 0 && le == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		b.WriteString(n + `="` + labelEscaper.Replace(v) + `"`)
+	}
+	if le != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(`le="` + le + `"`)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -3,6 +3,7 @@ package ratelimit
 import (
     "sync"
     "time"
+    "github.com/weex/ai_trading/bot/internal/clock"
 )
 
 type Domain int
@@ -17,6 +18,7 @@ type bucket struct {
     window   time.Duration
     mu       sync.Mutex
     entries  []entry
+    clk      clock.Clock
 }
 
 type entry struct {
@@ -28,20 +30,36 @@ type Config struct {
     IPCapacity  int
     UIDCapacity int
     Window      time.Duration
+    // OnWait, when set, is called after every Acquire with the time spent blocked.
+    OnWait func(d Domain, waited time.Duration)
+    // Clock drives the window and the back-off sleep; nil means wall time.
+    Clock clock.Clock
 }
 
 type RateLimiter struct {
-    ip  *bucket
-    uid *bucket
+    ip     *bucket
+    uid    *bucket
+    onWait func(d Domain, waited time.Duration)
+    clk    clock.Clock
 }
 
 func New(cfg Config) *RateLimiter {
+    clk := clock.Or(cfg.Clock)
     return &RateLimiter{
-        ip:  &bucket{capacity: cfg.IPCapacity, window: cfg.Window},
-        uid: &bucket{capacity: cfg.UIDCapacity, window: cfg.Window},
+        ip:     &bucket{capacity: cfg.IPCapacity, window: cfg.Window, clk: clk},
+        uid:    &bucket{capacity: cfg.UIDCapacity, window: cfg.Window, clk: clk},
+        onWait: cfg.OnWait,
+        clk:    clk,
     }
 }
 
+func (d Domain) String() string {
+    if d == IP {
+        return "ip"
+    }
+    return "uid"
+}
+
 func (b *bucket) prune(now time.Time) {
     cutoff := now.Add(-b.window)
     i := 0
@@ -65,7 +83,7 @@ func (b *bucket) used() int {
 
 func (b *bucket) acquire(w int) {
     for {
-        now := time.Now()
+        now := b.clk.Now()
         b.mu.Lock()
         b.prune(now)
         u := b.used()
@@ -76,7 +94,7 @@ func (b *bucket) acquire(w int) {
         }
         sleep := time.Millisecond * 200
         b.mu.Unlock()
-        time.Sleep(sleep)
+        b.clk.Sleep(sleep)
     }
 }
 
@@ -84,10 +102,26 @@ func (rl *RateLimiter) Acquire(d Domain, w int) {
     if w <= 0 {
         return
     }
+    start := rl.clk.Now()
+    rl.bucket(d).acquire(w)
+    if rl.onWait != nil {
+        rl.onWait(d, rl.clk.Since(start))
+    }
+}
+
+// Usage reports the weight consumed in the current window and the capacity.
+func (rl *RateLimiter) Usage(d Domain) (used, capacity int) {
+    b := rl.bucket(d)
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    b.prune(b.clk.Now())
+    return b.used(), b.capacity
+}
+
+func (rl *RateLimiter) bucket(d Domain) *bucket {
     if d == IP {
-        rl.ip.acquire(w)
-    } else {
-        rl.uid.acquire(w)
+        return rl.ip
     }
+    return rl.uid
 }
 
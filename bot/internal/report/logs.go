@@ -0,0 +1,102 @@
+package report
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/weex/ai_trading/bot/internal/logger"
+)
+
+// PnLUnit marks position_closed records whose gross, fee and net PnL are
+// for the whole size. Records without it were written when gross PnL was
+// per unit of size and cannot be put on the same scale.
+const PnLUnit = "position"
+
+// ReadLogs reads the position_closed records from the pnl logs under dir,
+// which is either the log directory or its pnl subdirectory. Trades
+// closed outside [from, to] are skipped; a zero bound is open. Records
+// with per-unit PnL are skipped too and counted in legacy.
+func ReadLogs(dir string, from, to time.Time) (trades []Trade, legacy int, err error) {
+	if st, err := os.Stat(filepath.Join(dir, "pnl")); err == nil && st.IsDir() {
+		dir = filepath.Join(dir, "pnl")
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(files) == 0 {
+		return nil, 0, fmt.Errorf("no pnl logs in %s", dir)
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		ts, n, err := readFile(f, from, to)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", f, err)
+		}
+		trades = append(trades, ts...)
+		legacy += n
+	}
+	return trades, legacy, nil
+}
+
+func readFile(path string, from, to time.Time) ([]Trade, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	var out []Trade
+	legacy := 0
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		e, ok := logger.ParseLine(sc.Text())
+		if !ok || e.Event != logger.EvPositionClosed {
+			continue
+		}
+		if (!from.IsZero() && e.Time.Before(from)) || (!to.IsZero() && e.Time.After(to)) {
+			continue
+		}
+		if !positionPnL(e) {
+			legacy++
+			continue
+		}
+		out = append(out, tradeOf(e))
+	}
+	return out, legacy, sc.Err()
+}
+
+// positionPnL reports whether e has PnL for its whole size. Only records
+// carrying the unit marker do; gross PnL was per unit of size before it,
+// even on records that already logged the size.
+func positionPnL(e logger.Entry) bool {
+	return e.Fields[logger.KPnLUnit] == PnLUnit
+}
+
+func tradeOf(e logger.Entry) Trade {
+	num := func(k string) float64 {
+		v, _ := strconv.ParseFloat(e.Fields[k], 64)
+		return v
+	}
+	t := Trade{
+		Symbol:     e.Fields[logger.KSymbol],
+		Side:       e.Fields[logger.KSide],
+		Reason:     e.Fields[logger.KReason],
+		ExitTime:   e.Time,
+		EntryPrice: num(logger.KEntryPrice),
+		ExitPrice:  num(logger.KExitPrice),
+		Size:       num(logger.KSize),
+		Gross:      num(logger.KGrossPnL),
+		Fee:        num(logger.KFee),
+		Net:        num(logger.KNetPnL),
+	}
+	if at, err := time.Parse(time.RFC3339, e.Fields[logger.KEntryTime]); err == nil {
+		t.EntryTime = at
+	}
+	return t
+}
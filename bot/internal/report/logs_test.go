@@ -0,0 +1,33 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weex/ai_trading/bot/internal/clock"
+	"github.com/weex/ai_trading/bot/internal/logger"
+)
+
+func TestReadLogsSkipsPerUnitPnL(t *testing.T) {
+	dir := t.TempDir()
+	clk := clock.NewManual(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	log := logger.New(logger.Config{Dir: dir, Clock: clk})
+	base := []string{logger.KSymbol, "cmt_btcusdt", logger.KSide, "long", logger.KEntryPrice, "100", logger.KExitPrice, "101"}
+	// per unit, from before size was logged
+	log.PnL(logger.EvPositionClosed, append(base, logger.KGrossPnL, "1", logger.KFee, "0.1", logger.KNetPnL, "0.9")...)
+	// still per unit, logged with the size but before the marker
+	log.PnL(logger.EvPositionClosed, append(base, logger.KGrossPnL, "1", logger.KFee, "0.2", logger.KNetPnL, "0.8", logger.KSize, "2")...)
+	log.PnL(logger.EvPositionClosed, append(base, logger.KGrossPnL, "3", logger.KFee, "0.1", logger.KNetPnL, "2.9", logger.KSize, "3", logger.KPnLUnit, PnLUnit)...)
+	log.Close()
+
+	trades, legacy, err := ReadLogs(dir, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if legacy != 2 || len(trades) != 1 {
+		t.Fatalf("%d trades, %d legacy; want 1 and 2", len(trades), legacy)
+	}
+	if tr := trades[0]; tr.Size != 3 || tr.Gross != 3 {
+		t.Fatalf("trade = size %v gross %v, want 3 and 3", tr.Size, tr.Gross)
+	}
+}
@@ -0,0 +1,281 @@
+// Package report turns closed trades into performance figures: the
+// equity curve, drawdown, Sharpe/Sortino, win rate and what the trading
+// turned over, in total and broken down by symbol, side and exit reason.
+// Trades come from the engine while it runs or from the pnl logs.
+package report
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Exit reasons.
+const (
+	ReasonHold    = "hold"    // hold duration elapsed
+	ReasonProtect = "protect" // exchange-side stop-loss or take-profit fired
+)
+
+// Trade is one closed position. Size and EntryTime are zero in logs
+// written before they were recorded; such trades count for PnL but not
+// for turnover or exposure.
+type Trade struct {
+	Symbol     string    `json:"symbol"`
+	Side       string    `json:"side"`
+	Reason     string    `json:"reason"`
+	EntryTime  time.Time `json:"entry_time"`
+	ExitTime   time.Time `json:"exit_time"`
+	EntryPrice float64   `json:"entry_price"`
+	ExitPrice  float64   `json:"exit_price"`
+	Size       float64   `json:"size"`
+	Gross      float64   `json:"gross_pnl"`
+	Fee        float64   `json:"fee"`
+	Net        float64   `json:"net_pnl"`
+}
+
+// Turnover is the notional traded to open and close the position.
+func (t Trade) Turnover() float64 { return (t.EntryPrice + t.ExitPrice) * t.Size }
+
+// Options tune the ratios. Period is the bucket the Sharpe and Sortino
+// returns are taken over, annualised on a 365-day year; Capital turns PnL
+// into returns and drawdown into a fraction and, when zero, both stay in
+// USDT (the ratios do not depend on it).
+type Options struct {
+	Period  time.Duration
+	Capital float64
+}
+
+const year = 365 * 24 * time.Hour
+
+// maxPeriods bounds the buckets of a Sharpe computation; a finer Period
+// over a longer span leaves the ratios at zero.
+const maxPeriods = 1 << 20
+
+// Stats are the figures of a group of trades. Ratios that need more
+// data than the group has (two periods for Sharpe, a loss for the
+// profit factor) are zero.
+type Stats struct {
+	Group          string        `json:"group"`
+	Key            string        `json:"key"`
+	Trades         int           `json:"trades"`
+	Wins           int           `json:"wins"`
+	Losses         int           `json:"losses"`
+	WinRate        float64       `json:"win_rate"`
+	Gross          float64       `json:"gross_pnl"`
+	Fees           float64       `json:"fees"`
+	Net            float64       `json:"net_pnl"`
+	AvgWin         float64       `json:"avg_win"`
+	AvgLoss        float64       `json:"avg_loss"`
+	ProfitFactor   float64       `json:"profit_factor"`
+	MaxDrawdown    float64       `json:"max_drawdown"`
+	MaxDrawdownPct float64       `json:"max_drawdown_pct"`
+	Sharpe         float64       `json:"sharpe"`
+	Sortino        float64       `json:"sortino"`
+	Turnover       float64       `json:"turnover"`
+	Held           time.Duration `json:"-"`
+	HeldSec        float64       `json:"held_sec"`
+	Exposure       float64       `json:"exposure"` // share of the span with a position open
+}
+
+// Point is the equity after a trade closed.
+type Point struct {
+	Time   time.Time `json:"time"`
+	Equity float64   `json:"equity"`
+}
+
+type Report struct {
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Period   string    `json:"period"`
+	Capital  float64   `json:"capital"`
+	Total    Stats     `json:"total"`
+	BySymbol []Stats   `json:"by_symbol"`
+	BySide   []Stats   `json:"by_side"`
+	ByReason []Stats   `json:"by_reason"`
+	Equity   []Point   `json:"equity"`
+}
+
+// Groups lists the breakdowns in report order.
+func (r Report) Groups() []Stats {
+	out := []Stats{r.Total}
+	out = append(out, r.BySymbol...)
+	out = append(out, r.BySide...)
+	return append(out, r.ByReason...)
+}
+
+// New computes the report of trades, which need not be sorted.
+func New(trades []Trade, opt Options) Report {
+	if opt.Period <= 0 {
+		opt.Period = 24 * time.Hour
+	}
+	ts := append([]Trade(nil), trades...)
+	sort.SliceStable(ts, func(i, j int) bool { return ts[i].ExitTime.Before(ts[j].ExitTime) })
+	r := Report{Period: opt.Period.String(), Capital: opt.Capital}
+	if len(ts) == 0 {
+		r.Total = Stats{Group: "total", Key: "all"}
+		return r
+	}
+	r.From, r.To = span(ts)
+	r.Total = stats("total", "all", ts, r.From, r.To, opt)
+	r.BySymbol = breakdown("symbol", ts, func(t Trade) string { return t.Symbol }, r.From, r.To, opt)
+	r.BySide = breakdown("side", ts, func(t Trade) string { return t.Side }, r.From, r.To, opt)
+	r.ByReason = breakdown("reason", ts, func(t Trade) string { return t.Reason }, r.From, r.To, opt)
+	eq := opt.Capital
+	for _, t := range ts {
+		eq += t.Net
+		r.Equity = append(r.Equity, Point{Time: t.ExitTime, Equity: eq})
+	}
+	return r
+}
+
+// span runs from the first entry (or exit, when entries are unknown) to
+// the last exit.
+func span(ts []Trade) (from, to time.Time) {
+	from, to = ts[0].ExitTime, ts[len(ts)-1].ExitTime
+	for _, t := range ts {
+		if !t.EntryTime.IsZero() && t.EntryTime.Before(from) {
+			from = t.EntryTime
+		}
+	}
+	return from, to
+}
+
+func breakdown(group string, ts []Trade, key func(Trade) string, from, to time.Time, opt Options) []Stats {
+	by := make(map[string][]Trade)
+	var keys []string
+	for _, t := range ts {
+		k := key(t)
+		if k == "" {
+			k = "unknown"
+		}
+		if _, ok := by[k]; !ok {
+			keys = append(keys, k)
+		}
+		by[k] = append(by[k], t)
+	}
+	sort.Strings(keys)
+	out := make([]Stats, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, stats(group, k, by[k], from, to, opt))
+	}
+	return out
+}
+
+// stats summarises ts, sorted by exit time. Sharpe and exposure are over
+// the report span so groups compare on the same clock.
+func stats(group, key string, ts []Trade, from, to time.Time, opt Options) Stats {
+	s := Stats{Group: group, Key: key, Trades: len(ts)}
+	var won, lost float64
+	eq, peak := opt.Capital, opt.Capital
+	for _, t := range ts {
+		s.Gross += t.Gross
+		s.Fees += t.Fee
+		s.Net += t.Net
+		s.Turnover += t.Turnover()
+		if !t.EntryTime.IsZero() {
+			s.Held += t.ExitTime.Sub(t.EntryTime)
+		}
+		switch {
+		case t.Net > 0:
+			s.Wins++
+			won += t.Net
+		case t.Net < 0:
+			s.Losses++
+			lost -= t.Net
+		}
+		eq += t.Net
+		peak = math.Max(peak, eq)
+		if dd := peak - eq; dd > s.MaxDrawdown {
+			s.MaxDrawdown = dd
+			if peak > 0 && opt.Capital > 0 {
+				s.MaxDrawdownPct = dd / peak
+			}
+		}
+	}
+	s.WinRate = float64(s.Wins) / float64(s.Trades)
+	if s.Wins > 0 {
+		s.AvgWin = won / float64(s.Wins)
+	}
+	if s.Losses > 0 {
+		s.AvgLoss = -lost / float64(s.Losses)
+		s.ProfitFactor = won / lost
+	}
+	s.HeldSec = s.Held.Seconds()
+	if d := to.Sub(from); d > 0 {
+		s.Exposure = float64(covered(ts)) / float64(d)
+	}
+	s.Sharpe, s.Sortino = ratios(ts, from, to, opt)
+	return s
+}
+
+// covered is the time at least one of ts was open.
+func covered(ts []Trade) time.Duration {
+	type iv struct{ a, b time.Time }
+	var ivs []iv
+	for _, t := range ts {
+		if !t.EntryTime.IsZero() && t.ExitTime.After(t.EntryTime) {
+			ivs = append(ivs, iv{t.EntryTime, t.ExitTime})
+		}
+	}
+	sort.Slice(ivs, func(i, j int) bool { return ivs[i].a.Before(ivs[j].a) })
+	var total time.Duration
+	var cur iv
+	for i, v := range ivs {
+		if i > 0 && !v.a.After(cur.b) {
+			if v.b.After(cur.b) {
+				cur.b = v.b
+			}
+			continue
+		}
+		if i > 0 {
+			total += cur.b.Sub(cur.a)
+		}
+		cur = v
+	}
+	if len(ivs) > 0 {
+		total += cur.b.Sub(cur.a)
+	}
+	return total
+}
+
+// ratios buckets the net PnL of ts by exit time into periods over
+// [from, to], periods without a close counting as flat, and annualises
+// mean over deviation. Sortino only counts losing periods as risk.
+func ratios(ts []Trade, from, to time.Time, opt Options) (sharpe, sortino float64) {
+	n := int(to.Sub(from)/opt.Period) + 1
+	if n < 2 || n > maxPeriods {
+		return 0, 0
+	}
+	rets := make([]float64, n)
+	for _, t := range ts {
+		i := int(t.ExitTime.Sub(from) / opt.Period)
+		if i >= 0 && i < n {
+			rets[i] += t.Net
+		}
+	}
+	if opt.Capital > 0 {
+		for i := range rets {
+			rets[i] /= opt.Capital
+		}
+	}
+	var mean float64
+	for _, r := range rets {
+		mean += r
+	}
+	mean /= float64(n)
+	var vr, down float64
+	for _, r := range rets {
+		vr += (r - mean) * (r - mean)
+		if r < 0 {
+			down += r * r
+		}
+	}
+	ann := math.Sqrt(float64(year) / float64(opt.Period))
+	if sd := math.Sqrt(vr / float64(n-1)); sd > 0 {
+		sharpe = mean / sd * ann
+	}
+	if dd := math.Sqrt(down / float64(n)); dd > 0 {
+		sortino = mean / dd * ann
+	}
+	return sharpe, sortino
+}
@@ -0,0 +1,49 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// WriteText prints the span, then one table row per group.
+func (r Report) WriteText(w io.Writer) error {
+	if r.Total.Trades == 0 {
+		_, err := fmt.Fprintln(w, "no closed trades")
+		return err
+	}
+	fmt.Fprintf(w, "from=%s to=%s trades=%d period=%s\n", r.From.Format(time.RFC3339), r.To.Format(time.RFC3339), r.Total.Trades, r.Period)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "GROUP\tKEY\tTRADES\tWIN%\tNET\tFEES\tAVG_WIN\tAVG_LOSS\tPF\tMAX_DD\tSHARPE\tSORTINO\tTURNOVER\tEXPOSURE%")
+	for _, s := range r.Groups() {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%.1f\t%.6f\t%.6f\t%.6f\t%.6f\t%.2f\t%.6f\t%.2f\t%.2f\t%.2f\t%.1f\n",
+			s.Group, s.Key, s.Trades, s.WinRate*100, s.Net, s.Fees, s.AvgWin, s.AvgLoss, s.ProfitFactor, s.MaxDrawdown, s.Sharpe, s.Sortino, s.Turnover, s.Exposure*100)
+	}
+	return tw.Flush()
+}
+
+func (r Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+var csvHeader = []string{"group", "key", "trades", "wins", "losses", "win_rate", "gross_pnl", "fees", "net_pnl", "avg_win", "avg_loss",
+	"profit_factor", "max_drawdown", "max_drawdown_pct", "sharpe", "sortino", "turnover", "held_sec", "exposure"}
+
+// WriteCSV writes one row per group; the equity curve is in the JSON.
+func (r Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write(csvHeader)
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	for _, s := range r.Groups() {
+		_ = cw.Write([]string{s.Group, s.Key, strconv.Itoa(s.Trades), strconv.Itoa(s.Wins), strconv.Itoa(s.Losses), f(s.WinRate), f(s.Gross), f(s.Fees), f(s.Net),
+			f(s.AvgWin), f(s.AvgLoss), f(s.ProfitFactor), f(s.MaxDrawdown), f(s.MaxDrawdownPct), f(s.Sharpe), f(s.Sortino), f(s.Turnover), f(s.HeldSec), f(s.Exposure)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,112 @@
+// Package sizing turns a signal into an order quantity, either as a fixed
+// base size or from account equity, leverage and recent volatility.
+package sizing
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+const (
+	Fixed  = "fixed"  // base_size * min(3, |z|)
+	Equity = "equity" // a share of equity as margin, times leverage
+	Vol    = "vol"    // risk budget over the expected move during the hold
+)
+
+var (
+	ErrNoEquity = errors.New("account equity unavailable")
+	ErrNoVol    = errors.New("volatility estimate not ready")
+	ErrNoPrice  = errors.New("no price")
+)
+
+type Params struct {
+	Method   string
+	BaseSize float64
+	// RiskPerTrade is the share of equity a one-sigma move over Hold may
+	// cost (vol method).
+	RiskPerTrade float64
+	// EquityFraction is the share of equity posted as margin per trade:
+	// the notional of the equity method and the cap of the vol method.
+	EquityFraction float64
+	Leverage       float64
+	Hold           time.Duration
+}
+
+type Inputs struct {
+	Equity float64
+	Price  float64
+	Z      float64
+	// VolPerSec is the std of log returns per square-root second.
+	VolPerSec float64
+}
+
+// Conviction scales equity and vol sizes: 1 at |z| >= 3, linear below.
+func Conviction(z float64) float64 { return math.Min(3, math.Abs(z)) / 3 }
+
+// Size returns the raw quantity before exchange rounding.
+func Size(p Params, in Inputs) (float64, error) {
+	if p.Method == Fixed || p.Method == "" {
+		return p.BaseSize * math.Min(3, math.Abs(in.Z)), nil
+	}
+	if in.Price <= 0 {
+		return 0, ErrNoPrice
+	}
+	if in.Equity <= 0 {
+		return 0, ErrNoEquity
+	}
+	lev := math.Max(1, p.Leverage)
+	maxNotional := in.Equity * p.EquityFraction * lev
+	notional := maxNotional * Conviction(in.Z)
+	if p.Method == Vol {
+		if in.VolPerSec <= 0 {
+			return 0, ErrNoVol
+		}
+		move := in.VolPerSec * math.Sqrt(p.Hold.Seconds())
+		notional = math.Min(maxNotional, in.Equity*p.RiskPerTrade*Conviction(in.Z)/move)
+	}
+	return notional / in.Price, nil
+}
+
+// minVolSamples is how many returns Tracker needs before it reports.
+const minVolSamples = 10
+
+// Tracker estimates realized volatility from a price series as an EWMA of
+// squared log returns per second, so uneven polling is accounted for.
+type Tracker struct {
+	HalfLife time.Duration
+	last     time.Time
+	price    float64
+	rate     float64 // variance per second
+	n        int
+}
+
+func (t *Tracker) Update(at time.Time, price float64) {
+	if price <= 0 {
+		return
+	}
+	if t.price == 0 {
+		t.last, t.price = at, price
+		return
+	}
+	dt := at.Sub(t.last).Seconds()
+	if dt <= 0 {
+		return
+	}
+	r := math.Log(price / t.price)
+	a := 1 - math.Exp2(-dt/t.HalfLife.Seconds())
+	if t.n == 0 {
+		a = 1
+	}
+	t.rate += a * (r*r/dt - t.rate)
+	t.last, t.price = at, price
+	t.n++
+}
+
+// PerSecond returns the std of log returns per square-root second.
+func (t *Tracker) PerSecond() (float64, bool) {
+	if t.n < minVolSamples {
+		return 0, false
+	}
+	return math.Sqrt(t.rate), true
+}
@@ -0,0 +1,78 @@
+package sizing
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSize(t *testing.T) {
+	vol := Params{Method: Vol, RiskPerTrade: 0.01, EquityFraction: 0.1, Leverage: 5, Hold: 100 * time.Second}
+	equity := Params{Method: Equity, EquityFraction: 0.1, Leverage: 5}
+	tests := []struct {
+		name    string
+		p       Params
+		in      Inputs
+		want    float64
+		wantErr error
+	}{
+		{"fixed scales with |z| up to 3", Params{Method: Fixed, BaseSize: 2}, Inputs{Z: -4}, 6, nil},
+		{"fixed below 3", Params{BaseSize: 2}, Inputs{Z: 0.5}, 1, nil},
+		{"equity at full conviction", equity, Inputs{Equity: 1000, Price: 100, Z: 3}, 5, nil},
+		{"equity at half conviction", equity, Inputs{Equity: 1000, Price: 100, Z: -1.5}, 2.5, nil},
+		// risk 1000*0.01 over a 0.04 move is 250 USDT, under the 500 cap
+		{"vol under the cap", vol, Inputs{Equity: 1000, Price: 100, Z: 3, VolPerSec: 0.004}, 2.5, nil},
+		{"vol at half conviction", vol, Inputs{Equity: 1000, Price: 100, Z: 1.5, VolPerSec: 0.004}, 1.25, nil},
+		// a 0.01 move would allow 1000 USDT; the equity cap is 500
+		{"vol capped by equity", vol, Inputs{Equity: 1000, Price: 100, Z: 3, VolPerSec: 0.001}, 5, nil},
+		{"vol without equity", vol, Inputs{Price: 100, Z: 3, VolPerSec: 0.001}, 0, ErrNoEquity},
+		{"vol without volatility", vol, Inputs{Equity: 1000, Price: 100, Z: 3}, 0, ErrNoVol},
+		{"equity without price", equity, Inputs{Equity: 1000, Z: 3}, 0, ErrNoPrice},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Size(tt.p, tt.in)
+			if !errors.Is(err, tt.wantErr) || math.Abs(got-tt.want) > 1e-9 {
+				t.Fatalf("Size = %v, %v; want %v, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTracker(t *testing.T) {
+	type step struct {
+		dt time.Duration
+		r  float64
+	}
+	// returns of 0.001 a second, then 0.002 every four seconds: the same
+	// variance per second
+	var steps []step
+	for i := 0; i < minVolSamples; i++ {
+		steps = append(steps, step{time.Second, 0.001})
+	}
+	for i := 0; i < 5; i++ {
+		steps = append(steps, step{4 * time.Second, 0.002})
+	}
+	tr := Tracker{HalfLife: time.Minute}
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	px := 100.0
+	tr.Update(at, px)
+	for i, s := range steps {
+		if _, ok := tr.PerSecond(); ok != (i >= minVolSamples) {
+			t.Fatalf("after %d returns: ready %v", i, ok)
+		}
+		if i%2 == 1 {
+			s.r = -s.r
+		}
+		at = at.Add(s.dt)
+		px *= math.Exp(s.r)
+		tr.Update(at, px)
+		// a repeated timestamp and a bad price are ignored
+		tr.Update(at, px*2)
+		tr.Update(at.Add(time.Second), 0)
+	}
+	if v, ok := tr.PerSecond(); !ok || math.Abs(v-0.001) > 1e-9 {
+		t.Fatalf("PerSecond = %v, %v; want 0.001", v, ok)
+	}
+}
@@ -0,0 +1,121 @@
+package strategy
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/weex/ai_trading/bot/internal/config"
+	"github.com/weex/ai_trading/bot/internal/logger"
+	"github.com/weex/ai_trading/bot/internal/weex"
+)
+
+// accountRetry is how often symbols blocked on account settings are
+// checked again.
+const accountRetry = time.Minute
+
+// setupAccount brings each symbol's leverage and margin mode in line with
+// the config (account_setup=enforce) or only compares them (check). A
+// symbol whose settings still differ, or cannot be read, takes no new
+// entries until a later check finds them right. Mock trading never
+// touches the account.
+func (e *Engine) setupAccount(ctx context.Context, symbols []string) {
+	if e.cfg.AccountSetup == "off" || !strings.EqualFold(e.cfg.TraderMode, "real") || e.client == nil || len(symbols) == 0 {
+		return
+	}
+	e.accountAt = e.clk.Now()
+	cur, err := e.client.GetSymbolSettings(ctx)
+	if err != nil {
+		for _, s := range symbols {
+			e.block(s, "settings unavailable: "+err.Error())
+		}
+		return
+	}
+	if e.cfg.AccountSetup == "enforce" {
+		changed := false
+		for _, s := range symbols {
+			sp := e.cfg.ForSymbol(s)
+			if have, ok := cur[s]; !ok || !settingsMatch(have, sp) {
+				e.applySettings(ctx, s, cur[s], sp)
+				changed = true
+			}
+		}
+		if changed {
+			if cur, err = e.client.GetSymbolSettings(ctx); err != nil {
+				for _, s := range symbols {
+					e.block(s, "settings unavailable: "+err.Error())
+				}
+				return
+			}
+		}
+	}
+	for _, s := range symbols {
+		sp := e.cfg.ForSymbol(s)
+		have := cur[s]
+		kv := []string{logger.KSymbol, s, logger.KMarginMode, sp.MarginMode, logger.KLeverage, strconv.FormatFloat(sp.Leverage, 'f', -1, 64), logger.KActual, describeSettings(have)}
+		if settingsMatch(have, sp) {
+			if e.blocked[s] != "" {
+				delete(e.blocked, s)
+				kv = append(kv, logger.KMsg, "entries unblocked")
+			}
+			e.log.Info(logger.EvAccountSetup, append(kv, logger.KResult, "ok")...)
+			continue
+		}
+		e.blocked[s] = "account settings differ from config"
+		e.log.Error(logger.EvAccountSetup, append(kv, logger.KResult, "blocked")...)
+	}
+}
+
+// applySettings switches margin mode first since leverage is set per mode.
+// Errors are logged; the caller re-reads the settings to decide.
+func (e *Engine) applySettings(ctx context.Context, symbol string, have weex.SymbolSettings, sp config.SymbolParams) {
+	if have.MarginMode != sp.MarginMode {
+		if err := e.client.SetMarginMode(ctx, symbol, sp.MarginMode); err != nil {
+			e.log.Error(logger.EvAccountSetup, logger.KSymbol, symbol, logger.KMarginMode, sp.MarginMode, logger.KErr, err.Error())
+			return
+		}
+	}
+	if err := e.client.SetLeverage(ctx, symbol, sp.MarginMode, sp.Leverage); err != nil {
+		e.log.Error(logger.EvAccountSetup, logger.KSymbol, symbol, logger.KLeverage, strconv.FormatFloat(sp.Leverage, 'f', -1, 64), logger.KErr, err.Error())
+	}
+}
+
+func settingsMatch(have weex.SymbolSettings, sp config.SymbolParams) bool {
+	return have.MarginMode == sp.MarginMode &&
+		math.Abs(have.LongLeverage-sp.Leverage) < 1e-9 &&
+		math.Abs(have.ShortLeverage-sp.Leverage) < 1e-9
+}
+
+func describeSettings(st weex.SymbolSettings) string {
+	if st.Symbol == "" {
+		return "unknown"
+	}
+	mode := st.MarginMode
+	if mode == "" {
+		mode = "unknown"
+	}
+	return mode + " " + strconv.FormatFloat(st.LongLeverage, 'f', -1, 64) + "/" + strconv.FormatFloat(st.ShortLeverage, 'f', -1, 64)
+}
+
+func (e *Engine) block(symbol, reason string) {
+	e.blocked[symbol] = reason
+	e.log.Error(logger.EvAccountSetup, logger.KSymbol, symbol, logger.KResult, "blocked", logger.KReason, reason)
+}
+
+// retryAccount re-checks blocked symbols once per accountRetry.
+func (e *Engine) retryAccount(ctx context.Context) {
+	if len(e.blocked) == 0 || e.clk.Since(e.accountAt) < accountRetry {
+		return
+	}
+	syms := make([]string, 0, len(e.blocked))
+	for s := range e.blocked {
+		if e.active[s] {
+			syms = append(syms, s)
+		}
+	}
+	sort.Strings(syms)
+	e.setupAccount(ctx, syms)
+}
@@ -0,0 +1,166 @@
+package strategy
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/weex/ai_trading/bot/internal/clock"
+	"github.com/weex/ai_trading/bot/internal/config"
+	"github.com/weex/ai_trading/bot/internal/logger"
+	"github.com/weex/ai_trading/bot/internal/report"
+	"github.com/weex/ai_trading/bot/internal/trader"
+	"github.com/weex/ai_trading/bot/internal/weex"
+)
+
+// Bar is one market snapshot for one symbol, the same fields a live tick
+// reads from ticker, index, depth and funding.
+type Bar struct {
+	Time        time.Time
+	Symbol      string
+	Last        float64
+	Bid         float64
+	Ask         float64
+	Mark        float64
+	Index       float64
+	FundingRate float64
+}
+
+var barColumns = []string{"time", "symbol", "last", "bid", "ask", "mark", "index", "funding_rate"}
+
+// ReadBars parses CSV with the header
+// time,symbol,last,bid,ask,mark,index,funding_rate. time is RFC3339 or
+// unix milliseconds. Rows are returned sorted by time.
+func ReadBars(r io.Reader) ([]Bar, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(barColumns)
+	head, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	for i, c := range barColumns {
+		if strings.TrimSpace(strings.ToLower(head[i])) != c {
+			return nil, fmt.Errorf("header column %d: got %q, want %q", i+1, head[i], c)
+		}
+	}
+	var bars []Bar
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		b := Bar{Symbol: strings.TrimSpace(rec[1])}
+		if b.Time, err = parseBarTime(strings.TrimSpace(rec[0])); err != nil {
+			return nil, fmt.Errorf("line %d: time: %w", line, err)
+		}
+		for i, dst := range []*float64{&b.Last, &b.Bid, &b.Ask, &b.Mark, &b.Index, &b.FundingRate} {
+			if *dst, err = strconv.ParseFloat(strings.TrimSpace(rec[i+2]), 64); err != nil {
+				return nil, fmt.Errorf("line %d: %s: %w", line, barColumns[i+2], err)
+			}
+		}
+		bars = append(bars, b)
+	}
+	sort.SliceStable(bars, func(i, j int) bool { return bars[i].Time.Before(bars[j].Time) })
+	return bars, nil
+}
+
+func parseBarTime(s string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+type BacktestSymbol struct {
+	Symbol        string
+	Trades        int
+	Closed        int
+	Open          int
+	RealizedPnL   float64
+	UnrealizedPnL float64
+}
+
+type BacktestResult struct {
+	Bars    int
+	From    time.Time
+	To      time.Time
+	Symbols []BacktestSymbol
+	Report  report.Report
+}
+
+// Backtest replays bars through the entry and exit logic with the mock
+// trader, setting clk to each bar's time; nil gets a fresh manual clock.
+// contracts supplies size increments and fee rates; symbols missing from
+// it use the defaults. Bars for symbols not in cfg.Symbols are skipped.
+func Backtest(cfg config.Config, bars []Bar, contracts map[string]weex.Contract, log *logger.Logger, clk *clock.Manual) BacktestResult {
+	if clk == nil {
+		var start time.Time
+		if len(bars) > 0 {
+			start = bars[0].Time
+		}
+		clk = clock.NewManual(start)
+	}
+	tr := trader.NewMock(log, clk)
+	e := NewEngine(cfg, nil, tr, log, nil, nil, clk)
+	e.noDepth = true
+	for s, c := range contracts {
+		e.contracts[s] = c
+	}
+	trades := make(map[string]int)
+	res := BacktestResult{}
+	for _, b := range bars {
+		if !e.active[b.Symbol] {
+			continue
+		}
+		clk.Set(b.Time)
+		if res.Bars == 0 {
+			res.From = b.Time
+		}
+		res.Bars++
+		res.To = b.Time
+		f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+		t := weex.Ticker{Symbol: b.Symbol, Last: f(b.Last), BestBid: f(b.Bid), BestAsk: f(b.Ask), MarkPrice: f(b.Mark), IndexPrice: f(b.Index)}
+		idx := weex.IndexResp{Symbol: b.Symbol, Index: f(b.Index)}
+		d := weex.DepthResp{Asks: [][]string{{f(b.Ask), "0"}}, Bids: [][]string{{f(b.Bid), "0"}}}
+		before := len(e.positions[b.Symbol])
+		e.evaluateAndTrade(b.Symbol, t, idx, d, f(b.FundingRate))
+		if len(e.positions[b.Symbol]) > before {
+			trades[b.Symbol]++
+		}
+		e.evaluatePnL(b.Symbol, t)
+		e.settleExits()
+		e.settleTCA()
+	}
+	// let pending mock fills complete
+	clk.Advance(time.Minute)
+	_ = tr.Wait(context.Background())
+	e.settleExits()
+	e.settleTCA()
+	e.logTCA()
+	e.logReport()
+	res.Report = report.New(e.closed, report.Options{})
+
+	for _, s := range cfg.Symbols {
+		bs := BacktestSymbol{Symbol: s, Trades: trades[s], Closed: e.closedCount[s], Open: len(e.positions[s]), RealizedPnL: e.realizedPnL[s]}
+		if st := e.states[s]; st != nil {
+			for _, p := range e.positions[s] {
+				if p.side == trader.Buy {
+					bs.UnrealizedPnL += (st.lastPrice - p.entryPrice) * p.size
+				} else {
+					bs.UnrealizedPnL += (p.entryPrice - st.lastPrice) * p.size
+				}
+			}
+		}
+		res.Symbols = append(res.Symbols, bs)
+	}
+	return res
+}
@@ -0,0 +1,83 @@
+package strategy
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/weex/ai_trading/bot/internal/book"
+	"github.com/weex/ai_trading/bot/internal/config"
+	"github.com/weex/ai_trading/bot/internal/logger"
+	"github.com/weex/ai_trading/bot/internal/trader"
+)
+
+// bookEstimate is what the depth says about an entry of size.
+type bookEstimate struct {
+	size      float64
+	vwap      float64
+	slipBps   float64
+	liquidity float64
+	imbalance float64
+	checked   bool
+}
+
+func (b bookEstimate) fields() []string {
+	if !b.checked {
+		return nil
+	}
+	return []string{
+		logger.KVWAP, strconv.FormatFloat(b.vwap, 'f', -1, 64),
+		logger.KSlippageBps, strconv.FormatFloat(b.slipBps, 'f', 2, 64),
+		logger.KLiquidity, strconv.FormatFloat(b.liquidity, 'f', -1, 64),
+		logger.KImbalance, strconv.FormatFloat(b.imbalance, 'f', 3, 64),
+	}
+}
+
+// checkBook gates and sizes an entry on the full depth: size is cut to
+// max_book_share of the liquidity within liquidity_bps of the mid, and the
+// entry is skipped when the book leans against it by more than
+// max_adverse_imbalance or taking size would slip more than
+// max_slippage_bps. Backtests, whose bars carry no depth, skip the check.
+func (e *Engine) checkBook(symbol string, side trader.Side, b book.Book, sp config.SymbolParams, size float64) (bookEstimate, bool) {
+	est := bookEstimate{size: size}
+	if e.noDepth {
+		return est, true
+	}
+	buy := side == trader.Buy
+	est.checked = true
+	est.liquidity = b.Liquidity(buy, e.cfg.LiquidityBps)
+	est.imbalance = b.Imbalance(e.cfg.LiquidityBps)
+	skip := func(reason string) (bookEstimate, bool) {
+		kv := append([]string{logger.KSymbol, symbol, logger.KSide, mapSide(side), logger.KReason, reason, logger.KSize, strconv.FormatFloat(size, 'f', 6, 64)}, est.fields()...)
+		e.log.Info(logger.EvSkipBook, kv...)
+		e.m.OrdersRejected.Inc(symbol, reason)
+		return est, false
+	}
+	if b.Mid() == 0 {
+		return skip("no_depth")
+	}
+	// positive imbalance is bid pressure, adverse to a short
+	adverse := est.imbalance
+	if buy {
+		adverse = -adverse
+	}
+	if adverse > e.cfg.MaxAdverseImbalance {
+		return skip("book_imbalance")
+	}
+	if limit := est.liquidity * e.cfg.MaxBookShare; est.size > limit {
+		inc := e.sizeStep(symbol)
+		est.size = math.Floor(limit/inc) * inc
+		if est.size < inc || est.size < e.cfg.MinSizeMap[symbol] {
+			return skip("thin_book")
+		}
+	}
+	var ok bool
+	est.vwap, _ = b.VWAP(buy, est.size)
+	est.slipBps, ok = b.SlippageBps(buy, est.size)
+	if !ok {
+		return skip("insufficient_depth")
+	}
+	if est.slipBps > sp.MaxSlippageBps {
+		return skip("slippage")
+	}
+	return est, true
+}
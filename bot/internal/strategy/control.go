@@ -0,0 +1,243 @@
+package strategy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/weex/ai_trading/bot/internal/config"
+	"github.com/weex/ai_trading/bot/internal/tca"
+)
+
+// Runtime control. Every exported method here hands a closure to the Run
+// loop through e.cmds, so engine state is only ever touched by the engine
+// goroutine and needs no locking.
+
+var ErrNotRunning = errors.New("engine not running")
+
+// Do runs fn on the engine goroutine between ticks and waits for it.
+func (e *Engine) Do(ctx context.Context, fn func()) error {
+	done := make(chan struct{})
+	select {
+	case e.cmds <- func() { fn(); close(done) }:
+	case <-e.stopped:
+		return ErrNotRunning
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Params are the global entry thresholds that may be changed while running.
+// Per-symbol overrides from the config file still take precedence.
+type Params struct {
+	ZThreshold     float64
+	FundingAbsMax  float64
+	SpreadMaxRatio float64
+	MaxNotionalUSD float64
+	Cooldown       time.Duration
+	HoldDuration   time.Duration
+}
+
+// ErrUnknownSymbol is returned for a symbol that is not configured.
+var ErrUnknownSymbol = errors.New("unknown symbol")
+
+func (e *Engine) params() Params {
+	return Params{
+		ZThreshold:     e.cfg.ZThreshold,
+		FundingAbsMax:  e.cfg.FundingAbsMax,
+		SpreadMaxRatio: e.cfg.SpreadMaxRatio,
+		MaxNotionalUSD: e.cfg.MaxNotionalUSD,
+		Cooldown:       e.cfg.Cooldown,
+		HoldDuration:   e.cfg.HoldDuration,
+	}
+}
+
+func (p Params) applyTo(cfg *config.Config) {
+	cfg.ZThreshold = p.ZThreshold
+	cfg.FundingAbsMax = p.FundingAbsMax
+	cfg.SpreadMaxRatio = p.SpreadMaxRatio
+	cfg.MaxNotionalUSD = p.MaxNotionalUSD
+	cfg.Cooldown = p.Cooldown
+	cfg.HoldDuration = p.HoldDuration
+}
+
+func (e *Engine) applyParams(p Params) {
+	p.applyTo(&e.cfg)
+	for sym, st := range e.states {
+		st.cooldown = e.cfg.ForSymbol(sym).Cooldown
+	}
+}
+
+// UpdateParams lets fn edit a copy of the live params; the result is
+// validated with the rules the config is loaded with and applied
+// atomically, and the previous values are returned.
+func (e *Engine) UpdateParams(ctx context.Context, fn func(*Params)) (before, after Params, err error) {
+	derr := e.Do(ctx, func() {
+		before = e.params()
+		after = before
+		fn(&after)
+		cfg := e.cfg
+		after.applyTo(&cfg)
+		if err = cfg.ValidateParams(); err != nil {
+			return
+		}
+		e.applyParams(after)
+	})
+	if derr != nil {
+		return before, after, derr
+	}
+	return before, after, err
+}
+
+// Pause stops new entries for symbol, or for every symbol when empty.
+// Exits of open positions continue.
+func (e *Engine) Pause(ctx context.Context, symbol string) error {
+	return e.setPaused(ctx, symbol, true)
+}
+
+func (e *Engine) Resume(ctx context.Context, symbol string) error {
+	return e.setPaused(ctx, symbol, false)
+}
+
+func (e *Engine) setPaused(ctx context.Context, symbol string, on bool) error {
+	var err error
+	derr := e.Do(ctx, func() {
+		switch {
+		case symbol == "":
+			e.paused = on
+		case !e.active[symbol]:
+			err = fmt.Errorf("%w %q", ErrUnknownSymbol, symbol)
+			return
+		case on:
+			e.pausedSyms[symbol] = true
+		default:
+			delete(e.pausedSyms, symbol)
+		}
+		e.publishRisk()
+	})
+	if derr != nil {
+		return derr
+	}
+	return err
+}
+
+func (e *Engine) entriesPaused(symbol string) bool {
+	return e.paused || e.pausedSyms[symbol]
+}
+
+// Flatten cancels resting orders and closes every position now.
+func (e *Engine) Flatten(ctx context.Context, reason string) error {
+	return e.Do(ctx, func() {
+		_ = e.tr.CancelAll("")
+		e.flattenAll(ctx, reason)
+		e.publishRisk()
+	})
+}
+
+func (e *Engine) CancelAll(ctx context.Context) error {
+	var err error
+	if derr := e.Do(ctx, func() { err = e.tr.CancelAll("") }); derr != nil {
+		return derr
+	}
+	return err
+}
+
+type PositionSnapshot struct {
+	OrderID    string    `json:"order_id"`
+	Side       string    `json:"side"`
+	EntryPrice float64   `json:"entry_price"`
+	EntryTime  time.Time `json:"entry_time"`
+	OrderType  string    `json:"order_type"`
+	Size       float64   `json:"size"`
+}
+
+type SymbolSnapshot struct {
+	Symbol       string             `json:"symbol"`
+	Paused       bool               `json:"paused"`
+	Blocked      string             `json:"blocked,omitempty"`
+	Samples      int                `json:"samples"`
+	BasisMean    float64            `json:"basis_mean"`
+	BasisStd     float64            `json:"basis_std"`
+	LastPrice    float64            `json:"last_price"`
+	LastTrigger  time.Time          `json:"last_trigger"`
+	CooldownLeft string             `json:"cooldown_left"`
+	RealizedPnL  float64            `json:"realized_pnl"`
+	Closed       int                `json:"closed"`
+	Positions    []PositionSnapshot `json:"positions"`
+	TCA          *tca.Stats         `json:"tca,omitempty"`
+}
+
+type Snapshot struct {
+	Paused  bool             `json:"paused"`
+	Halt    string           `json:"halt,omitempty"`
+	Params  ParamsView       `json:"params"`
+	Symbols []SymbolSnapshot `json:"symbols"`
+}
+
+// ParamsView is Params with durations rendered as strings for JSON.
+type ParamsView struct {
+	ZThreshold     float64 `json:"z_threshold"`
+	FundingAbsMax  float64 `json:"funding_abs_max"`
+	SpreadMaxRatio float64 `json:"spread_max_ratio"`
+	MaxNotionalUSD float64 `json:"max_notional_usd"`
+	Cooldown       string  `json:"cooldown"`
+	HoldDuration   string  `json:"hold_duration"`
+}
+
+func (p Params) View() ParamsView {
+	return ParamsView{
+		ZThreshold:     p.ZThreshold,
+		FundingAbsMax:  p.FundingAbsMax,
+		SpreadMaxRatio: p.SpreadMaxRatio,
+		MaxNotionalUSD: p.MaxNotionalUSD,
+		Cooldown:       p.Cooldown.String(),
+		HoldDuration:   p.HoldDuration.String(),
+	}
+}
+
+func (e *Engine) Snapshot(ctx context.Context) (Snapshot, error) {
+	var snap Snapshot
+	err := e.Do(ctx, func() {
+		snap = Snapshot{Paused: e.paused, Halt: e.halt, Params: e.params().View()}
+		syms := make([]string, 0, len(e.states))
+		for s := range e.states {
+			syms = append(syms, s)
+		}
+		sort.Strings(syms)
+		for _, s := range syms {
+			st := e.states[s]
+			m, sd := st.basis.meanStd()
+			ss := SymbolSnapshot{
+				Symbol:      s,
+				Paused:      e.entriesPaused(s),
+				Blocked:     e.blocked[s],
+				Samples:     st.basis.count(),
+				BasisMean:   m,
+				BasisStd:    sd,
+				LastPrice:   st.lastPrice,
+				LastTrigger: st.lastTrigger,
+				RealizedPnL: e.realizedPnL[s],
+				Closed:      e.closedCount[s],
+			}
+			if ts, ok := e.tca.Symbol(s); ok {
+				ss.TCA = &ts
+			}
+			if left := st.cooldown - e.clk.Now().Sub(st.lastTrigger); left > 0 {
+				ss.CooldownLeft = left.Round(time.Second).String()
+			}
+			for _, p := range e.positions[s] {
+				ss.Positions = append(ss.Positions, PositionSnapshot{OrderID: p.orderID, Side: mapSide(p.side), EntryPrice: p.entryPrice, EntryTime: p.entryTime, OrderType: p.orderType, Size: p.size})
+			}
+			snap.Symbols = append(snap.Symbols, ss)
+		}
+	})
+	return snap, err
+}
@@ -7,8 +7,16 @@ import (
 	"strings"
 	"time"
 
+	"github.com/weex/ai_trading/bot/internal/book"
+	"github.com/weex/ai_trading/bot/internal/clock"
 	"github.com/weex/ai_trading/bot/internal/config"
+	"github.com/weex/ai_trading/bot/internal/execution"
+	"github.com/weex/ai_trading/bot/internal/factor"
+	"github.com/weex/ai_trading/bot/internal/health"
 	"github.com/weex/ai_trading/bot/internal/logger"
+	"github.com/weex/ai_trading/bot/internal/metrics"
+	"github.com/weex/ai_trading/bot/internal/report"
+	"github.com/weex/ai_trading/bot/internal/tca"
 	"github.com/weex/ai_trading/bot/internal/trader"
 	"github.com/weex/ai_trading/bot/internal/weex"
 )
@@ -18,88 +26,155 @@ type Engine struct {
 	client      *weex.Client
 	tr          trader.Trader
 	log         *logger.Logger
+	m           *metrics.Metrics
+	health      *health.Monitor
+	halt        string
+	paused      bool
+	pausedSyms  map[string]bool
+	cmds        chan func()
+	stopped     chan struct{}
+	active      map[string]bool
+	ticker      clock.Ticker
+	summary     clock.Ticker
 	states      map[string]*symbolState
 	positions   map[string][]position
 	realizedPnL map[string]float64
 	closedCount map[string]int
+	contracts   map[string]weex.Contract
+	clk         clock.Clock
+	noDepth     bool // depth carries top-of-book prices only (backtests)
+	equityUSDT  float64
+	equityAt    time.Time
+	blocked     map[string]string // symbol -> why entries are refused
+	accountAt   time.Time
+	tca         *tca.Book
+	pending     []tca.Leg // orders not yet settled for tca
+	exits       []exit    // close orders not yet booked
+	closed      []report.Trade
 }
 
-func NewEngine(cfg config.Config, client *weex.Client, tr trader.Trader, log *logger.Logger) *Engine {
-	e := &Engine{cfg: cfg, client: client, tr: tr, log: log, states: make(map[string]*symbolState), positions: make(map[string][]position), realizedPnL: make(map[string]float64), closedCount: make(map[string]int)}
+func NewEngine(cfg config.Config, client *weex.Client, tr trader.Trader, log *logger.Logger, m *metrics.Metrics, hm *health.Monitor, clk clock.Clock) *Engine {
+	if m == nil {
+		m = metrics.New()
+	}
+	if hm == nil {
+		hm = health.New(health.Config{Symbols: cfg.Symbols})
+	}
+	e := &Engine{cfg: cfg, client: client, tr: tr, log: log, m: m, health: hm, pausedSyms: make(map[string]bool), cmds: make(chan func()), stopped: make(chan struct{}), active: make(map[string]bool), states: make(map[string]*symbolState), positions: make(map[string][]position), realizedPnL: make(map[string]float64), closedCount: make(map[string]int), contracts: make(map[string]weex.Contract), blocked: make(map[string]string), tca: tca.NewBook(), clk: clock.Or(clk)}
 	for _, s := range cfg.Symbols {
-		e.states[s] = newSymbolState(cfg.Cooldown)
+		e.states[s] = newSymbolState(cfg.ForSymbol(s))
+		e.active[s] = true
 	}
 	return e
 }
 
 func (e *Engine) Run(ctx context.Context) {
-	ticker := time.NewTicker(e.cfg.QueryInterval)
-	summaryTicker := time.NewTicker(e.cfg.MetricsInterval)
-	defer ticker.Stop()
-	defer summaryTicker.Stop()
+	e.ticker = e.clk.NewTicker(e.cfg.QueryInterval)
+	e.summary = e.clk.NewTicker(e.cfg.MetricsInterval)
+	defer e.ticker.Stop()
+	defer e.summary.Stop()
+	defer close(e.stopped)
 	e.logStartupSnapshot(ctx)
+	e.setupAccount(ctx, e.cfg.Symbols)
 	if e.cfg.FlattenOnStart {
-		e.flattenExistingPositions(ctx)
+		e.flattenExistingPositions(ctx, "start")
 	}
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
+		case <-e.ticker.C():
 			e.tick(ctx)
-		case <-summaryTicker.C:
+		case <-e.summary.C():
 			e.printSummary()
+		case fn := <-e.cmds:
+			fn()
 		}
 	}
 }
 
 func (e *Engine) tick(ctx context.Context) {
-	for _, s := range e.cfg.Symbols {
+	e.retryAccount(ctx)
+	for _, s := range e.tickSymbols() {
+		if ctx.Err() != nil {
+			return
+		}
+		e.health.Heartbeat()
 		e.processSymbol(ctx, s)
 	}
+	e.settleExits()
+	e.settleTCA()
+	e.publishRisk()
 }
 
 func (e *Engine) processSymbol(ctx context.Context, symbol string) {
 	t, err := e.client.GetTicker(ctx, symbol)
 	if err != nil {
-		e.log.Error("query_ticker", "symbol", symbol, "err", err.Error())
+		e.log.Error(logger.EvQueryTicker, logger.KSymbol, symbol, logger.KErr, err.Error())
 		return
 	}
-	e.log.Info("query_ticker", "symbol", symbol, "last", t.Last, "bid", t.BestBid, "ask", t.BestAsk, "mark", t.MarkPrice, "index", t.IndexPrice)
+	e.log.Info(logger.EvQueryTicker, logger.KSymbol, symbol, logger.KLast, t.Last, logger.KBid, t.BestBid, logger.KAsk, t.BestAsk, logger.KMark, t.MarkPrice, logger.KIndex, t.IndexPrice)
 
 	idx, err := e.client.GetIndex(ctx, symbol)
 	if err != nil {
-		e.log.Error("query_index", "symbol", symbol, "err", err.Error())
+		e.log.Error(logger.EvQueryIndex, logger.KSymbol, symbol, logger.KErr, err.Error())
 		return
 	}
-	e.log.Info("query_index", "symbol", symbol, "index", idx.Index)
+	e.log.Info(logger.EvQueryIndex, logger.KSymbol, symbol, logger.KIndex, idx.Index)
 
-	d, err := e.client.GetDepth(ctx, symbol, 15)
+	d, err := e.client.GetDepth(ctx, symbol, e.cfg.DepthLimit)
 	if err != nil {
-		e.log.Error("query_depth", "symbol", symbol, "err", err.Error())
+		e.log.Error(logger.EvQueryDepth, logger.KSymbol, symbol, logger.KErr, err.Error())
 		return
 	}
-	e.log.Info("query_depth", "symbol", symbol, "asks", strconv.Itoa(len(d.Asks)), "bids", strconv.Itoa(len(d.Bids)))
+	e.log.Info(logger.EvQueryDepth, logger.KSymbol, symbol, logger.KAsks, strconv.Itoa(len(d.Asks)), logger.KBids, strconv.Itoa(len(d.Bids)))
 
 	frs, err := e.client.GetCurrentFundRate(ctx, symbol)
 	if err != nil {
-		e.log.Error("query_fund_rate", "symbol", symbol, "err", err.Error())
+		e.log.Error(logger.EvQueryFundRate, logger.KSymbol, symbol, logger.KErr, err.Error())
 		return
 	}
 	var fr string
 	if len(frs) > 0 {
 		fr = frs[0].FundingRate
-		e.log.Info("query_fund_rate", "symbol", symbol, "fundingRate", fr)
+		e.log.Info(logger.EvQueryFundRate, logger.KSymbol, symbol, logger.KFundingRate, fr)
+		e.m.FundingRate.Set(parseFloat(fr), symbol)
+	}
+	e.health.MarkTick(symbol)
+	// no new entries once shutdown has begun
+	if ctx.Err() != nil {
+		return
 	}
 	e.evaluateAndTrade(symbol, t, idx, d, fr)
 	e.evaluatePnL(symbol, t)
 }
 
+// minOutlierSamples is how many samples the basis estimate needs before
+// outlier rejection starts.
+const minOutlierSamples = 20
+
 func parseFloat(s string) float64 {
 	v, _ := strconv.ParseFloat(s, 64)
 	return v
 }
 
+// parseOpt is parseFloat with NaN for a missing or malformed field.
+func parseOpt(s string) float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return v
+}
+
+func factorFields(vals []factor.Value) []string {
+	kv := make([]string, 0, 2*len(vals))
+	for _, v := range vals {
+		kv = append(kv, logger.KFactorPrefix+v.Name, strconv.FormatFloat(v.Value, 'f', 4, 64))
+	}
+	return kv
+}
+
 func (e *Engine) evaluateAndTrade(symbol string, t weex.Ticker, idx weex.IndexResp, d weex.DepthResp, fundingRate string) {
 	mark := parseFloat(t.MarkPrice)
 	index := parseFloat(idx.Index)
@@ -108,30 +183,57 @@ func (e *Engine) evaluateAndTrade(symbol string, t weex.Ticker, idx weex.IndexRe
 		return
 	}
 	dev := (mark - index) / index
+	sp := e.cfg.ForSymbol(symbol)
 	st := e.states[symbol]
 	if st == nil {
-		st = newSymbolState(e.cfg.Cooldown)
+		st = newSymbolState(sp)
 		e.states[symbol] = st
 	}
-	st.basis.push(dev)
+	now := e.clk.Now()
+	st.vol.HalfLife = e.cfg.VolHalfLife
+	st.vol.Update(now, last)
 	m, s := st.basis.meanStd()
+	// a print this far from the current estimate is treated as bad data and
+	// not traded on. It enters the series clipped to the threshold, so a
+	// lasting shift still moves the estimate rather than being rejected
+	// for good.
+	sample := dev
+	outlier := sp.BasisOutlierZ > 0 && st.basis.count() >= minOutlierSamples && s > 0 && math.Abs(dev-m)/s > sp.BasisOutlierZ
+	if outlier {
+		sample = m + math.Copysign(sp.BasisOutlierZ*s, dev-m)
+		e.log.Info(logger.EvBasisOutlier, logger.KSymbol, symbol, logger.KDev, strconv.FormatFloat(dev, 'f', 6, 64), logger.KZ, strconv.FormatFloat((dev-m)/s, 'f', 3, 64), logger.KClipped, strconv.FormatFloat(sample, 'f', 6, 64))
+		e.m.DataRejected.Inc(symbol, "basis_outlier")
+	}
+	if st.basis.push(now, sample) {
+		e.log.Info(logger.EvBasisGap, logger.KSymbol, symbol, logger.KMsg, "gap longer than basis_max_gap, history reset")
+	}
+	if outlier {
+		return
+	}
 	z := 0.0
 	if s > 0 {
 		z = (dev - m) / s
 	}
-	zThreshold := e.cfg.ZThreshold
+	e.m.Basis.Set(dev, symbol)
+	e.m.ZScore.Set(z, symbol)
+	// no entries until the window holds enough history, after start-up or
+	// after a gap reset it
+	if !e.active[symbol] || e.entriesPaused(symbol) || e.blocked[symbol] != "" || !st.basis.warm() {
+		return
+	}
+	zThreshold := sp.ZThreshold
 	if math.Abs(z) < zThreshold {
 		return
 	}
 	// Cooldown
-	if time.Since(st.lastTrigger) < st.cooldown {
+	if e.clk.Now().Sub(st.lastTrigger) < st.cooldown {
 		return
 	}
 	fr := parseFloat(fundingRate)
-	if math.Abs(fr) > e.cfg.FundingAbsMax {
+	if math.Abs(fr) > sp.FundingAbsMax {
 		return
 	}
-	// Slippage estimate using top of book
+	// Spread check on top of book
 	var askP, bidP float64
 	if len(d.Asks) > 0 {
 		askP = parseFloat(d.Asks[0][0])
@@ -140,14 +242,11 @@ func (e *Engine) evaluateAndTrade(symbol string, t weex.Ticker, idx weex.IndexRe
 		bidP = parseFloat(d.Bids[0][0])
 	}
 	spread := askP - bidP
-	if spread/index > e.cfg.SpreadMaxRatio {
+	if spread/index > sp.SpreadMaxRatio {
 		return
 	}
-	// Position size proportional to z-score, capped
-	size := 0.001 * math.Min(3, math.Abs(z))
-	size = e.adjustOrderSize(symbol, size)
 	var side trader.Side
-	orderType := "limit"
+	orderType := e.execAlgo(sp, z)
 	// Prefer carry: short when fundingRate>0, long when fundingRate<0
 	if dev > 0 {
 		side = trader.Sell
@@ -160,6 +259,28 @@ func (e *Engine) evaluateAndTrade(symbol string, t weex.Ticker, idx weex.IndexRe
 			return
 		}
 	}
+	size, ok := e.sizeFor(symbol, sp, st, z, last)
+	if !ok {
+		return
+	}
+	size = e.adjustOrderSize(symbol, size)
+	bk := book.Parse(d.Asks, d.Bids)
+	fvals := factor.Compute(factor.Input{Book: bk, BandBps: e.cfg.LiquidityBps, Last: last, Volume24h: parseOpt(t.Volume24h), PriceChange24h: parseOpt(t.PriceChangePct), Z: z, FundingRate: fr})
+	ffields := factorFields(fvals)
+	if len(e.cfg.FactorWeights) > 0 {
+		score := factor.Score(fvals, e.cfg.FactorWeights, side == trader.Buy)
+		ffields = append(ffields, logger.KScore, strconv.FormatFloat(score, 'f', 4, 64))
+		if score < e.cfg.FactorMinScore {
+			e.log.Info(logger.EvSkipFactor, append([]string{logger.KSymbol, symbol, logger.KSide, mapSide(side)}, ffields...)...)
+			e.m.OrdersRejected.Inc(symbol, "factor_score")
+			return
+		}
+	}
+	est, ok := e.checkBook(symbol, side, bk, sp, size)
+	if !ok {
+		return
+	}
+	size = est.size
 	// choose executable price near top of book
 	price := last
 	if side == trader.Sell {
@@ -172,16 +293,33 @@ func (e *Engine) evaluateAndTrade(symbol string, t weex.Ticker, idx weex.IndexRe
 		}
 	}
 	// notional cap to avoid oversized orders
-	if price*size > e.cfg.MaxNotionalUSD {
-		e.log.Info("跳过下单_名义金额上限", "币对", symbol, "方向", mapSide(side), "数量", strconv.FormatFloat(size, 'f', 6, 64), "价格", strconv.FormatFloat(price, 'f', 6, 64), "名义金额", strconv.FormatFloat(price*size, 'f', 2, 64))
+	if price*size > sp.MaxNotionalUSD {
+		e.log.Info(logger.EvSkipNotionalCap, logger.KSymbol, symbol, logger.KSide, mapSide(side), logger.KSize, strconv.FormatFloat(size, 'f', 6, 64), logger.KPrice, strconv.FormatFloat(price, 'f', 6, 64), logger.KNotional, strconv.FormatFloat(price*size, 'f', 2, 64))
+		e.m.OrdersRejected.Inc(symbol, "notional_cap")
 		return
 	}
 	o := e.tr.PlaceOrder(symbol, side, orderType, price, size)
-	st.lastTrigger = time.Now()
-	e.positions[symbol] = append(e.positions[symbol], position{orderID: o.ID, side: side, entryPrice: last, entryTime: time.Now(), orderType: orderType, size: size})
-	e.log.Info("strategy_trigger", "symbol", symbol, "action", mapSide(side), "dev", strconv.FormatFloat(dev, 'f', 6, 64), "z", strconv.FormatFloat(z, 'f', 3, 64), "size", strconv.FormatFloat(size, 'f', 6, 64), "orderId", o.ID, "type", orderType)
+	st.lastTrigger = e.clk.Now()
+	if o.Status == "error" {
+		e.m.OrdersRejected.Inc(symbol, "exchange")
+	} else {
+		e.m.OrdersPlaced.Inc(symbol, mapSide(side))
+		e.tr.Protect(o.ID, e.protection(symbol, sp))
+		leg := tca.Leg{Symbol: symbol, Kind: tca.Entry, Buy: side == trader.Buy, OrderID: o.ID, OrderType: orderType, Decision: last, Arrival: (askP + bidP) / 2, Size: size}
+		if orderType != execution.Market {
+			leg.Order = price
+		}
+		e.track(leg)
+		// nothing is held until the entry fills; settleEntries fills in
+		// the size and price
+		e.positions[symbol] = append(e.positions[symbol], position{orderID: o.ID, side: side, entryPrice: price, entryTime: st.lastTrigger, orderType: orderType})
+	}
+	e.log.Info(logger.EvStrategyTrigger, append([]string{logger.KSymbol, symbol, logger.KSide, mapSide(side), logger.KDev, strconv.FormatFloat(dev, 'f', 6, 64), logger.KZ, strconv.FormatFloat(z, 'f', 3, 64), logger.KSize, strconv.FormatFloat(size, 'f', 6, 64), logger.KOrderID, o.ID, logger.KOrderType, orderType}, append(est.fields(), ffields...)...)...)
 }
 
+// position is one entry. size and entryPrice are what has filled so far
+// (entryPrice is the order price until the first fill); done is set once
+// the entry's algorithm has finished and they are final.
 type position struct {
 	orderID    string
 	side       trader.Side
@@ -189,6 +327,7 @@ type position struct {
 	entryTime  time.Time
 	orderType  string
 	size       float64
+	done       bool
 }
 
 func mapSide(s trader.Side) string {
@@ -200,40 +339,269 @@ func mapSide(s trader.Side) string {
 
 func (e *Engine) evaluatePnL(symbol string, t weex.Ticker) {
 	last := parseFloat(t.Last)
-	hold := e.cfg.HoldDuration
+	if st := e.states[symbol]; st != nil && last > 0 {
+		st.lastPrice = last
+	}
+	e.settleEntries(symbol)
+	hold := e.cfg.ForSymbol(symbol).HoldDuration
 	ps := e.positions[symbol]
 	kept := ps[:0]
+	var due []position
 	for _, p := range ps {
-		if time.Since(p.entryTime) < hold {
+		if e.clk.Now().Sub(p.entryTime) < hold {
 			kept = append(kept, p)
 			continue
 		}
-		pnl := 0.0
+		due = append(due, p)
+	}
+	e.positions[symbol] = kept
+	mid := last
+	if bid, ask := parseFloat(t.BestBid), parseFloat(t.BestAsk); bid > 0 && ask > 0 {
+		mid = (bid + ask) / 2
+	}
+	e.closeEntries(symbol, due, last, mid, true, report.ReasonHold)
+	e.updatePositionMetrics(symbol, last)
+}
+
+// settleEntries reads the fills of entries still being worked. An entry
+// that finished without a fill is dropped.
+func (e *Engine) settleEntries(symbol string) {
+	ps := e.positions[symbol]
+	kept := ps[:0]
+	for _, p := range ps {
+		if !p.done {
+			p = e.fillEntry(symbol, p)
+			if p.done && p.size <= 0 {
+				continue
+			}
+		}
+		kept = append(kept, p)
+	}
+	e.positions[symbol] = kept
+}
+
+// fillEntry updates p from the trader's fill of its entry order.
+func (e *Engine) fillEntry(symbol string, p position) position {
+	f, ok := e.tr.Fill(p.orderID)
+	if !ok {
+		return p
+	}
+	if f.Filled > 0 {
+		p.size = f.Filled
+		if f.AvgPrice > 0 {
+			p.entryPrice = f.AvgPrice
+		}
+	}
+	if !f.Done {
+		return p
+	}
+	p.done = true
+	kv := []string{logger.KSymbol, symbol, logger.KOrderID, p.orderID, logger.KSide, mapSide(p.side), logger.KOrderType, p.orderType}
+	if p.size <= 0 {
+		e.log.Info(logger.EvEntryFilled, append(kv, logger.KResult, "unfilled")...)
+		return p
+	}
+	e.log.Info(logger.EvEntryFilled, append(kv, logger.KFilled, strconv.FormatFloat(p.size, 'f', -1, 64), logger.KAvgPrice, strconv.FormatFloat(p.entryPrice, 'f', -1, 64))...)
+	return p
+}
+
+func (e *Engine) publishRisk() {
+	r := health.RiskState{Halted: e.halt != "", HaltReason: e.halt}
+	if !r.Halted && e.paused {
+		r.Halted, r.HaltReason = true, "paused"
+	}
+	for _, ps := range e.positions {
+		r.OpenPositions += len(ps)
+	}
+	for _, v := range e.realizedPnL {
+		r.RealizedPnL += v
+	}
+	e.health.SetRisk(r)
+}
+
+func (e *Engine) updatePositionMetrics(symbol string, last float64) {
+	upnl := 0.0
+	for _, p := range e.positions[symbol] {
 		if p.side == trader.Buy {
-			pnl = (last - p.entryPrice)
+			upnl += (last - p.entryPrice) * p.size
 		} else {
-			pnl = (p.entryPrice - last)
+			upnl += (p.entryPrice - last) * p.size
 		}
-		feeRate := e.feeRate(symbol, p.orderType)
-		fee := feeRate * p.entryPrice * p.size
-		pnlNet := pnl - fee
-		_ = e.tr.ClosePosition(symbol, p.side, "market", 0, p.size)
-		e.log.PnL("平仓收益", "币对", symbol, "方向", mapSide(p.side), "入场价", strconv.FormatFloat(p.entryPrice, 'f', 6, 64), "平仓价", strconv.FormatFloat(last, 'f', 6, 64), "毛利润", strconv.FormatFloat(pnl, 'f', 6, 64), "手续费", strconv.FormatFloat(fee, 'f', 6, 64), "净利润", strconv.FormatFloat(pnlNet, 'f', 6, 64), "类型", p.orderType)
-		e.realizedPnL[symbol] += pnlNet
-		e.closedCount[symbol]++
 	}
-	e.positions[symbol] = kept
+	e.m.OpenPositions.Set(float64(len(e.positions[symbol])), symbol)
+	e.m.UnrealizedPnL.Set(upnl, symbol)
+	e.m.RealizedPnL.Set(e.realizedPnL[symbol], symbol)
+}
+
+// closeEntries closes the entries ps of symbol. Entries that never filled
+// are dropped, and entries whose exchange-side stop or target already
+// fired are booked at that trigger price. The rest are netted into one
+// market close per side, booked by settleExits as far as the close fills.
+// Without send no close is sent and they are booked at last, the caller
+// closing the exchange position itself. mid is the arrival mid for tca.
+func (e *Engine) closeEntries(symbol string, ps []position, last, mid float64, send bool, reason string) {
+	bySide := make(map[trader.Side][]position)
+	for _, p := range ps {
+		// read the fill before and after the release, which stops an entry
+		// still being worked and may forget its fill
+		if !p.done {
+			p = e.fillEntry(symbol, p)
+		}
+		px, triggered := e.tr.Release(p.orderID)
+		if !p.done {
+			p = e.fillEntry(symbol, p)
+		}
+		if p.size <= 0 {
+			continue
+		}
+		if triggered {
+			e.realize(symbol, p, px, report.ReasonProtect)
+			continue
+		}
+		bySide[p.side] = append(bySide[p.side], p)
+	}
+	for _, side := range []trader.Side{trader.Buy, trader.Sell} {
+		open := bySide[side]
+		if len(open) == 0 {
+			continue
+		}
+		if !send {
+			e.realizeAll(symbol, open, last, reason)
+			continue
+		}
+		net := 0.0
+		for _, p := range open {
+			net += p.size
+		}
+		// the price is ignored for market closes; paper fills use it
+		o := e.tr.ClosePosition(symbol, side, "market", last, net)
+		switch o.Status {
+		case "no_position":
+			// closed outside the engine (stop, liquidation, manual); the
+			// entries are still booked so they stop counting as open
+			e.log.Info(logger.EvOrderClose, logger.KSymbol, symbol, logger.KSide, mapSide(side), logger.KResult, "no_position", logger.KCount, strconv.Itoa(len(open)))
+			e.realizeAll(symbol, open, last, reason)
+		case "error":
+			// still held: the entries stay open and are closed again on
+			// the next tick
+			e.positions[symbol] = append(e.positions[symbol], open...)
+		default:
+			e.track(tca.Leg{Symbol: symbol, Kind: tca.Exit, Buy: side == trader.Sell, OrderID: o.ID, OrderType: "market", Decision: last, Arrival: mid, Size: o.Size})
+			e.exits = append(e.exits, exit{symbol: symbol, orderID: o.ID, entries: open, last: last, reason: reason, sent: e.clk.Now()})
+		}
+	}
+	e.settleExits()
+}
+
+// exit is a close order sent for entries of one side.
+type exit struct {
+	symbol  string
+	orderID string
+	entries []position
+	last    float64 // booking price when the fill has no average
+	reason  string
+	sent    time.Time
+}
+
+// settleExits books every close order that has finished: its filled
+// quantity is spread over its entries, oldest first, at the fill price.
+// What it did not close goes back to the open entries, to be closed again.
+func (e *Engine) settleExits() {
+	kept := e.exits[:0]
+	for _, x := range e.exits {
+		f, ok := e.tr.Fill(x.orderID)
+		if !ok || !f.Done {
+			if ok && e.clk.Since(x.sent) < tcaMaxWait {
+				kept = append(kept, x)
+				continue
+			}
+			e.log.Info(logger.EvOrderClose, logger.KSymbol, x.symbol, logger.KOrderID, x.orderID, logger.KResult, "unsettled", logger.KCount, strconv.Itoa(len(x.entries)))
+			e.positions[x.symbol] = append(e.positions[x.symbol], x.entries...)
+			continue
+		}
+		px := f.AvgPrice
+		if px <= 0 {
+			px = x.last
+		}
+		left := f.Filled
+		for _, p := range x.entries {
+			q := math.Min(p.size, left)
+			if q > 0 {
+				closed := p
+				closed.size = q
+				e.realize(x.symbol, closed, px, x.reason)
+				left -= q
+			}
+			// what is left beyond rounding noise
+			if rest := p.size - q; rest > 1e-9*p.size {
+				p.size = rest
+				e.positions[x.symbol] = append(e.positions[x.symbol], p)
+			}
+		}
+	}
+	e.exits = kept
 }
 
-func pSize(p position) float64 { return p.size }
+// realizeAll books ps at last, when last is known.
+func (e *Engine) realizeAll(symbol string, ps []position, last float64, reason string) {
+	if last <= 0 {
+		return
+	}
+	for _, p := range ps {
+		e.realize(symbol, p, last, reason)
+	}
+}
+
+// protection is the exchange-side stop-loss/take-profit sp asks for.
+func (e *Engine) protection(symbol string, sp config.SymbolParams) trader.Protection {
+	var tick float64
+	if c, ok := e.contract(symbol); ok {
+		tick = parseFloat(c.TickSize)
+	}
+	return trader.Protection{StopLossBps: sp.StopLossBps, TakeProfitBps: sp.TakeProfitBps, Tick: tick}
+}
+
+// realize books the PnL of a position closed at last for reason; gross,
+// fee and net are all for the whole size.
+func (e *Engine) realize(symbol string, p position, last float64, reason string) {
+	pnl := 0.0
+	if p.side == trader.Buy {
+		pnl = (last - p.entryPrice) * p.size
+	} else {
+		pnl = (p.entryPrice - last) * p.size
+	}
+	feeRate := e.feeRate(symbol, p.orderType)
+	fee := feeRate * p.entryPrice * p.size
+	pnlNet := pnl - fee
+	e.log.PnL(logger.EvPositionClosed, logger.KSymbol, symbol, logger.KSide, mapSide(p.side), logger.KEntryPrice, strconv.FormatFloat(p.entryPrice, 'f', 6, 64), logger.KExitPrice, strconv.FormatFloat(last, 'f', 6, 64), logger.KGrossPnL, strconv.FormatFloat(pnl, 'f', 6, 64), logger.KFee, strconv.FormatFloat(fee, 'f', 6, 64), logger.KNetPnL, strconv.FormatFloat(pnlNet, 'f', 6, 64), logger.KOrderType, p.orderType,
+		logger.KSize, strconv.FormatFloat(p.size, 'f', -1, 64), logger.KEntryTime, p.entryTime.Format(time.RFC3339), logger.KReason, reason, logger.KPnLUnit, report.PnLUnit)
+	e.record(report.Trade{Symbol: symbol, Side: mapSide(p.side), Reason: reason, EntryTime: p.entryTime, ExitTime: e.clk.Now(), EntryPrice: p.entryPrice, ExitPrice: last, Size: p.size, Gross: pnl, Fee: fee, Net: pnlNet})
+	e.realizedPnL[symbol] += pnlNet
+	e.closedCount[symbol]++
+}
+
+// contract returns the exchange spec for symbol, fetched once and cached.
+func (e *Engine) contract(symbol string) (weex.Contract, bool) {
+	if c, ok := e.contracts[symbol]; ok {
+		return c, true
+	}
+	if e.client == nil {
+		return weex.Contract{}, false
+	}
+	cs, err := e.client.GetContracts(context.Background(), symbol)
+	if err != nil || len(cs) == 0 {
+		return weex.Contract{}, false
+	}
+	e.contracts[symbol] = cs[0]
+	return cs[0], true
+}
 
 func (e *Engine) feeRate(symbol, orderType string) float64 {
-	// try get metadata from contracts endpoint once per symbol
-	if cs, err := e.client.GetContracts(context.Background(), symbol); err == nil && len(cs) > 0 {
+	if c, ok := e.contract(symbol); ok {
 		// rates are strings; parse
-		mf := parseFloat(cs[0].MakerFeeRate)
-		tf := parseFloat(cs[0].TakerFeeRate)
-		if orderType == "market" {
+		mf := parseFloat(c.MakerFeeRate)
+		tf := parseFloat(c.TakerFeeRate)
+		if execution.Taker(orderType) {
 			if tf > 0 {
 				return tf
 			}
@@ -243,20 +611,35 @@ func (e *Engine) feeRate(symbol, orderType string) float64 {
 			}
 		}
 	}
-	if orderType == "market" {
+	if execution.Taker(orderType) {
 		return 0.0006
 	}
 	return 0.0002
 }
 
-func (e *Engine) adjustOrderSize(symbol string, suggested float64) float64 {
+// execAlgo picks the execution algorithm for an entry signal: exec_algo,
+// or exec_urgent_algo once |z| reaches exec_urgent_z.
+func (e *Engine) execAlgo(sp config.SymbolParams, z float64) string {
+	if e.cfg.ExecUrgentZ > 0 && math.Abs(z) >= e.cfg.ExecUrgentZ {
+		return e.cfg.ExecUrgentAlgo
+	}
+	return sp.ExecAlgo
+}
+
+// sizeStep is the contract size increment, 1 when unknown.
+func (e *Engine) sizeStep(symbol string) float64 {
 	inc := 0.0
-	if cs, err := e.client.GetContracts(context.Background(), symbol); err == nil && len(cs) > 0 {
-		inc = parseFloat(cs[0].SizeIncrement)
+	if c, ok := e.contract(symbol); ok {
+		inc = parseFloat(c.SizeIncrement)
 	}
 	if inc <= 0 {
 		inc = 1.0
 	}
+	return inc
+}
+
+func (e *Engine) adjustOrderSize(symbol string, suggested float64) float64 {
+	inc := e.sizeStep(symbol)
 	units := math.Max(1, math.Round(suggested/inc))
 	size := units * inc
 	min := e.cfg.MinSizeMap[symbol]
@@ -264,7 +647,7 @@ func (e *Engine) adjustOrderSize(symbol string, suggested float64) float64 {
 		units = math.Ceil(min / inc)
 		size = units * inc
 	}
-	e.log.Info("数量调整", "币对", symbol, "建议数量", strconv.FormatFloat(suggested, 'f', 6, 64), "步长", strconv.FormatFloat(inc, 'f', 6, 64), "最小数量", strconv.FormatFloat(min, 'f', 6, 64), "最终数量", strconv.FormatFloat(size, 'f', 6, 64))
+	e.log.Info(logger.EvSizeAdjust, logger.KSymbol, symbol, logger.KSuggestedSize, strconv.FormatFloat(suggested, 'f', 6, 64), logger.KSizeStep, strconv.FormatFloat(inc, 'f', 6, 64), logger.KMinSize, strconv.FormatFloat(min, 'f', 6, 64), logger.KFinalSize, strconv.FormatFloat(size, 'f', 6, 64))
 	return size
 }
 
@@ -277,11 +660,13 @@ func (e *Engine) printSummary() {
 	for _, v := range e.realizedPnL {
 		total += v
 	}
-	e.log.Metrics("汇总", "持仓数", strconv.Itoa(open), "累计净收益", strconv.FormatFloat(total, 'f', 6, 64))
+	e.log.Metrics(logger.EvSummary, logger.KOpenPositions, strconv.Itoa(open), logger.KCumNetPnL, strconv.FormatFloat(total, 'f', 6, 64))
+	e.logTCA()
+	e.logReport()
 	ctx := context.Background()
 	if pos, err := e.client.GetPositions(ctx); err == nil && len(pos) > 0 {
 		for _, p := range pos {
-			e.log.Metrics("持仓明细", "币对", p.Symbol, "方向", p.Side, "仓位数量", strconv.FormatFloat(p.Size, 'f', 6, 64), "杠杆", strconv.FormatFloat(p.Leverage, 'f', 2, 64))
+			e.log.Metrics(logger.EvPositionDetail, logger.KSymbol, p.Symbol, logger.KSide, p.Side, logger.KSize, strconv.FormatFloat(p.Size, 'f', 6, 64), logger.KLeverage, strconv.FormatFloat(p.Leverage, 'f', 2, 64))
 		}
 	} else {
 		for sym, ps := range e.positions {
@@ -295,17 +680,19 @@ func (e *Engine) printSummary() {
 				}
 			}
 			if longSize > 0 {
-				e.log.Metrics("持仓明细", "币对", sym, "方向", "long", "仓位数量", strconv.FormatFloat(longSize, 'f', 6, 64), "杠杆", "n/a")
+				e.log.Metrics(logger.EvPositionDetail, logger.KSymbol, sym, logger.KSide, "long", logger.KSize, strconv.FormatFloat(longSize, 'f', 6, 64), logger.KLeverage, "n/a")
 			}
 			if shortSize > 0 {
-				e.log.Metrics("持仓明细", "币对", sym, "方向", "short", "仓位数量", strconv.FormatFloat(shortSize, 'f', 6, 64), "杠杆", "n/a")
+				e.log.Metrics(logger.EvPositionDetail, logger.KSymbol, sym, logger.KSide, "short", logger.KSize, strconv.FormatFloat(shortSize, 'f', 6, 64), logger.KLeverage, "n/a")
 			}
 		}
 	}
 }
-func (e *Engine) flattenExistingPositions(ctx context.Context) {
+
+func (e *Engine) flattenExistingPositions(ctx context.Context, reason string) {
 	pos, err := e.client.GetPositions(ctx)
-	if err != nil || len(pos) == 0 {
+	if err != nil {
+		e.log.Error(logger.EvFlatten, logger.KReason, reason, logger.KErr, err.Error())
 		return
 	}
 	for _, p := range pos {
@@ -315,8 +702,15 @@ func (e *Engine) flattenExistingPositions(ctx context.Context) {
 		} else {
 			side = trader.Sell
 		}
-		_ = e.tr.ClosePosition(p.Symbol, side, "market", 0, p.Size)
-		e.log.Trade("启动_一键平仓", "币对", p.Symbol, "方向", strings.ToLower(p.Side), "数量", strconv.FormatFloat(p.Size, 'f', 6, 64))
+		var last float64
+		if st := e.states[p.Symbol]; st != nil {
+			last = st.lastPrice
+		}
+		o := e.tr.ClosePosition(p.Symbol, side, "market", last, p.Size)
+		if o.Status != "error" && o.Status != "no_position" && last > 0 {
+			e.track(tca.Leg{Symbol: p.Symbol, Kind: tca.Exit, Buy: side == trader.Sell, OrderID: o.ID, OrderType: "market", Decision: last, Arrival: last, Size: o.Size})
+		}
+		e.log.Trade(logger.EvFlatten, logger.KReason, reason, logger.KSymbol, p.Symbol, logger.KSide, strings.ToLower(p.Side), logger.KSize, strconv.FormatFloat(p.Size, 'f', 6, 64))
 	}
 }
 
@@ -324,14 +718,14 @@ func (e *Engine) logStartupSnapshot(ctx context.Context) {
 	avail, eq, err := e.client.GetCollateralUSDT(ctx)
 	if err == nil {
 		if avail > 0 || eq > 0 {
-			e.log.Metrics("metrics_start", "equity_usdt", strconv.FormatFloat(eq, 'f', 6, 64), "available_usdt", strconv.FormatFloat(avail, 'f', 6, 64))
+			e.log.Metrics(logger.EvMetricsStart, logger.KEquityUSDT, strconv.FormatFloat(eq, 'f', 6, 64), logger.KAvailableUSDT, strconv.FormatFloat(avail, 'f', 6, 64))
 		} else {
-			e.log.Metrics("metrics_start", "equity_usdt", "unknown", "available_usdt", "unknown")
+			e.log.Metrics(logger.EvMetricsStart, logger.KEquityUSDT, "unknown", logger.KAvailableUSDT, "unknown")
 		}
 	}
 	if pos, err := e.client.GetPositions(ctx); err == nil {
 		for _, p := range pos {
-			e.log.Metrics("metrics_start_position", "symbol", p.Symbol, "side", p.Side, "size", strconv.FormatFloat(p.Size, 'f', 6, 64), "leverage", strconv.FormatFloat(p.Leverage, 'f', 2, 64))
+			e.log.Metrics(logger.EvMetricsStartPosition, logger.KSymbol, p.Symbol, logger.KSide, p.Side, logger.KSize, strconv.FormatFloat(p.Size, 'f', 6, 64), logger.KLeverage, strconv.FormatFloat(p.Leverage, 'f', 2, 64))
 		}
 	}
 }
@@ -0,0 +1,208 @@
+package strategy
+
+import (
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/weex/ai_trading/bot/internal/clock"
+	"github.com/weex/ai_trading/bot/internal/config"
+	"github.com/weex/ai_trading/bot/internal/logger"
+	"github.com/weex/ai_trading/bot/internal/trader"
+	"github.com/weex/ai_trading/bot/internal/weex"
+)
+
+const sym = "cmt_btcusdt"
+
+// newTestEngine builds an engine on the mock trader and a manual clock,
+// with a one-minute basis window sampled every second; edit, if not nil,
+// adjusts the config.
+func newTestEngine(t *testing.T, edit func(*config.Config)) (*Engine, *clock.Manual) {
+	t.Helper()
+	cfg := config.Defaults()
+	cfg.Symbols = []string{sym}
+	cfg.BasisWindow = time.Minute
+	cfg.BasisStep = time.Second
+	if edit != nil {
+		edit(&cfg)
+	}
+	clk := clock.NewManual(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	log := logger.New(logger.Config{Dir: t.TempDir(), Clock: clk})
+	t.Cleanup(log.Close)
+	e := NewEngine(cfg, nil, trader.NewMock(log, clk), log, nil, nil, clk)
+	e.noDepth = true
+	return e, clk
+}
+
+// bar feeds one tick at the current clock time with mark = index*(1+dev).
+func bar(e *Engine, dev float64) {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	const index = 100.0
+	mark := index * (1 + dev)
+	t := weex.Ticker{Symbol: sym, Last: f(mark), BestBid: f(mark - 0.01), BestAsk: f(mark + 0.01), MarkPrice: f(mark), IndexPrice: f(index)}
+	d := weex.DepthResp{Asks: [][]string{{t.BestAsk, "0"}}, Bids: [][]string{{t.BestBid, "0"}}}
+	e.evaluateAndTrade(sym, t, weex.IndexResp{Symbol: sym, Index: f(index)}, d, "0")
+	e.evaluatePnL(sym, t)
+}
+
+// quiet advances the clock d one second at a time, feeding a basis that
+// alternates around zero and never crosses the z threshold.
+func quiet(e *Engine, clk *clock.Manual, d time.Duration) {
+	for i := 0; i < int(d/time.Second); i++ {
+		clk.Advance(time.Second)
+		dev := 0.0001
+		if clk.Now().Unix()%2 == 0 {
+			dev = -dev
+		}
+		bar(e, dev)
+	}
+}
+
+// spike advances one second and feeds a deviation far outside the window.
+func spike(e *Engine, clk *clock.Manual) {
+	clk.Advance(time.Second)
+	bar(e, 0.002)
+}
+
+func TestCooldown(t *testing.T) {
+	e, clk := newTestEngine(t, nil)
+	quiet(e, clk, time.Minute)
+	spike(e, clk)
+	if n := len(e.positions[sym]); n != 1 {
+		t.Fatalf("positions after first spike = %d, want 1", n)
+	}
+	quiet(e, clk, 30*time.Second)
+	spike(e, clk)
+	if n := len(e.positions[sym]); n != 1 {
+		t.Fatalf("positions after spike inside cooldown = %d, want 1", n)
+	}
+	quiet(e, clk, 30*time.Second)
+	spike(e, clk)
+	if n := len(e.positions[sym]); n != 2 {
+		t.Fatalf("positions after cooldown = %d, want 2", n)
+	}
+}
+
+func TestHoldDurationExpiry(t *testing.T) {
+	e, clk := newTestEngine(t, nil)
+	quiet(e, clk, time.Minute)
+	spike(e, clk)
+	if n := len(e.positions[sym]); n != 1 {
+		t.Fatalf("positions after spike = %d, want 1", n)
+	}
+	entry := e.positions[sym][0].entryTime
+	hold := e.cfg.HoldDuration
+	quiet(e, clk, hold-time.Second)
+	if n := len(e.positions[sym]); n != 1 || e.closedCount[sym] != 0 {
+		t.Fatalf("%s after entry: %d open, %d closed, want 1 open", clk.Since(entry), n, e.closedCount[sym])
+	}
+	quiet(e, clk, time.Second)
+	if n := len(e.positions[sym]); n != 0 || e.closedCount[sym] != 1 {
+		t.Fatalf("%s after entry: %d open, %d closed, want 1 closed", clk.Since(entry), n, e.closedCount[sym])
+	}
+	if len(e.closed) != 1 || !e.closed[0].ExitTime.Equal(entry.Add(hold)) {
+		t.Fatalf("closed trades = %+v, want one exit at %s", e.closed, entry.Add(hold))
+	}
+}
+
+func TestEntryTakesItsFill(t *testing.T) {
+	e, clk := newTestEngine(t, nil)
+	quiet(e, clk, time.Minute)
+	spike(e, clk)
+	p := e.positions[sym][0]
+	if p.done || p.size != 0 {
+		t.Fatalf("entry before its fill: done %v size %v, want nothing held", p.done, p.size)
+	}
+	// paper entries fill whole at the order price, the ask for a short
+	quiet(e, clk, 2*time.Second)
+	p = e.positions[sym][0]
+	o, _ := e.tr.(*trader.Mock).GetOrder(p.orderID)
+	if want := 100*1.002 + 0.01; !p.done || p.size != o.Size || math.Abs(p.entryPrice-want) > 1e-9 {
+		t.Fatalf("entry = %+v, want done %v @ %v", p, o.Size, want)
+	}
+}
+
+func TestUnfilledEntryDropped(t *testing.T) {
+	e, clk := newTestEngine(t, func(c *config.Config) { c.HoldDuration = time.Second })
+	quiet(e, clk, time.Minute)
+	spike(e, clk)
+	if n := len(e.positions[sym]); n != 1 {
+		t.Fatalf("positions after spike = %d, want 1", n)
+	}
+	// the hold ends before the paper fill: the entry is cancelled and
+	// nothing is booked
+	quiet(e, clk, time.Second)
+	if n := len(e.positions[sym]); n != 0 || e.closedCount[sym] != 0 || len(e.closed) != 0 {
+		t.Fatalf("%d open, %d closed, want the entry dropped unbooked", n, e.closedCount[sym])
+	}
+}
+
+// partialCloser fills each close order with at most its next closes
+// entry; entries are the mock's paper fills.
+type partialCloser struct {
+	*trader.Mock
+	closes []float64
+	fills  map[string]trader.Fill
+	seq    int
+}
+
+func (c *partialCloser) ClosePosition(symbol string, side trader.Side, orderType string, price, size float64) trader.Order {
+	c.seq++
+	id := "close-" + strconv.Itoa(c.seq)
+	q := math.Min(size, c.closes[0])
+	c.closes = c.closes[1:]
+	c.fills[id] = trader.Fill{Filled: q, AvgPrice: price, Done: true}
+	return trader.Order{ID: id, Symbol: symbol, Side: side, OrderType: orderType, Price: price, Size: size, Status: "new"}
+}
+
+func (c *partialCloser) Fill(orderID string) (trader.Fill, bool) {
+	if f, ok := c.fills[orderID]; ok {
+		return f, true
+	}
+	return c.Mock.Fill(orderID)
+}
+
+func TestCloseBooksOnlyItsFill(t *testing.T) {
+	e, clk := newTestEngine(t, nil)
+	pc := &partialCloser{Mock: e.tr.(*trader.Mock), fills: make(map[string]trader.Fill)}
+	e.tr = pc
+	quiet(e, clk, time.Minute)
+	spike(e, clk)
+	quiet(e, clk, 2*time.Second)
+	size := e.positions[sym][0].size
+	pc.closes = []float64{size / 4, size}
+	quiet(e, clk, e.cfg.HoldDuration-2*time.Second)
+	if len(e.closed) != 1 || math.Abs(e.closed[0].Size-size/4) > 1e-12 {
+		t.Fatalf("closed = %+v, want a quarter of %v booked", e.closed, size)
+	}
+	if ps := e.positions[sym]; len(ps) != 1 || math.Abs(ps[0].size-size*3/4) > 1e-12 {
+		t.Fatalf("open = %+v, want the rest still open", ps)
+	}
+	// the rest is due at once and closed on the next tick
+	quiet(e, clk, time.Second)
+	if len(e.closed) != 2 || len(e.positions[sym]) != 0 || math.Abs(e.closed[1].Size-size*3/4) > 1e-12 {
+		t.Fatalf("closed = %+v, open = %+v; want the rest booked", e.closed, e.positions[sym])
+	}
+}
+
+func TestBasisOutlierFollowsLastingShift(t *testing.T) {
+	e, clk := newTestEngine(t, func(c *config.Config) { c.BasisOutlierZ = 4 })
+	quiet(e, clk, time.Minute)
+	st := e.states[sym]
+	n := st.basis.count()
+	spike(e, clk)
+	if len(e.positions[sym]) != 0 {
+		t.Fatal("traded on an outlier")
+	}
+	if st.basis.count() != n+1 {
+		t.Fatalf("samples = %d, want the outlier kept clipped (%d)", st.basis.count(), n+1)
+	}
+	// the basis stays at the new level: the estimate follows it
+	for i := 0; i < 120; i++ {
+		spike(e, clk)
+	}
+	if m, _ := st.basis.meanStd(); math.Abs(m-0.002) > 1e-4 {
+		t.Fatalf("basis mean = %v after a lasting shift to 0.002", m)
+	}
+}
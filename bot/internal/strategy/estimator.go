@@ -0,0 +1,195 @@
+package strategy
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/weex/ai_trading/bot/internal/config"
+)
+
+// estimator tracks the centre and scale of the basis series; z is
+// (basis - centre) / scale.
+type estimator interface {
+	push(t time.Time, v float64)
+	meanStd() (float64, float64)
+	count() int
+}
+
+// newEstimator builds the estimator sp.BasisEstimator names, fed on a
+// time grid of sp.BasisStep covering sp.BasisWindow.
+func newEstimator(sp config.SymbolParams) *grid {
+	n := 120
+	if sp.BasisStep > 0 && sp.BasisWindow >= sp.BasisStep {
+		n = int(sp.BasisWindow / sp.BasisStep)
+	}
+	g := &grid{step: sp.BasisStep, maxGap: sp.BasisMaxGap, slots: n}
+	switch sp.BasisEstimator {
+	case "ewma":
+		g.est = &ewma{halfLife: sp.BasisHalfLife}
+	case "robust":
+		g.est = newRobust(n)
+	default:
+		g.est = newSeries(n)
+	}
+	return g
+}
+
+// grid resamples ticks onto fixed slots of step so the window means the
+// same span of time at any polling rate. The last sample in a slot wins;
+// a slot enters the estimate once the clock has moved past it. Empty slots
+// after a gap up to maxGap repeat the previous value; a longer gap means
+// the history no longer describes the present and is dropped. Since every
+// slot is filled in order, the fixed-size buffers inside the estimators
+// evict by age.
+type grid struct {
+	step   time.Duration
+	maxGap time.Duration
+	slots  int
+	est    estimator
+	slot   int64
+	val    float64
+	have   bool
+}
+
+// push records v at t and reports whether a gap reset the history.
+func (g *grid) push(t time.Time, v float64) bool {
+	s := int64(0)
+	if g.step > 0 {
+		s = t.UnixNano() / int64(g.step)
+	}
+	if !g.have || s <= g.slot {
+		if !g.have {
+			g.slot = s
+		}
+		g.val, g.have = v, true
+		return false
+	}
+	g.est.push(g.slotTime(g.slot), g.val)
+	missing := s - g.slot - 1
+	reset := time.Duration(missing)*g.step > g.maxGap
+	if reset {
+		g.est = g.fresh()
+	} else {
+		for i := int64(1); i <= missing && i <= int64(g.slots); i++ {
+			g.est.push(g.slotTime(g.slot+i), g.val)
+		}
+	}
+	g.slot, g.val = s, v
+	return reset
+}
+
+func (g *grid) slotTime(s int64) time.Time { return time.Unix(0, s*int64(g.step)) }
+
+// fresh returns an empty estimator of the same kind and size.
+func (g *grid) fresh() estimator {
+	switch e := g.est.(type) {
+	case *ewma:
+		return &ewma{halfLife: e.halfLife}
+	case *robust:
+		return newRobust(g.slots)
+	}
+	return newSeries(g.slots)
+}
+
+// meanStd covers completed slots only, so the current tick is scored
+// against history rather than against itself.
+func (g *grid) meanStd() (float64, float64) { return g.est.meanStd() }
+
+// count is the number of completed slots in the estimate.
+func (g *grid) count() int {
+	if n := g.est.count(); n < g.slots {
+		return n
+	}
+	return g.slots
+}
+
+// warm reports whether at least half the window is covered.
+func (g *grid) warm() bool { return 2*g.count() >= g.slots }
+
+// ewma weights samples by age: one half-life ago counts half as much as
+// now. Spacing between samples comes from their timestamps, so a change of
+// polling rate does not change the effective lookback.
+type ewma struct {
+	halfLife time.Duration
+	last     time.Time
+	mean     float64
+	vr       float64
+	n        int
+}
+
+func (e *ewma) push(t time.Time, v float64) {
+	if e.n == 0 {
+		e.mean, e.vr, e.last, e.n = v, 0, t, 1
+		return
+	}
+	dt := t.Sub(e.last)
+	if dt <= 0 {
+		// same timestamp (e.g. a backtest bar replayed): count as one step
+		// of a nanosecond so the sample still contributes
+		dt = 1
+	}
+	a := 1 - math.Exp2(-float64(dt)/float64(e.halfLife))
+	d := v - e.mean
+	e.mean += a * d
+	e.vr = (1 - a) * (e.vr + a*d*d)
+	e.last = t
+	e.n++
+}
+
+func (e *ewma) meanStd() (float64, float64) { return e.mean, math.Sqrt(e.vr) }
+func (e *ewma) count() int                  { return e.n }
+
+// robust uses the median and the median absolute deviation over the
+// window, scaled by 1.4826 so it matches the std for normal data. A few bad
+// prints move neither.
+type robust struct {
+	ring   []float64
+	sorted []float64
+	dev    []float64
+	i      int
+}
+
+func newRobust(n int) *robust {
+	return &robust{ring: make([]float64, 0, n), sorted: make([]float64, 0, n), dev: make([]float64, n)}
+}
+
+func (r *robust) push(_ time.Time, v float64) {
+	if len(r.ring) < cap(r.ring) {
+		r.ring = append(r.ring, v)
+	} else {
+		old := r.ring[r.i]
+		r.ring[r.i] = v
+		r.i = (r.i + 1) % len(r.ring)
+		k := sort.SearchFloat64s(r.sorted, old)
+		r.sorted = append(r.sorted[:k], r.sorted[k+1:]...)
+	}
+	k := sort.SearchFloat64s(r.sorted, v)
+	r.sorted = append(r.sorted, 0)
+	copy(r.sorted[k+1:], r.sorted[k:])
+	r.sorted[k] = v
+}
+
+func (r *robust) meanStd() (float64, float64) {
+	n := len(r.sorted)
+	if n == 0 {
+		return 0, 0
+	}
+	med := median(r.sorted)
+	dev := r.dev[:n]
+	for i, x := range r.sorted {
+		dev[i] = math.Abs(x - med)
+	}
+	sort.Float64s(dev)
+	return med, 1.4826 * median(dev)
+}
+
+func (r *robust) count() int { return len(r.sorted) }
+
+func median(sorted []float64) float64 {
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
@@ -0,0 +1,128 @@
+package strategy
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	"github.com/weex/ai_trading/bot/internal/config"
+	"github.com/weex/ai_trading/bot/internal/logger"
+)
+
+// Reload applies the reloadable part of next to the running engine in one
+// step on the engine goroutine and logs every difference. Refused changes
+// are logged but leave the running value untouched.
+func (e *Engine) Reload(ctx context.Context, next config.Config) ([]config.Change, error) {
+	var changes []config.Change
+	err := e.Do(ctx, func() {
+		var merged config.Config
+		merged, changes = config.Merge(e.cfg, next)
+		if len(changes) == 0 {
+			return
+		}
+		prev := e.cfg
+		e.cfg = merged
+		e.applySymbols(prev.Symbols)
+		// new symbols, and symbols whose leverage or margin mode changed,
+		// globally or in an override, go through the same account check
+		// as at startup
+		had := make(map[string]bool, len(prev.Symbols))
+		for _, s := range prev.Symbols {
+			had[s] = true
+		}
+		var setup []string
+		for _, s := range e.cfg.Symbols {
+			was, now := prev.ForSymbol(s), e.cfg.ForSymbol(s)
+			if !had[s] {
+				setup = append(setup, s)
+				continue
+			}
+			changed := false
+			if was.Leverage != now.Leverage {
+				e.log.Info(logger.EvConfigReload, logger.KSymbol, s, logger.KField, "leverage", logger.KBefore, strconv.FormatFloat(was.Leverage, 'f', -1, 64), logger.KAfter, strconv.FormatFloat(now.Leverage, 'f', -1, 64), logger.KResult, "applied")
+				changed = true
+			}
+			if was.MarginMode != now.MarginMode {
+				e.log.Info(logger.EvConfigReload, logger.KSymbol, s, logger.KField, "margin_mode", logger.KBefore, was.MarginMode, logger.KAfter, now.MarginMode, logger.KResult, "applied")
+				changed = true
+			}
+			if changed {
+				setup = append(setup, s)
+			}
+		}
+		e.setupAccount(ctx, setup)
+		for sym, st := range e.states {
+			sp := e.cfg.ForSymbol(sym)
+			st.cooldown = sp.Cooldown
+			// open positions follow new stop/target distances
+			if was := prev.ForSymbol(sym); was.StopLossBps != sp.StopLossBps || was.TakeProfitBps != sp.TakeProfitBps {
+				for _, p := range e.positions[sym] {
+					e.tr.Protect(p.orderID, e.protection(sym, sp))
+				}
+			}
+			if st.applyBasis(sp) {
+				e.log.Info(logger.EvConfigReload, logger.KSymbol, sym, logger.KField, "basis", logger.KAfter, sp.BasisEstimator+" window="+sp.BasisWindow.String()+" step="+sp.BasisStep.String(), logger.KMsg, "basis history reset")
+			}
+		}
+		if e.ticker != nil && prev.QueryInterval != e.cfg.QueryInterval {
+			e.ticker.Reset(e.cfg.QueryInterval)
+		}
+		if e.summary != nil && prev.MetricsInterval != e.cfg.MetricsInterval {
+			e.summary.Reset(e.cfg.MetricsInterval)
+		}
+		for _, ch := range changes {
+			result := "applied"
+			if !ch.Safe {
+				result = "refused_restart_required"
+			}
+			e.log.Info(logger.EvConfigReload, logger.KField, ch.Field, logger.KBefore, ch.Old, logger.KAfter, ch.New, logger.KResult, result)
+		}
+		e.publishRisk()
+	})
+	return changes, err
+}
+
+// applySymbols brings states and the active set in line with cfg.Symbols.
+// Removed symbols stop taking entries but keep being polled until their
+// open positions have been closed.
+func (e *Engine) applySymbols(prev []string) {
+	e.active = make(map[string]bool, len(e.cfg.Symbols))
+	for _, s := range e.cfg.Symbols {
+		e.active[s] = true
+		if e.states[s] == nil {
+			e.states[s] = newSymbolState(e.cfg.ForSymbol(s))
+		}
+	}
+	for _, s := range prev {
+		if !e.active[s] && len(e.positions[s]) == 0 {
+			e.dropSymbol(s)
+		}
+	}
+	e.health.SetSymbols(e.cfg.Symbols)
+}
+
+func (e *Engine) dropSymbol(s string) {
+	delete(e.states, s)
+	delete(e.pausedSyms, s)
+	delete(e.blocked, s)
+	e.m.Basis.Delete(s)
+	e.m.ZScore.Delete(s)
+	e.m.FundingRate.Delete(s)
+}
+
+// tickSymbols is the configured symbols plus removed ones still draining.
+func (e *Engine) tickSymbols() []string {
+	out := append([]string(nil), e.cfg.Symbols...)
+	var draining []string
+	for s, ps := range e.positions {
+		if !e.active[s] {
+			if len(ps) > 0 {
+				draining = append(draining, s)
+			} else if e.states[s] != nil {
+				e.dropSymbol(s)
+			}
+		}
+	}
+	sort.Strings(draining)
+	return append(out, draining...)
+}
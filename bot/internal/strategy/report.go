@@ -0,0 +1,43 @@
+package strategy
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/weex/ai_trading/bot/internal/logger"
+	"github.com/weex/ai_trading/bot/internal/report"
+)
+
+// maxClosed bounds the closed trades kept for the live report; older ones
+// are still in the pnl logs.
+const maxClosed = 50000
+
+func (e *Engine) record(t report.Trade) {
+	e.closed = append(e.closed, t)
+	if n := len(e.closed); n > maxClosed {
+		e.closed = append(e.closed[:0], e.closed[n-maxClosed:]...)
+	}
+}
+
+// Report computes the performance report of the trades closed since start.
+func (e *Engine) Report(ctx context.Context, opt report.Options) (report.Report, error) {
+	var r report.Report
+	err := e.Do(ctx, func() { r = report.New(e.closed, opt) })
+	return r, err
+}
+
+func (e *Engine) logReport() {
+	r := report.New(e.closed, report.Options{})
+	if r.Total.Trades == 0 {
+		return
+	}
+	for _, s := range r.Groups() {
+		e.log.Metrics(logger.EvReport, logger.KGroup, s.Group, logger.KKey, s.Key, logger.KTrades, strconv.Itoa(s.Trades), logger.KWinRate, fmtRatio(s.WinRate),
+			logger.KNetPnL, strconv.FormatFloat(s.Net, 'f', 6, 64), logger.KFee, strconv.FormatFloat(s.Fees, 'f', 6, 64),
+			logger.KAvgWin, strconv.FormatFloat(s.AvgWin, 'f', 6, 64), logger.KAvgLoss, strconv.FormatFloat(s.AvgLoss, 'f', 6, 64), logger.KProfitFactor, fmtRatio(s.ProfitFactor),
+			logger.KMaxDrawdown, strconv.FormatFloat(s.MaxDrawdown, 'f', 6, 64), logger.KSharpe, fmtRatio(s.Sharpe), logger.KSortino, fmtRatio(s.Sortino),
+			logger.KTurnover, strconv.FormatFloat(s.Turnover, 'f', 2, 64), logger.KExposure, fmtRatio(s.Exposure))
+	}
+}
+
+func fmtRatio(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) }
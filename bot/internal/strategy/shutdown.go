@@ -0,0 +1,85 @@
+package strategy
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/weex/ai_trading/bot/internal/logger"
+)
+
+const (
+	ShutdownNone    = "none"
+	ShutdownCancel  = "cancel"
+	ShutdownFlatten = "flatten"
+)
+
+type ShutdownSummary struct {
+	Action        string
+	OpenPositions int
+	Closed        int
+	RealizedPnL   float64
+	Elapsed       time.Duration
+}
+
+// Shutdown runs after Run has returned. It waits for in-flight orders, then
+// applies cfg.ShutdownAction: "cancel" cancels resting orders, "flatten"
+// cancels and closes every position. ctx bounds the whole sequence.
+func (e *Engine) Shutdown(ctx context.Context) ShutdownSummary {
+	start := e.clk.Now()
+	action := strings.ToLower(e.cfg.ShutdownAction)
+	if action != ShutdownCancel && action != ShutdownFlatten {
+		action = ShutdownNone
+	}
+	e.log.Info(logger.EvShutdown, logger.KAction, action)
+	e.halt = "shutdown"
+	e.publishRisk()
+	if err := e.tr.Wait(ctx); err != nil {
+		e.log.Error(logger.EvShutdown, logger.KAction, action, logger.KErr, err.Error())
+	}
+	if action == ShutdownCancel || action == ShutdownFlatten {
+		_ = e.tr.CancelAll("")
+	}
+	if action == ShutdownFlatten {
+		e.flattenAll(ctx, "shutdown")
+	}
+	e.settleExits()
+	e.settleTCA()
+	e.printSummary()
+	e.publishRisk()
+
+	sum := ShutdownSummary{Action: action, Elapsed: e.clk.Since(start)}
+	for _, ps := range e.positions {
+		sum.OpenPositions += len(ps)
+	}
+	for sym, v := range e.realizedPnL {
+		sum.RealizedPnL += v
+		sum.Closed += e.closedCount[sym]
+	}
+	e.log.Info(logger.EvShutdownSummary, logger.KAction, sum.Action, logger.KOpenPositions, strconv.Itoa(sum.OpenPositions), logger.KClosedCount, strconv.Itoa(sum.Closed), logger.KCumNetPnL, strconv.FormatFloat(sum.RealizedPnL, 'f', 6, 64), logger.KElapsed, sum.Elapsed.String())
+	return sum
+}
+
+// flattenAll closes every tracked position. In real mode the exchange is the
+// source of truth, so once the entries are released its positions are
+// closed and the entries only booked at the last seen price; in mock mode
+// the entries are netted per side and closed through the trader.
+func (e *Engine) flattenAll(ctx context.Context, reason string) {
+	live := strings.ToLower(e.cfg.TraderMode) == "real"
+	for sym, ps := range e.positions {
+		var last float64
+		if st := e.states[sym]; st != nil {
+			last = st.lastPrice
+		}
+		e.closeEntries(sym, ps, last, last, !live, reason)
+		e.positions[sym] = nil
+		e.updatePositionMetrics(sym, last)
+	}
+	// after the releases, so no working entry adds to a position being
+	// closed and no stop is mistaken for triggered by the close
+	if live {
+		e.flattenExistingPositions(ctx, reason)
+	}
+	_ = e.tr.Wait(ctx)
+}
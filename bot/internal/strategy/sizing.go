@@ -0,0 +1,74 @@
+package strategy
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/weex/ai_trading/bot/internal/config"
+	"github.com/weex/ai_trading/bot/internal/logger"
+	"github.com/weex/ai_trading/bot/internal/sizing"
+)
+
+// equityTTL is how long a fetched account equity is reused for sizing.
+const equityTTL = time.Minute
+
+// equityTimeout bounds an equity refresh; it runs on the engine goroutine.
+const equityTimeout = 3 * time.Second
+
+// sizeFor computes the raw entry size with the configured sizing method
+// and logs the inputs. ok is false when the method lacks an input; the
+// entry is skipped rather than sized some other way.
+func (e *Engine) sizeFor(symbol string, sp config.SymbolParams, st *symbolState, z, price float64) (float64, bool) {
+	p := sizing.Params{
+		Method:         e.cfg.SizingMethod,
+		BaseSize:       sp.BaseSize,
+		RiskPerTrade:   e.cfg.RiskPerTrade,
+		EquityFraction: e.cfg.EquityFraction,
+		Leverage:       sp.Leverage,
+		Hold:           sp.HoldDuration,
+	}
+	in := sizing.Inputs{Price: price, Z: z}
+	if p.Method != sizing.Fixed {
+		in.Equity = e.equity()
+		in.VolPerSec, _ = st.vol.PerSecond()
+	}
+	size, err := sizing.Size(p, in)
+	kv := []string{logger.KSymbol, symbol, logger.KMethod, p.Method, logger.KZ, strconv.FormatFloat(z, 'f', 3, 64), logger.KPrice, strconv.FormatFloat(price, 'f', -1, 64)}
+	if p.Method != sizing.Fixed {
+		kv = append(kv,
+			logger.KEquityUSDT, strconv.FormatFloat(in.Equity, 'f', 2, 64),
+			logger.KLeverage, strconv.FormatFloat(p.Leverage, 'f', -1, 64),
+			logger.KVolPerSec, strconv.FormatFloat(in.VolPerSec, 'g', 6, 64),
+			logger.KRiskPerTrade, strconv.FormatFloat(p.RiskPerTrade, 'f', -1, 64))
+	}
+	if err != nil {
+		e.log.Info(logger.EvSizing, append(kv, logger.KErr, err.Error())...)
+		e.m.OrdersRejected.Inc(symbol, "sizing")
+		return 0, false
+	}
+	e.log.Info(logger.EvSizing, append(kv, logger.KSuggestedSize, strconv.FormatFloat(size, 'f', 6, 64))...)
+	return size, true
+}
+
+// equity returns sizing_equity when set, otherwise the account equity,
+// refreshed at most once per equityTTL. A failed or timed-out refresh
+// keeps the last known value.
+func (e *Engine) equity() float64 {
+	if e.cfg.SizingEquity > 0 {
+		return e.cfg.SizingEquity
+	}
+	if e.client == nil || (!e.equityAt.IsZero() && e.clk.Since(e.equityAt) < equityTTL) {
+		return e.equityUSDT
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), equityTimeout)
+	defer cancel()
+	_, eq, err := e.client.GetCollateralUSDT(ctx)
+	e.equityAt = e.clk.Now()
+	if err != nil {
+		e.log.Error(logger.EvSizing, logger.KErr, err.Error())
+		return e.equityUSDT
+	}
+	e.equityUSDT = eq
+	return eq
+}
@@ -3,37 +3,89 @@ package strategy
 import (
     "math"
     "time"
+    "github.com/weex/ai_trading/bot/internal/config"
+    "github.com/weex/ai_trading/bot/internal/sizing"
 )
 
+// series is a fixed-size window of equally weighted samples. Running sums
+// make each update O(1); they are rebuilt from the buffer once per lap so
+// rounding error cannot accumulate.
 type series struct {
     buf []float64
     i   int
     n   int
+    sum   float64
+    sumSq float64
 }
 
 func newSeries(cap int) *series { return &series{buf: make([]float64, cap)} }
 
-func (s *series) push(v float64) {
-    s.buf[s.i%len(s.buf)] = v
+func (s *series) push(_ time.Time, v float64) {
+    k := s.i % len(s.buf)
+    if s.n == len(s.buf) {
+        old := s.buf[k]
+        s.sum -= old
+        s.sumSq -= old * old
+    }
+    s.buf[k] = v
+    s.sum += v
+    s.sumSq += v * v
     s.i++
     if s.n < len(s.buf) { s.n++ }
+    if s.i%len(s.buf) == 0 {
+        s.sum, s.sumSq = 0, 0
+        for j := 0; j < s.n; j++ { s.sum += s.buf[j]; s.sumSq += s.buf[j] * s.buf[j] }
+    }
 }
 
 func (s *series) meanStd() (float64, float64) {
     if s.n == 0 { return 0, 0 }
-    sum := 0.0
-    for i := 0; i < s.n; i++ { sum += s.buf[i] }
-    m := sum / float64(s.n)
-    vs := 0.0
-    for i := 0; i < s.n; i++ { d := s.buf[i]-m; vs += d*d }
-    std := math.Sqrt(vs / float64(s.n))
-    return m, std
+    m := s.sum / float64(s.n)
+    vr := s.sumSq/float64(s.n) - m*m
+    if vr < 0 { vr = 0 }
+    return m, math.Sqrt(vr)
 }
 
+func (s *series) count() int { return s.n }
+
 type symbolState struct {
-    basis *series
+    basis       *grid
+    basisSpec   basisSpec
     lastTrigger time.Time
     cooldown    time.Duration
+    lastPrice   float64
+    vol         sizing.Tracker
+}
+
+func newSymbolState(sp config.SymbolParams) *symbolState {
+    st := &symbolState{cooldown: sp.Cooldown}
+    st.resetBasis(sp)
+    return st
+}
+
+// basisSpec is what shapes the basis history; changing any of it starts
+// the history over.
+type basisSpec struct {
+    kind   string
+    window time.Duration
+    step   time.Duration
+}
+
+// resetBasis starts a fresh estimator of the kind sp selects.
+func (st *symbolState) resetBasis(sp config.SymbolParams) {
+    st.basis = newEstimator(sp)
+    st.basisSpec = basisSpec{sp.BasisEstimator, sp.BasisWindow, sp.BasisStep}
 }
 
-func newSymbolState(cd time.Duration) *symbolState { return &symbolState{basis: newSeries(120), cooldown: cd} }
+// applyBasis follows a config change: a new estimator kind, window or
+// step starts over; a new EWMA half-life or max gap keeps the history. It
+// reports whether history was dropped.
+func (st *symbolState) applyBasis(sp config.SymbolParams) bool {
+    if st.basisSpec != (basisSpec{sp.BasisEstimator, sp.BasisWindow, sp.BasisStep}) {
+        st.resetBasis(sp)
+        return true
+    }
+    st.basis.maxGap = sp.BasisMaxGap
+    if e, ok := st.basis.est.(*ewma); ok { e.halfLife = sp.BasisHalfLife }
+    return false
+}
@@ -0,0 +1,71 @@
+package strategy
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/weex/ai_trading/bot/internal/logger"
+	"github.com/weex/ai_trading/bot/internal/tca"
+	"github.com/weex/ai_trading/bot/internal/trader"
+)
+
+// tcaMaxWait is how long a leg may stay unsettled before it is dropped,
+// e.g. a close order the exchange no longer reports.
+const tcaMaxWait = time.Hour
+
+// track queues an order for transaction cost analysis once it settles.
+func (e *Engine) track(l tca.Leg) {
+	if l.OrderID == "" {
+		return
+	}
+	l.Sent = e.clk.Now()
+	e.pending = append(e.pending, l)
+}
+
+// settleTCA books every pending leg whose order has finished.
+func (e *Engine) settleTCA() {
+	kept := e.pending[:0]
+	for _, l := range e.pending {
+		f, ok := e.tr.Fill(l.OrderID)
+		if !ok {
+			continue
+		}
+		if !f.Done {
+			if e.clk.Since(l.Sent) < tcaMaxWait {
+				kept = append(kept, l)
+			}
+			continue
+		}
+		l.Filled, l.Fill, l.Done = f.Filled, f.AvgPrice, f.At
+		if l.Done.IsZero() {
+			l.Done = e.clk.Now()
+		}
+		l.Fee = e.feeRate(l.Symbol, l.OrderType) * l.Fill * l.Filled
+		e.tca.Add(l)
+		e.log.Trade(logger.EvTCA, logger.KSymbol, l.Symbol, logger.KLeg, l.Kind, logger.KSide, legSide(l), logger.KOrderID, l.OrderID, logger.KOrderType, l.OrderType,
+			logger.KDecision, fmtF(l.Decision), logger.KArrival, fmtF(l.Arrival), logger.KPrice, fmtF(l.Order), logger.KAvgPrice, fmtF(l.Fill),
+			logger.KSize, fmtF(l.Size), logger.KFilled, fmtF(l.Filled), logger.KFee, strconv.FormatFloat(l.Fee, 'f', 6, 64),
+			logger.KShortfallBps, fmtBps(l.ShortfallBps()), logger.KDelayBps, fmtBps(l.DelayBps()), logger.KSlippageBps, fmtBps(l.SlippageBps()), logger.KFeeBps, fmtBps(l.FeeBps()),
+			logger.KTimeToFill, l.TimeToFill().String())
+	}
+	e.pending = kept
+}
+
+func (e *Engine) logTCA() {
+	for _, s := range e.tca.Stats() {
+		e.log.Metrics(logger.EvTCASummary, logger.KSymbol, s.Symbol, logger.KLegs, strconv.Itoa(s.Legs), logger.KUnfilled, strconv.Itoa(s.Unfilled), logger.KNotional, strconv.FormatFloat(s.Notional, 'f', 2, 64),
+			logger.KShortfallBps, fmtBps(s.ShortfallBps), logger.KDelayBps, fmtBps(s.DelayBps), logger.KSlippageBps, fmtBps(s.SlippageBps),
+			logger.KSlippageP50, fmtBps(s.SlippageP50Bps), logger.KSlippageP90, fmtBps(s.SlippageP90Bps), logger.KFeeBps, fmtBps(s.FeeBps),
+			logger.KCost, strconv.FormatFloat(s.Cost, 'f', 6, 64), logger.KTimeToFill, s.TimeToFill.Round(time.Millisecond).String())
+	}
+}
+
+func legSide(l tca.Leg) string {
+	if l.Buy {
+		return string(trader.Buy)
+	}
+	return string(trader.Sell)
+}
+
+func fmtF(v float64) string   { return strconv.FormatFloat(v, 'f', -1, 64) }
+func fmtBps(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
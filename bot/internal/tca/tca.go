@@ -0,0 +1,208 @@
+// Package tca measures what execution costs. Every entry and exit order
+// is a Leg whose fill is compared with the price the strategy acted on
+// and the mid when the order went out; a Book aggregates legs per symbol.
+package tca
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Leg kinds.
+const (
+	Entry = "entry"
+	Exit  = "exit"
+)
+
+// Leg is one order. Prices are zero where unknown; Order is zero for a
+// market order.
+type Leg struct {
+	Symbol    string
+	Kind      string
+	Buy       bool
+	OrderID   string
+	OrderType string
+	Decision  float64 // price the strategy acted on
+	Arrival   float64 // mid when the order was sent
+	Order     float64
+	Fill      float64 // average fill price
+	Size      float64
+	Filled    float64
+	Fee       float64 // USDT
+	Sent      time.Time
+	Done      time.Time // when the order was seen finished
+}
+
+func (l Leg) sign() float64 {
+	if l.Buy {
+		return 1
+	}
+	return -1
+}
+
+func (l Leg) filled() bool { return l.Filled > 0 && l.Fill > 0 && l.Decision > 0 }
+
+// Notional is the filled size at the decision price.
+func (l Leg) Notional() float64 { return l.Decision * l.Filled }
+
+// ShortfallBps is the implementation shortfall of the filled size: fill
+// against decision price plus fees, positive when it cost.
+func (l Leg) ShortfallBps() float64 {
+	if !l.filled() {
+		return 0
+	}
+	return l.sign()*(l.Fill-l.Decision)/l.Decision*1e4 + l.FeeBps()
+}
+
+// DelayBps is how far the mid moved from the decision price by the time
+// the order went out.
+func (l Leg) DelayBps() float64 {
+	if l.Decision <= 0 || l.Arrival <= 0 {
+		return 0
+	}
+	return l.sign() * (l.Arrival - l.Decision) / l.Decision * 1e4
+}
+
+// SlippageBps is the fill against the arrival mid.
+func (l Leg) SlippageBps() float64 {
+	if !l.filled() || l.Arrival <= 0 {
+		return 0
+	}
+	return l.sign() * (l.Fill - l.Arrival) / l.Arrival * 1e4
+}
+
+func (l Leg) FeeBps() float64 {
+	if !l.filled() {
+		return 0
+	}
+	return l.Fee / (l.Fill * l.Filled) * 1e4
+}
+
+// Cost is the shortfall in USDT.
+func (l Leg) Cost() float64 {
+	if !l.filled() {
+		return 0
+	}
+	return l.sign()*(l.Fill-l.Decision)*l.Filled + l.Fee
+}
+
+func (l Leg) TimeToFill() time.Duration {
+	if l.Sent.IsZero() || l.Done.Before(l.Sent) {
+		return 0
+	}
+	return l.Done.Sub(l.Sent)
+}
+
+// Stats summarises the legs of one symbol. The bps figures are weighted
+// by notional; unfilled legs only count in Legs and Unfilled.
+type Stats struct {
+	Symbol         string        `json:"symbol"`
+	Legs           int           `json:"legs"`
+	Entries        int           `json:"entries"`
+	Exits          int           `json:"exits"`
+	Unfilled       int           `json:"unfilled"`
+	Notional       float64       `json:"notional"`
+	ShortfallBps   float64       `json:"shortfall_bps"`
+	DelayBps       float64       `json:"delay_bps"`
+	SlippageBps    float64       `json:"slippage_bps"`
+	SlippageP50Bps float64       `json:"slippage_p50_bps"`
+	SlippageP90Bps float64       `json:"slippage_p90_bps"`
+	FeeBps         float64       `json:"fee_bps"`
+	Cost           float64       `json:"cost"`
+	TimeToFill     time.Duration `json:"-"`
+	TimeToFillSec  float64       `json:"time_to_fill_sec"`
+}
+
+func Summarize(symbol string, legs []Leg) Stats {
+	s := Stats{Symbol: symbol, Legs: len(legs)}
+	var slips []float64
+	var ttf time.Duration
+	for _, l := range legs {
+		if l.Kind == Entry {
+			s.Entries++
+		} else {
+			s.Exits++
+		}
+		if !l.filled() {
+			s.Unfilled++
+			continue
+		}
+		w := l.Notional()
+		s.Notional += w
+		s.ShortfallBps += w * l.ShortfallBps()
+		s.DelayBps += w * l.DelayBps()
+		s.SlippageBps += w * l.SlippageBps()
+		s.FeeBps += w * l.FeeBps()
+		s.Cost += l.Cost()
+		slips = append(slips, l.SlippageBps())
+		ttf += l.TimeToFill()
+	}
+	if s.Notional > 0 {
+		s.ShortfallBps /= s.Notional
+		s.DelayBps /= s.Notional
+		s.SlippageBps /= s.Notional
+		s.FeeBps /= s.Notional
+	}
+	if n := len(slips); n > 0 {
+		sort.Float64s(slips)
+		s.SlippageP50Bps = quantile(slips, 0.5)
+		s.SlippageP90Bps = quantile(slips, 0.9)
+		s.TimeToFill = ttf / time.Duration(n)
+		s.TimeToFillSec = s.TimeToFill.Seconds()
+	}
+	return s
+}
+
+// quantile interpolates the q-quantile of sorted xs.
+func quantile(xs []float64, q float64) float64 {
+	pos := q * float64(len(xs)-1)
+	i := int(math.Floor(pos))
+	if i+1 >= len(xs) {
+		return xs[len(xs)-1]
+	}
+	return xs[i] + (pos-float64(i))*(xs[i+1]-xs[i])
+}
+
+// MaxLegs is how many legs a Book keeps per symbol; older ones drop out
+// of the statistics.
+const MaxLegs = 5000
+
+// Book collects legs per symbol. It is not safe for concurrent use.
+type Book struct {
+	legs map[string][]Leg
+}
+
+func NewBook() *Book { return &Book{legs: make(map[string][]Leg)} }
+
+func (b *Book) Add(l Leg) {
+	ls := append(b.legs[l.Symbol], l)
+	if len(ls) > MaxLegs {
+		ls = append(ls[:0], ls[len(ls)-MaxLegs:]...)
+	}
+	b.legs[l.Symbol] = ls
+}
+
+// Stats returns one Stats per symbol, sorted by symbol.
+func (b *Book) Stats() []Stats {
+	syms := make([]string, 0, len(b.legs))
+	for s := range b.legs {
+		syms = append(syms, s)
+	}
+	sort.Strings(syms)
+	out := make([]Stats, len(syms))
+	for i, s := range syms {
+		out[i] = Summarize(s, b.legs[s])
+	}
+	return out
+}
+
+// Symbol returns the statistics of one symbol; ok is false before its
+// first leg.
+func (b *Book) Symbol(symbol string) (Stats, bool) {
+	ls, ok := b.legs[symbol]
+	if !ok {
+		return Stats{}, false
+	}
+	return Summarize(symbol, ls), true
+}
@@ -0,0 +1,87 @@
+package tca
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-6 }
+
+func TestShortfallBps(t *testing.T) {
+	tests := []struct {
+		name string
+		leg  Leg
+		want float64
+	}{
+		{"buy filled above the decision", Leg{Buy: true, Decision: 100, Fill: 100.1, Filled: 1}, 10},
+		{"sell filled below the decision", Leg{Decision: 100, Fill: 99.9, Filled: 1}, 10},
+		{"sell filled above the decision", Leg{Decision: 100, Fill: 100.1, Filled: 1}, -10},
+		{"fee on a fill at the decision", Leg{Buy: true, Decision: 100, Fill: 100, Filled: 2, Fee: 0.1}, 5},
+		{"unfilled", Leg{Buy: true, Decision: 100, Fill: 0, Filled: 0}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.leg.ShortfallBps(); !near(got, tt.want) {
+				t.Fatalf("ShortfallBps = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuantile(t *testing.T) {
+	tests := []struct {
+		xs   []float64
+		q    float64
+		want float64
+	}{
+		{[]float64{1, 2, 3, 4, 5}, 0, 1},
+		{[]float64{1, 2, 3, 4, 5}, 0.5, 3},
+		{[]float64{1, 2, 3, 4, 5}, 0.9, 4.6},
+		{[]float64{1, 2, 3, 4, 5}, 1, 5},
+		{[]float64{0, 10}, 0.5, 5},
+		{[]float64{0, 10}, 0.9, 9},
+		{[]float64{7}, 0.9, 7},
+	}
+	for _, tt := range tests {
+		if got := quantile(tt.xs, tt.q); !near(got, tt.want) {
+			t.Errorf("quantile(%v, %v) = %v, want %v", tt.xs, tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	legs := []Leg{
+		// 10 bps on 100 USDT
+		{Kind: Entry, Buy: true, Decision: 100, Arrival: 100, Fill: 100.1, Filled: 1, Sent: t0, Done: t0.Add(2 * time.Second)},
+		// -2 bps on 300 USDT
+		{Kind: Exit, Decision: 100, Arrival: 100, Fill: 100.02, Filled: 3, Sent: t0, Done: t0.Add(4 * time.Second)},
+		{Kind: Entry, Buy: true, Decision: 100, Arrival: 100, Size: 1},
+	}
+	s := Summarize("cmt_btcusdt", legs)
+	if s.Legs != 3 || s.Entries != 2 || s.Exits != 1 || s.Unfilled != 1 {
+		t.Fatalf("counts = %d legs, %d entries, %d exits, %d unfilled; want 3, 2, 1, 1", s.Legs, s.Entries, s.Exits, s.Unfilled)
+	}
+	// weighted by notional: (100*10 + 300*-2) / 400, not the plain mean 4
+	for _, c := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"notional", s.Notional, 400},
+		{"shortfall", s.ShortfallBps, 1},
+		{"slippage", s.SlippageBps, 1},
+		{"delay", s.DelayBps, 0},
+		{"cost", s.Cost, 0.1 - 0.06},
+	} {
+		if !near(c.got, c.want) {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+	if !near(s.SlippageP50Bps, 4) || !near(s.SlippageP90Bps, 8.8) {
+		t.Errorf("slippage p50 %v p90 %v, want 4 and 8.8", s.SlippageP50Bps, s.SlippageP90Bps)
+	}
+	if s.TimeToFill != 3*time.Second {
+		t.Errorf("time to fill = %s, want 3s", s.TimeToFill)
+	}
+}
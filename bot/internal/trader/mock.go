@@ -1,10 +1,12 @@
 package trader
 
 import (
+    "context"
     "math/rand"
     "strconv"
     "sync"
     "time"
+    "github.com/weex/ai_trading/bot/internal/clock"
     "github.com/weex/ai_trading/bot/internal/logger"
 )
 
@@ -17,7 +19,33 @@ const (
 
 type Trader interface {
     PlaceOrder(symbol string, side Side, orderType string, price, size float64) Order
+    // ClosePosition reduces the side position of symbol by up to size.
+    // Status "no_position" means there was nothing left to close.
     ClosePosition(symbol string, side Side, orderType string, price, size float64) Order
+    // CancelAll cancels resting orders for symbol, or for every symbol when empty.
+    CancelAll(symbol string) error
+    // Wait blocks until orders already submitted have settled or ctx expires.
+    Wait(ctx context.Context) error
+    // Protect keeps stop-loss/take-profit orders on the exchange for the
+    // position opened by orderID, placed once it fills. Calling it again
+    // amends them.
+    Protect(orderID string, p Protection)
+    // Release drops the protection of orderID before the engine closes the
+    // position itself. If a protective order already closed the position on
+    // the exchange it returns that trigger price and true.
+    Release(orderID string) (exit float64, triggered bool)
+    // Fill reports what orderID, an entry or a close, has filled so far;
+    // ok is false for an order the trader does not know.
+    Fill(orderID string) (f Fill, ok bool)
+}
+
+// Fill is the execution of one order. Done is set once it can no longer
+// fill; At is when that was seen.
+type Fill struct {
+    Filled   float64
+    AvgPrice float64
+    Done     bool
+    At       time.Time
 }
 
 type Order struct {
@@ -29,16 +57,25 @@ type Order struct {
     Size      float64
     Status    string
     CreatedAt time.Time
+    FilledAt  time.Time
 }
 
 type Mock struct {
     mu     sync.Mutex
     orders map[string]Order
+    guards map[string]Protection
     log    *logger.Logger
+    wg     sync.WaitGroup
+    clk    clock.Clock
 }
 
-func NewMock(log *logger.Logger) *Mock {
-    return &Mock{orders: make(map[string]Order), log: log}
+// mockFillDelay is how long a paper entry rests before it fills.
+const mockFillDelay = 2 * time.Second
+
+// NewMock returns a paper trader that fills every order after a fixed
+// delay on clk (nil means wall time).
+func NewMock(log *logger.Logger, clk clock.Clock) *Mock {
+    return &Mock{orders: make(map[string]Order), guards: make(map[string]Protection), log: log, clk: clock.Or(clk)}
 }
 
 func (m *Mock) PlaceOrder(symbol string, side Side, orderType string, price, size float64) Order {
@@ -53,18 +90,28 @@ func (m *Mock) PlaceOrder(symbol string, side Side, orderType string, price, siz
         Price:     price,
         Size:      size,
         Status:    "new",
-        CreatedAt: time.Now(),
+        CreatedAt: m.clk.Now(),
     }
     m.orders[id] = o
-    m.log.Trade("模拟_开仓委托", "委托ID", id, "币对", symbol, "方向", string(side))
+    m.log.Trade(logger.EvOrderOpen, logger.KMode, "mock", logger.KOrderID, id, logger.KSymbol, symbol, logger.KSide, string(side), logger.KOrderType, orderType)
+    m.wg.Add(1)
+    // arm the fill timer now so a manual clock advanced right after
+    // PlaceOrder still fills the order
+    filled := m.clk.After(mockFillDelay)
     go func() {
-        time.Sleep(time.Second * 2)
+        defer m.wg.Done()
+        <-filled
         m.mu.Lock()
         o := m.orders[id]
+        if o.Status != "new" {
+            m.mu.Unlock()
+            return
+        }
         o.Status = "filled"
+        o.FilledAt = o.CreatedAt.Add(mockFillDelay)
         m.orders[id] = o
         m.mu.Unlock()
-        m.log.Trade("模拟_委托成交", "委托ID", id, "币对", symbol, "类型", orderType)
+        m.log.Trade(logger.EvOrderFilled, logger.KMode, "mock", logger.KOrderID, id, logger.KSymbol, symbol, logger.KOrderType, orderType)
     }()
     return o
 }
@@ -73,11 +120,103 @@ func (m *Mock) ClosePosition(symbol string, side Side, orderType string, price,
     var closeSide Side
     if side == Buy { closeSide = Sell } else { closeSide = Buy }
     id := m.newID()
-    o := Order{ID: id, Symbol: symbol, Side: closeSide, OrderType: orderType, Price: price, Size: size, Status: "filled", CreatedAt: time.Now()}
-    m.log.Trade("模拟_平仓委托", "委托ID", id, "币对", symbol, "方向", string(closeSide))
+    now := m.clk.Now()
+    o := Order{ID: id, Symbol: symbol, Side: closeSide, OrderType: orderType, Price: price, Size: size, Status: "filled", CreatedAt: now, FilledAt: now}
+    m.mu.Lock()
+    m.orders[id] = o
+    m.mu.Unlock()
+    m.log.Trade(logger.EvOrderClose, logger.KMode, "mock", logger.KOrderID, id, logger.KSymbol, symbol, logger.KSide, string(closeSide))
     return o
 }
 
+func (m *Mock) CancelAll(symbol string) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    n := 0
+    for id, o := range m.orders {
+        if o.Status != "new" || (symbol != "" && o.Symbol != symbol) {
+            continue
+        }
+        o.Status = "cancelled"
+        m.orders[id] = o
+        n++
+    }
+    m.log.Trade(logger.EvCancelAll, logger.KMode, "mock", logger.KSymbol, symbol, logger.KCount, strconv.Itoa(n))
+    return nil
+}
+
+func (m *Mock) Wait(ctx context.Context) error {
+    done := make(chan struct{})
+    go func() {
+        m.wg.Wait()
+        close(done)
+    }()
+    select {
+    case <-done:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+// Protect records the levels; paper positions have no exchange-side orders
+// to trigger, so exits stay with the engine.
+func (m *Mock) Protect(orderID string, p Protection) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    o, ok := m.orders[orderID]
+    if !ok {
+        return
+    }
+    action := "placed"
+    if _, ok := m.guards[orderID]; ok {
+        action = "amended"
+    } else if p.off() {
+        return
+    }
+    m.guards[orderID] = p
+    sl, tp := p.Levels(o.Side, o.Price)
+    m.log.Trade(logger.EvProtect, logger.KMode, "mock", logger.KAction, action, logger.KOrderID, orderID, logger.KSymbol, o.Symbol, logger.KStopLoss, formatLevel(sl), logger.KTakeProfit, formatLevel(tp))
+}
+
+// Release cancels the entry if its fill delay has not passed yet, as the
+// real trader stops an entry still being worked, and drops its levels.
+func (m *Mock) Release(orderID string) (float64, bool) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if o, ok := m.orders[orderID]; ok && o.Status == "new" && m.clk.Now().Before(o.CreatedAt.Add(mockFillDelay)) {
+        o.Status = "cancelled"
+        m.orders[orderID] = o
+    }
+    if _, ok := m.guards[orderID]; ok {
+        delete(m.guards, orderID)
+        m.log.Trade(logger.EvProtect, logger.KMode, "mock", logger.KAction, "cancelled", logger.KOrderID, orderID)
+    }
+    return 0, false
+}
+
+// Fill reports paper fills, which are whole and at the order price. An
+// entry counts as filled once its delay has passed on the clock, even if
+// the goroutine marking it has not run yet.
+func (m *Mock) Fill(orderID string) (Fill, bool) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    o, ok := m.orders[orderID]
+    if !ok {
+        return Fill{}, false
+    }
+    switch o.Status {
+    case "filled":
+        return Fill{Filled: o.Size, AvgPrice: o.Price, Done: true, At: o.FilledAt}, true
+    case "cancelled":
+        return Fill{Done: true, At: o.CreatedAt}, true
+    }
+    if at := o.CreatedAt.Add(mockFillDelay); !m.clk.Now().Before(at) {
+        return Fill{Filled: o.Size, AvgPrice: o.Price, Done: true, At: at}, true
+    }
+    return Fill{}, true
+}
+
 func (m *Mock) GetOrder(id string) (Order, bool) {
     m.mu.Lock()
     defer m.mu.Unlock()
@@ -86,5 +225,5 @@ func (m *Mock) GetOrder(id string) (Order, bool) {
 }
 
 func (m *Mock) newID() string {
-    return time.Now().Format("20060102T150405") + "-" + strconv.FormatInt(rand.Int63(), 10)
+    return m.clk.Now().Format("20060102T150405") + "-" + strconv.FormatInt(rand.Int63(), 10)
 }
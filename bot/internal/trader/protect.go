@@ -0,0 +1,272 @@
+package trader
+
+import (
+    "context"
+    "math"
+    "strconv"
+    "sync"
+    "time"
+    "github.com/weex/ai_trading/bot/internal/logger"
+    "github.com/weex/ai_trading/bot/internal/weex"
+)
+
+// Protection is where the exchange should close a position on its own, as
+// distances from the fill price. Zero leaves that side unset.
+type Protection struct {
+    StopLossBps   float64
+    TakeProfitBps float64
+    // Tick is the price increment triggers are rounded to, away from the
+    // entry; zero means no rounding.
+    Tick float64
+}
+
+// Levels returns the stop-loss and take-profit trigger prices for a
+// position of side entered at entry; zero where unset.
+func (p Protection) Levels(side Side, entry float64) (sl, tp float64) {
+    if entry <= 0 {
+        return 0, 0
+    }
+    dir := 1.0
+    if side == Sell {
+        dir = -1
+    }
+    round := func(v float64, up bool) float64 {
+        if p.Tick <= 0 {
+            return v
+        }
+        if up {
+            return math.Ceil(v/p.Tick-1e-9) * p.Tick
+        }
+        return math.Floor(v/p.Tick+1e-9) * p.Tick
+    }
+    if p.StopLossBps > 0 {
+        sl = round(entry*(1-dir*p.StopLossBps/1e4), side == Sell)
+    }
+    if p.TakeProfitBps > 0 {
+        tp = round(entry*(1+dir*p.TakeProfitBps/1e4), side == Buy)
+    }
+    return sl, tp
+}
+
+func (p Protection) off() bool { return p.StopLossBps <= 0 && p.TakeProfitBps <= 0 }
+
+func formatLevel(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+
+// guard is the protection of one entry order. mu serialises placing,
+// amending and releasing its plan orders.
+type guard struct {
+    mu       sync.Mutex
+    symbol   string
+    side     Side
+    prot     Protection
+    entry    float64
+    size     float64
+    filled   bool
+    sl, tp   string // plan order ids
+    slPx     float64
+    tpPx     float64
+    placedAt time.Time // first plan order, bounds the history lookup
+    released chan struct{}
+}
+
+// Protect starts watching orderID; once it fills, TP/SL orders for the
+// filled size go to the exchange. On a watched order it amends them.
+func (w *WeexTrader) Protect(orderID string, p Protection) {
+    w.mu.Lock()
+    g, ok := w.guards[orderID]
+    if !ok {
+        o, known := w.orders[orderID]
+        if !known || p.off() {
+            w.mu.Unlock()
+            return
+        }
+        g = &guard{symbol: o.Symbol, side: o.Side, prot: p, released: make(chan struct{})}
+        w.guards[orderID] = g
+        w.mu.Unlock()
+        go w.watch(orderID, g)
+        return
+    }
+    w.mu.Unlock()
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    select {
+    case <-g.released:
+        return
+    default:
+    }
+    g.prot = p
+    if g.filled {
+        w.syncPlans(orderID, g)
+    }
+}
+
+// watch waits for the entry's algorithm to finish, then protects what
+// filled. Entries worked over time (twap, iceberg) are protected once, for
+// their whole fill.
+func (w *WeexTrader) watch(orderID string, g *guard) {
+    w.mu.Lock()
+    p := w.parents[orderID]
+    w.mu.Unlock()
+    if p == nil {
+        return
+    }
+    select {
+    case <-g.released:
+        return
+    case <-p.Done():
+    }
+    r := p.Result()
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    select {
+    case <-g.released:
+        return
+    default:
+    }
+    if r.Filled <= 0 {
+        w.log.Trade(logger.EvProtect, logger.KMode, "real", logger.KAction, "unfilled", logger.KOrderID, orderID, logger.KSymbol, g.symbol)
+        return
+    }
+    g.entry, g.size, g.filled = r.AvgPrice, r.Filled, true
+    w.syncPlans(orderID, g)
+}
+
+// syncPlans brings the plan orders of g in line with g.prot: places
+// missing sides, moves triggers that changed and cancels sides now unset.
+// Called with g.mu held.
+func (w *WeexTrader) syncPlans(orderID string, g *guard) {
+    sl, tp := g.prot.Levels(g.side, g.entry)
+    g.sl, g.slPx = w.syncPlan(orderID, g, weex.PlanStopLoss, g.sl, g.slPx, sl)
+    g.tp, g.tpPx = w.syncPlan(orderID, g, weex.PlanTakeProfit, g.tp, g.tpPx, tp)
+}
+
+func (w *WeexTrader) syncPlan(orderID string, g *guard, planType, id string, have, want float64) (string, float64) {
+    ctx := context.Background()
+    kv := []string{logger.KMode, "real", logger.KOrderID, orderID, logger.KSymbol, g.symbol, logger.KPlanType, planType, logger.KTrigger, formatLevel(want)}
+    switch {
+    case id == "" && want > 0:
+        side := "long"
+        if g.side == Sell {
+            side = "short"
+        }
+        resp, err := w.client.PlaceTpSl(ctx, weex.TpSlReq{
+            Symbol:       g.symbol,
+            ClientOID:    w.newClientOID(),
+            PlanType:     planType,
+            TriggerPrice: formatLevel(want),
+            ExecutePrice: "0",
+            Size:         strconv.FormatFloat(g.size, 'f', 8, 64),
+            PositionSide: side,
+        })
+        if err != nil {
+            w.log.Error(logger.EvProtect, append(kv, logger.KAction, "place", logger.KErr, err.Error())...)
+            return "", 0
+        }
+        w.log.Trade(logger.EvProtect, append(kv, logger.KAction, "placed", logger.KPlanOrderID, resp.OrderID, logger.KSize, strconv.FormatFloat(g.size, 'f', 6, 64))...)
+        if g.placedAt.IsZero() {
+            g.placedAt = w.clk.Now()
+        }
+        return resp.OrderID, want
+    case id != "" && want == 0:
+        if err := w.client.CancelPlan(ctx, id); err != nil {
+            w.log.Error(logger.EvProtect, append(kv, logger.KAction, "cancel", logger.KPlanOrderID, id, logger.KErr, err.Error())...)
+            return id, have
+        }
+        w.log.Trade(logger.EvProtect, append(kv, logger.KAction, "cancelled", logger.KPlanOrderID, id)...)
+        return "", 0
+    case id != "" && want != have:
+        if err := w.client.ModifyTpSl(ctx, weex.ModifyTpSlReq{OrderID: id, TriggerPrice: formatLevel(want), ExecutePrice: "0"}); err != nil {
+            w.log.Error(logger.EvProtect, append(kv, logger.KAction, "amend", logger.KPlanOrderID, id, logger.KErr, err.Error())...)
+            return id, have
+        }
+        w.log.Trade(logger.EvProtect, append(kv, logger.KAction, "amended", logger.KPlanOrderID, id)...)
+        return id, want
+    }
+    return id, have
+}
+
+// Release stops the entry's algorithm if it is still working, stops
+// watching orderID and cancels its live plan orders. The entry's fill
+// stays readable through Fill. A plan order that is no longer live counts
+// as triggered, the exchange having closed the position at about its
+// trigger price, only when the plan history says it fired; otherwise it
+// was cancelled or expired and the position is still open.
+func (w *WeexTrader) Release(orderID string) (float64, bool) {
+    w.mu.Lock()
+    g, ok := w.guards[orderID]
+    p := w.parents[orderID]
+    delete(w.guards, orderID)
+    delete(w.orders, orderID)
+    if w.reported[orderID] {
+        delete(w.parents, orderID)
+        delete(w.reported, orderID)
+    }
+    w.mu.Unlock()
+    if ok {
+        g.mu.Lock()
+        close(g.released)
+        g.mu.Unlock()
+    }
+    if p != nil {
+        p.Cancel()
+        <-p.Done()
+    }
+    if !ok {
+        return 0, false
+    }
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    if g.sl == "" && g.tp == "" {
+        return 0, false
+    }
+    ctx := context.Background()
+    live := make(map[string]bool)
+    plans, err := w.client.GetPlanOrders(ctx, g.symbol)
+    if err != nil {
+        w.log.Error(logger.EvProtect, logger.KMode, "real", logger.KOrderID, orderID, logger.KErr, err.Error())
+    }
+    for _, p := range plans {
+        live[p.OrderID] = true
+    }
+    var fired map[string]bool
+    firedPlan := func(id string) bool {
+        if fired == nil {
+            fired = make(map[string]bool)
+            hist, herr := w.client.GetPlanHistory(ctx, g.symbol, g.placedAt)
+            if herr != nil {
+                w.log.Error(logger.EvProtect, logger.KMode, "real", logger.KOrderID, orderID, logger.KAction, "history", logger.KErr, herr.Error())
+            }
+            for _, h := range hist {
+                fired[h.OrderID] = h.Triggered()
+            }
+        }
+        return fired[id]
+    }
+    var exit float64
+    triggered := false
+    for _, pl := range []struct {
+        id   string
+        px   float64
+        kind string
+    }{{g.sl, g.slPx, weex.PlanStopLoss}, {g.tp, g.tpPx, weex.PlanTakeProfit}} {
+        if pl.id == "" {
+            continue
+        }
+        kv := []string{logger.KMode, "real", logger.KOrderID, orderID, logger.KSymbol, g.symbol, logger.KPlanType, pl.kind, logger.KPlanOrderID, pl.id, logger.KTrigger, formatLevel(pl.px)}
+        if err == nil && !live[pl.id] {
+            if firedPlan(pl.id) {
+                exit, triggered = pl.px, true
+                w.log.Trade(logger.EvProtect, append(kv, logger.KAction, "triggered")...)
+            } else {
+                w.log.Trade(logger.EvProtect, append(kv, logger.KAction, "gone")...)
+            }
+            continue
+        }
+        if cerr := w.client.CancelPlan(ctx, pl.id); cerr != nil {
+            w.log.Error(logger.EvProtect, append(kv, logger.KAction, "cancel", logger.KErr, cerr.Error())...)
+            continue
+        }
+        w.log.Trade(logger.EvProtect, append(kv, logger.KAction, "cancelled")...)
+    }
+    return exit, triggered
+}
@@ -0,0 +1,66 @@
+package trader
+
+import (
+    "context"
+    "fmt"
+    "strconv"
+    "github.com/weex/ai_trading/bot/internal/execution"
+    "github.com/weex/ai_trading/bot/internal/weex"
+)
+
+// venue places the child orders of WeexTrader entries.
+type venue struct {
+    w *WeexTrader
+}
+
+func (v *venue) Place(ctx context.Context, c execution.ChildReq) (string, error) {
+    req := weex.PlaceOrderReq{
+        Symbol:     c.Symbol,
+        ClientOID:  v.w.newClientOID(),
+        Size:       strconv.FormatFloat(c.Size, 'f', 8, 64),
+        Type:       "2",
+        OrderType:  "0",
+        MatchPrice: "0",
+    }
+    if c.Buy {
+        req.Type = "1"
+    }
+    if c.Price > 0 {
+        req.Price = fmt.Sprintf("%.8f", c.Price)
+    } else {
+        req.MatchPrice = "1"
+    }
+    if c.PostOnly {
+        req.OrderType = "1"
+    }
+    resp, err := v.w.client.PlaceOrder(ctx, req)
+    if err != nil {
+        return "", err
+    }
+    return resp.OrderID, nil
+}
+
+func (v *venue) Cancel(ctx context.Context, symbol, id string) error {
+    return v.w.client.CancelOrder(ctx, id)
+}
+
+func (v *venue) Status(ctx context.Context, id string) (execution.Fill, error) {
+    d, err := v.w.client.GetOrder(ctx, id)
+    if err != nil {
+        return execution.Fill{}, err
+    }
+    f := execution.Fill{Done: d.Done()}
+    f.Filled, _ = strconv.ParseFloat(d.FilledQty, 64)
+    f.AvgPrice, _ = strconv.ParseFloat(d.PriceAvg, 64)
+    return f, nil
+}
+
+func (v *venue) Top(ctx context.Context, symbol string) (float64, float64, error) {
+    t, err := v.w.client.GetTicker(ctx, symbol)
+    if err != nil {
+        return 0, 0, err
+    }
+    bid, _ := strconv.ParseFloat(t.BestBid, 64)
+    ask, _ := strconv.ParseFloat(t.BestAsk, 64)
+    return bid, ask, nil
+}
@@ -5,50 +5,167 @@ import (
     "fmt"
     "math/rand"
     "strconv"
+    "strings"
+    "sync"
     "time"
+    "github.com/weex/ai_trading/bot/internal/clock"
+    "github.com/weex/ai_trading/bot/internal/execution"
     "github.com/weex/ai_trading/bot/internal/logger"
     "github.com/weex/ai_trading/bot/internal/weex"
 )
 
 type WeexTrader struct {
-    client *weex.Client
-    log    *logger.Logger
+    client    *weex.Client
+    log       *logger.Logger
+    clk       clock.Clock
+    exec      *execution.Executor
+    mu        sync.Mutex
+    prm       execution.Params
+    orders    map[string]Order // entries that may still be protected
+    guards    map[string]*guard
+    parents   map[string]*execution.Parent
+    reported  map[string]bool // finished entries whose fill Fill returned
+    contracts map[string]weex.Contract
 }
 
-func NewWeex(client *weex.Client, log *logger.Logger) *WeexTrader {
-    return &WeexTrader{client: client, log: log}
+// NewWeex returns a trader that places real orders through client, with
+// order, fill and algorithm times taken from clk (nil means wall time).
+func NewWeex(client *weex.Client, log *logger.Logger, clk clock.Clock) *WeexTrader {
+    w := &WeexTrader{
+        client:    client,
+        log:       log,
+        clk:       clock.Or(clk),
+        prm:       execution.Params{Poll: 2 * time.Second, Timeout: 30 * time.Second, Show: 0.2, Duration: time.Minute, Slices: 5},
+        orders:    make(map[string]Order),
+        guards:    make(map[string]*guard),
+        parents:   make(map[string]*execution.Parent),
+        reported:  make(map[string]bool),
+        contracts: make(map[string]weex.Contract),
+    }
+    w.exec = &execution.Executor{Venue: &venue{w: w}, Log: log, Clock: w.clk}
+    return w
+}
+
+// SetExecution sets the tuning of the execution algorithms; Algo, Price,
+// Step and Tick are filled in per order.
+func (w *WeexTrader) SetExecution(p execution.Params) {
+    w.mu.Lock()
+    w.prm = p
+    w.mu.Unlock()
 }
 
+// PlaceOrder works an entry with the execution algorithm named by
+// orderType and returns once its first child order is on the book. The
+// order ID is the parent's client ID, not an exchange order ID.
 func (w *WeexTrader) PlaceOrder(symbol string, side Side, orderType string, price, size float64) Order {
-    ctx := context.Background()
-    req := weex.PlaceOrderReq{
-        Symbol:     symbol,
-        ClientOID:  w.newClientOID(),
-        Size:       strconv.FormatFloat(size, 'f', 8, 64),
-        OrderType:  "0",
-        MatchPrice: "0",
+    w.mu.Lock()
+    prm := w.prm
+    w.mu.Unlock()
+    prm.Algo, prm.Price = orderType, price
+    if orderType == execution.Market {
+        prm.Price = 0
     }
-    if orderType == "market" {
-        req.MatchPrice = "1"
-    } else {
-        req.Price = fmt.Sprintf("%.8f", price)
+    if c, err := w.contract(symbol); err == nil {
+        prm.Tick, _ = strconv.ParseFloat(c.TickSize, 64)
+        prm.Step, _ = strconv.ParseFloat(c.SizeIncrement, 64)
     }
-    if side == Buy {
-        req.Type = "1"
-    } else {
-        req.Type = "2"
+    id := w.newClientOID()
+    p := w.exec.Start(id, symbol, side == Buy, size, prm)
+    <-p.Working()
+    if r := p.Result(); r.Children == 0 {
+        msg := "no child order placed"
+        if r.Err != nil {
+            msg = r.Err.Error()
+        }
+        w.log.Error(logger.EvOrderOpenError, logger.KMode, "real", logger.KSymbol, symbol, logger.KOrderType, orderType, logger.KErr, msg)
+        return Order{ID: "", Symbol: symbol, Side: side, OrderType: orderType, Price: price, Size: size, Status: "error", CreatedAt: w.clk.Now()}
     }
-    resp, err := w.client.PlaceOrder(ctx, req)
+    w.log.Trade(logger.EvOrderOpen, logger.KMode, "real", logger.KSymbol, symbol, logger.KOrderID, id, logger.KSide, string(side), logger.KOrderType, orderType)
+    o := Order{ID: id, Symbol: symbol, Side: side, OrderType: orderType, Price: price, Size: size, Status: "new", CreatedAt: w.clk.Now()}
+    w.mu.Lock()
+    w.orders[o.ID] = o
+    w.parents[o.ID] = p
+    w.mu.Unlock()
+    return o
+}
+
+// Fill reports an entry's aggregate fill from its algorithm, and a close
+// order's from the exchange. An entry is forgotten once it has been both
+// reported done and released.
+func (w *WeexTrader) Fill(orderID string) (Fill, bool) {
+    w.mu.Lock()
+    p, ok := w.parents[orderID]
+    w.mu.Unlock()
+    if ok {
+        r := p.Result()
+        f := Fill{Filled: r.Filled, AvgPrice: r.AvgPrice, At: r.Finished}
+        select {
+        case <-p.Done():
+            f.Done = true
+            w.mu.Lock()
+            if _, open := w.orders[orderID]; open {
+                w.reported[orderID] = true
+            } else {
+                delete(w.parents, orderID)
+            }
+            w.mu.Unlock()
+        default:
+        }
+        return f, true
+    }
+    d, err := w.client.GetOrder(context.Background(), orderID)
     if err != nil {
-        w.log.Error("真实_开仓错误", "币对", symbol, "错误", err.Error())
-        return Order{ID: "", Symbol: symbol, Side: side, OrderType: orderType, Price: price, Size: size, Status: "error", CreatedAt: time.Now()}
+        // not settled yet as far as the caller can tell; it asks again
+        return Fill{}, true
     }
-    w.log.Trade("真实_开仓委托", "币对", symbol, "委托ID", resp.OrderID, "方向", string(side), "类型", orderType)
-    return Order{ID: resp.OrderID, Symbol: symbol, Side: side, OrderType: orderType, Price: price, Size: size, Status: "new", CreatedAt: time.Now()}
+    f := Fill{Done: d.Done(), At: w.clk.Now()}
+    f.Filled, _ = strconv.ParseFloat(d.FilledQty, 64)
+    f.AvgPrice, _ = strconv.ParseFloat(d.PriceAvg, 64)
+    return f, true
 }
 
+// contract returns the cached contract spec of symbol.
+func (w *WeexTrader) contract(symbol string) (weex.Contract, error) {
+    w.mu.Lock()
+    c, ok := w.contracts[symbol]
+    w.mu.Unlock()
+    if ok {
+        return c, nil
+    }
+    cs, err := w.client.GetContracts(context.Background(), symbol)
+    if err != nil {
+        return weex.Contract{}, err
+    }
+    for _, c := range cs {
+        if c.Symbol == symbol {
+            w.mu.Lock()
+            w.contracts[symbol] = c
+            w.mu.Unlock()
+            return c, nil
+        }
+    }
+    return weex.Contract{}, fmt.Errorf("contract %s not found", symbol)
+}
+
+// ClosePosition closes up to size of the side position of symbol with a
+// close order, which can only reduce it. The size is capped at what the
+// exchange holds; when nothing is held no order is sent and the status is
+// "no_position". When the position cannot be read nothing is sent and the
+// status is "error".
 func (w *WeexTrader) ClosePosition(symbol string, side Side, orderType string, price, size float64) Order {
     ctx := context.Background()
+    requested := size
+    held, err := w.held(ctx, symbol, side)
+    if err != nil {
+        w.log.Error(logger.EvOrderCloseError, logger.KMode, "real", logger.KSymbol, symbol, logger.KErr, err.Error())
+        return Order{ID: "", Symbol: symbol, Side: side, OrderType: orderType, Price: price, Size: size, Status: "error", CreatedAt: w.clk.Now()}
+    }
+    if held <= 0 {
+        return w.noPosition(symbol, side, orderType, price, requested)
+    }
+    if size > held {
+        size = held
+    }
     req := weex.PlaceOrderReq{
         Symbol:     symbol,
         ClientOID:  w.newClientOID(),
@@ -68,13 +185,80 @@ func (w *WeexTrader) ClosePosition(symbol string, side Side, orderType string, p
     }
     resp, err := w.client.PlaceOrder(ctx, req)
     if err != nil {
-        w.log.Error("真实_平仓错误", "币对", symbol, "错误", err.Error())
-        return Order{ID: "", Symbol: symbol, Side: side, OrderType: orderType, Price: price, Size: size, Status: "error", CreatedAt: time.Now()}
+        // the position may have closed since it was read, e.g. by a stop
+        if h, herr := w.held(ctx, symbol, side); herr == nil && h <= 0 {
+            return w.noPosition(symbol, side, orderType, price, requested)
+        }
+        w.log.Error(logger.EvOrderCloseError, logger.KMode, "real", logger.KSymbol, symbol, logger.KErr, err.Error())
+        return Order{ID: "", Symbol: symbol, Side: side, OrderType: orderType, Price: price, Size: size, Status: "error", CreatedAt: w.clk.Now()}
+    }
+    kv := []string{logger.KMode, "real", logger.KSymbol, symbol, logger.KOrderID, resp.OrderID, logger.KSide, string(side), logger.KOrderType, orderType, logger.KSize, strconv.FormatFloat(size, 'f', 6, 64)}
+    if size != requested {
+        kv = append(kv, logger.KBefore, strconv.FormatFloat(requested, 'f', 6, 64))
+    }
+    w.log.Trade(logger.EvOrderClose, kv...)
+    return Order{ID: resp.OrderID, Symbol: symbol, Side: side, OrderType: orderType, Price: price, Size: size, Status: "new", CreatedAt: w.clk.Now()}
+}
+
+// held is the size of the side position of symbol on the exchange.
+func (w *WeexTrader) held(ctx context.Context, symbol string, side Side) (float64, error) {
+    pos, err := w.client.GetPositions(ctx)
+    if err != nil {
+        return 0, err
+    }
+    want := "LONG"
+    if side == Sell {
+        want = "SHORT"
+    }
+    total := 0.0
+    for _, p := range pos {
+        if p.Symbol == symbol && strings.EqualFold(p.Side, want) {
+            total += p.Size
+        }
+    }
+    return total, nil
+}
+
+func (w *WeexTrader) noPosition(symbol string, side Side, orderType string, price, size float64) Order {
+    w.log.Trade(logger.EvOrderClose, logger.KMode, "real", logger.KSymbol, symbol, logger.KSide, string(side), logger.KSize, strconv.FormatFloat(size, 'f', 6, 64), logger.KResult, "no_position")
+    return Order{ID: "", Symbol: symbol, Side: side, OrderType: orderType, Price: price, Size: 0, Status: "no_position", CreatedAt: w.clk.Now()}
+}
+
+func (w *WeexTrader) CancelAll(symbol string) error {
+    res, err := w.client.CancelAllOrders(context.Background(), symbol)
+    if err != nil {
+        w.log.Error(logger.EvCancelAll, logger.KMode, "real", logger.KSymbol, symbol, logger.KErr, err.Error())
+        return err
+    }
+    w.log.Trade(logger.EvCancelAll, logger.KMode, "real", logger.KSymbol, symbol, logger.KCount, strconv.Itoa(len(res)))
+    return nil
+}
+
+// Wait lets working entries finish. When ctx ends first it cancels them
+// and waits for their children to be cancelled.
+func (w *WeexTrader) Wait(ctx context.Context) error {
+    w.mu.Lock()
+    var ps []*execution.Parent
+    for _, p := range w.parents {
+        ps = append(ps, p)
+    }
+    w.mu.Unlock()
+    for _, p := range ps {
+        select {
+        case <-p.Done():
+        case <-ctx.Done():
+            for _, p := range ps {
+                p.Cancel()
+            }
+            for _, p := range ps {
+                <-p.Done()
+            }
+            return ctx.Err()
+        }
     }
-    w.log.Trade("真实_平仓委托", "币对", symbol, "委托ID", resp.OrderID, "方向", string(side), "类型", orderType)
-    return Order{ID: resp.OrderID, Symbol: symbol, Side: side, OrderType: orderType, Price: price, Size: size, Status: "new", CreatedAt: time.Now()}
+    return ctx.Err()
 }
 
 func (w *WeexTrader) newClientOID() string {
-    return time.Now().Format("20060102T150405") + "-" + strconv.FormatInt(rand.Int63(), 10)
+    return w.clk.Now().Format("20060102T150405") + "-" + strconv.FormatInt(rand.Int63(), 10)
 }
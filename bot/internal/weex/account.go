@@ -0,0 +1,123 @@
+package weex
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Margin modes as the bot names them.
+const (
+	MarginCross    = "cross"
+	MarginIsolated = "isolated"
+)
+
+// SymbolSettings is the account's leverage and margin mode for one symbol.
+// Cross margin has a single leverage, reported on both sides.
+type SymbolSettings struct {
+	Symbol        string
+	MarginMode    string // cross, isolated, or empty when the account does not say
+	LongLeverage  float64
+	ShortLeverage float64
+}
+
+// GetSymbolSettings reads leverage and margin mode for every symbol the
+// account has settings for.
+func (c *Client) GetSymbolSettings(ctx context.Context) (map[string]SymbolSettings, error) {
+	var acc AccountsResp
+	if err := c.doPrivate(ctx, epAccounts, url.Values{}, nil, &acc); err != nil {
+		return nil, err
+	}
+	var ids []int
+	for k := range acc.Account.ContractLeverage {
+		if id, err := strconv.Atoi(k); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	for k := range acc.Account.ContractMode {
+		if id, err := strconv.Atoi(k); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	out := make(map[string]SymbolSettings)
+	for id, sym := range c.contractSymbols(ctx, ids) {
+		key := strconv.Itoa(id)
+		lv, hasLev := acc.Account.ContractLeverage[key]
+		md, hasMode := acc.Account.ContractMode[key]
+		if !hasLev && !hasMode {
+			continue
+		}
+		st := SymbolSettings{Symbol: sym, MarginMode: marginMode(md.MarginMode)}
+		switch st.MarginMode {
+		case MarginIsolated:
+			st.LongLeverage, _ = strconv.ParseFloat(lv.IsolatedLong, 64)
+			st.ShortLeverage, _ = strconv.ParseFloat(lv.IsolatedShort, 64)
+		default:
+			s := lv.Cross
+			if s == "" {
+				s = lv.Shared
+			}
+			st.LongLeverage, _ = strconv.ParseFloat(s, 64)
+			st.ShortLeverage = st.LongLeverage
+		}
+		out[sym] = st
+	}
+	return out, nil
+}
+
+// marginMode maps the account's margin mode names to the bot's.
+func marginMode(s string) string {
+	switch strings.ToUpper(s) {
+	case "SHARED", "CROSS":
+		return MarginCross
+	case "ISOLATED":
+		return MarginIsolated
+	}
+	return ""
+}
+
+// marginModeCode is the marginMode request parameter: 1 cross, 3 isolated.
+func marginModeCode(mode string) (int, error) {
+	switch mode {
+	case MarginCross:
+		return 1, nil
+	case MarginIsolated:
+		return 3, nil
+	}
+	return 0, fmt.Errorf("unknown margin mode %q", mode)
+}
+
+type marginModeReq struct {
+	Symbol        string `json:"symbol"`
+	MarginMode    int    `json:"marginMode"`
+	SeparatedMode int    `json:"separatedMode"`
+}
+
+// SetMarginMode switches symbol to cross or isolated margin. The exchange
+// refuses while the symbol has open positions or orders.
+func (c *Client) SetMarginMode(ctx context.Context, symbol, mode string) error {
+	code, err := marginModeCode(mode)
+	if err != nil {
+		return err
+	}
+	return c.doPrivate(ctx, epMarginMode, url.Values{}, marginModeReq{Symbol: symbol, MarginMode: code, SeparatedMode: 1}, nil)
+}
+
+type leverageReq struct {
+	Symbol        string `json:"symbol"`
+	MarginMode    int    `json:"marginMode"`
+	LongLeverage  string `json:"longLeverage"`
+	ShortLeverage string `json:"shortLeverage"`
+}
+
+// SetLeverage sets both sides of symbol to leverage under margin mode.
+func (c *Client) SetLeverage(ctx context.Context, symbol, mode string, leverage float64) error {
+	code, err := marginModeCode(mode)
+	if err != nil {
+		return err
+	}
+	lv := strconv.FormatFloat(leverage, 'f', -1, 64)
+	return c.doPrivate(ctx, epLeverage, url.Values{}, leverageReq{Symbol: symbol, MarginMode: code, LongLeverage: lv, ShortLeverage: lv}, nil)
+}
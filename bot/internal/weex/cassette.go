@@ -0,0 +1,232 @@
+package weex
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A cassette is a JSONL file with one Interaction per line, in request
+// order. Request headers are not stored, so signatures, keys and
+// passphrases never reach the file; any configured secret that shows up in
+// a body is replaced with "***" as well.
+
+type Interaction struct {
+	Seq       int       `json:"seq"`
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Query     string    `json:"query,omitempty"`
+	Body      string    `json:"body,omitempty"`
+	Status    int       `json:"status,omitempty"`
+	Response  string    `json:"response,omitempty"`
+	Err       string    `json:"error,omitempty"`
+	LatencyMs int64     `json:"latency_ms"`
+}
+
+func (it Interaction) key() string { return it.Method + " " + it.Path + "?" + it.Query }
+
+// Recorder is an http.RoundTripper that forwards to next and appends every
+// exchange to a cassette file as it happens.
+type Recorder struct {
+	next   http.RoundTripper
+	redact *strings.Replacer
+
+	mu  sync.Mutex
+	f   *os.File
+	w   *bufio.Writer
+	seq int
+}
+
+// NewRecorder creates (or truncates) path. secrets are masked in recorded
+// bodies.
+func NewRecorder(path string, next http.RoundTripper, secrets ...string) (*Recorder, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recorder{next: next, f: f, w: bufio.NewWriter(f)}
+	var pairs []string
+	for _, s := range secrets {
+		if s != "" {
+			pairs = append(pairs, s, "***")
+		}
+	}
+	if len(pairs) > 0 {
+		r.redact = strings.NewReplacer(pairs...)
+	}
+	return r, nil
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	it := Interaction{Time: time.Now(), Method: req.Method, Path: req.URL.Path, Query: req.URL.RawQuery}
+	if req.GetBody != nil {
+		if rc, err := req.GetBody(); err == nil {
+			b, _ := io.ReadAll(rc)
+			rc.Close()
+			it.Body = string(b)
+		}
+	}
+	resp, err := r.next.RoundTrip(req)
+	it.LatencyMs = time.Since(it.Time).Milliseconds()
+	if err != nil {
+		it.Err = err.Error()
+		r.write(it)
+		return nil, err
+	}
+	b, rerr := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(b))
+	it.Status = resp.StatusCode
+	it.Response = string(b)
+	if rerr != nil {
+		it.Err = rerr.Error()
+	}
+	r.write(it)
+	return resp, nil
+}
+
+func (r *Recorder) write(it Interaction) {
+	if r.redact != nil {
+		it.Query = r.redact.Replace(it.Query)
+		it.Body = r.redact.Replace(it.Body)
+		it.Response = r.redact.Replace(it.Response)
+		it.Err = r.redact.Replace(it.Err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return
+	}
+	r.seq++
+	it.Seq = r.seq
+	b, _ := json.Marshal(it)
+	_, _ = r.w.Write(append(b, '\n'))
+	// flush per line so a crashed session still leaves a usable cassette
+	_ = r.w.Flush()
+}
+
+// Close flushes and closes the cassette. Safe to call twice.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.w.Flush()
+	if cerr := r.f.Close(); err == nil {
+		err = cerr
+	}
+	r.f = nil
+	return err
+}
+
+var ErrCassetteMiss = errors.New("cassette: no recorded response")
+
+// Replayer is an http.RoundTripper serving responses from a cassette
+// without touching the network. Requests are matched on method, path and
+// query; repeated requests get the recorded responses in their original
+// order. Bodies are not matched because they carry fresh client order ids.
+type Replayer struct {
+	mu      sync.Mutex
+	queues  map[string][]Interaction
+	left    int
+	done    chan struct{}
+	latency bool
+}
+
+// LoadCassette reads path for replay. With latency set, each response is
+// delayed by its recorded latency.
+func LoadCassette(path string, latency bool) (*Replayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := &Replayer{queues: make(map[string][]Interaction), done: make(chan struct{}), latency: latency}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var it Interaction
+		if err := json.Unmarshal(sc.Bytes(), &it); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		r.queues[it.key()] = append(r.queues[it.key()], it)
+		r.left++
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if r.left == 0 {
+		close(r.done)
+	}
+	return r, nil
+}
+
+// Done is closed once every recorded interaction has been served.
+func (r *Replayer) Done() <-chan struct{} { return r.done }
+
+// Remaining reports how many recorded interactions have not been served.
+func (r *Replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.left
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	k := Interaction{Method: req.Method, Path: req.URL.Path, Query: req.URL.RawQuery}.key()
+	r.mu.Lock()
+	q := r.queues[k]
+	if len(q) == 0 {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("%w for %s", ErrCassetteMiss, k)
+	}
+	it := q[0]
+	r.queues[k] = q[1:]
+	r.left--
+	if r.left == 0 {
+		close(r.done)
+	}
+	r.mu.Unlock()
+
+	if r.latency && it.LatencyMs > 0 {
+		t := time.NewTimer(time.Duration(it.LatencyMs) * time.Millisecond)
+		select {
+		case <-t.C:
+		case <-req.Context().Done():
+			t.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+	if it.Status == 0 {
+		return nil, errors.New(it.Err)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", it.Status, http.StatusText(it.Status)),
+		StatusCode:    it.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(strings.NewReader(it.Response)),
+		ContentLength: int64(len(it.Response)),
+		Request:       req,
+	}, nil
+}
@@ -7,16 +7,21 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/weex/ai_trading/bot/internal/clock"
 	"github.com/weex/ai_trading/bot/internal/config"
 	"github.com/weex/ai_trading/bot/internal/logger"
+	"github.com/weex/ai_trading/bot/internal/metrics"
 	"github.com/weex/ai_trading/bot/internal/ratelimit"
 )
 
@@ -24,34 +29,66 @@ type Client struct {
 	cfg   config.Config
 	log   *logger.Logger
 	rl    *ratelimit.RateLimiter
+	m     *metrics.Metrics
 	hc    *http.Client
-	drift int64
+	clk   clock.Clock
+	drift atomic.Int64
+	rtt   atomic.Int64
+
+	syncMu   sync.Mutex
+	smooth   float64
+	synced   bool
+	alerting bool
+
+	privMu  sync.Mutex
+	privAt  time.Time
+	privErr error
+
+	symMu   sync.Mutex
+	id2sym  map[int]string // replaced, never modified, once published
+	symFull time.Time      // last fetch of the full contract list
 }
 
-func NewClient(cfg config.Config, log *logger.Logger, rl *ratelimit.RateLimiter) *Client {
+// symbolRefetch bounds full contract list fetches (weight 10) made because
+// an account response named a contract id the cache does not know.
+const symbolRefetch = time.Minute
+
+// ErrUnknownContract is returned for account data naming a contract id
+// that the contract list, as last fetched, does not have.
+var ErrUnknownContract = errors.New("unknown contract id")
+
+func NewClient(cfg config.Config, log *logger.Logger, rl *ratelimit.RateLimiter, m *metrics.Metrics) *Client {
+	if m == nil {
+		m = metrics.New()
+	}
 	return &Client{
 		cfg: cfg,
 		log: log,
 		rl:  rl,
+		m:   m,
 		hc:  &http.Client{Timeout: 10 * time.Second},
+		clk: clock.Real(),
 	}
 }
 
-func (c *Client) serverTimestamp() string {
-	now := time.Now().UnixMilli() + c.drift
-	return strconv.FormatInt(now, 10)
+// SetClock replaces the clock used for request timestamps and time sync.
+// Call it before the client is shared.
+func (c *Client) SetClock(clk clock.Clock) {
+	c.clk = clock.Or(clk)
 }
 
-func (c *Client) SyncServerTime(ctx context.Context) error {
-	var resp struct {
-		Timestamp int64 `json:"timestamp"`
-	}
-	if err := c.doPublic(ctx, epServerTime, url.Values{}, nil, &resp); err != nil {
-		return err
-	}
-	c.drift = resp.Timestamp - time.Now().UnixMilli()
-	c.log.Info("sync_time", "server_ts", strconv.FormatInt(resp.Timestamp, 10), "drift_ms", strconv.FormatInt(c.drift, 10))
-	return nil
+// PrivateStatus returns the time and outcome of the most recent signed request.
+func (c *Client) PrivateStatus() (time.Time, error) {
+	c.privMu.Lock()
+	defer c.privMu.Unlock()
+	return c.privAt, c.privErr
+}
+
+func (c *Client) recordPrivate(err error) {
+	c.privMu.Lock()
+	c.privAt = time.Now()
+	c.privErr = err
+	c.privMu.Unlock()
 }
 
 func (c *Client) PingPrivate(ctx context.Context) error {
@@ -100,6 +137,9 @@ func (c *Client) GetContracts(ctx context.Context, symbol string) ([]Contract, e
 	}
 	var out []Contract
 	err := c.doPublic(ctx, epContracts, q, nil, &out)
+	if err == nil {
+		c.noteContracts(out, symbol == "")
+	}
 	return out, err
 }
 
@@ -111,6 +151,9 @@ type AccountsResp struct {
 			Cross         string `json:"cross_leverage"`
 			Shared        string `json:"shared_leverage"`
 		} `json:"contract_id_to_leverage_setting"`
+		ContractMode map[string]struct {
+			MarginMode string `json:"margin_mode"`
+		} `json:"contract_id_to_mode_setting"`
 	} `json:"account"`
 	Collateral []struct {
 		CoinID    int    `json:"coin_id"`
@@ -134,23 +177,24 @@ type PositionInfo struct {
 	Size     float64
 }
 
+// GetPositions returns the open positions. It fails with
+// ErrUnknownContract rather than leave out a position it cannot name.
 func (c *Client) GetPositions(ctx context.Context) ([]PositionInfo, error) {
 	var acc AccountsResp
 	if err := c.doPrivate(ctx, epAccounts, url.Values{}, nil, &acc); err != nil {
 		return nil, err
 	}
-	cs, _ := c.GetContracts(ctx, "")
-	id2sym := make(map[int]string, len(cs))
-	for _, ct := range cs {
-		if ct.ContractID != 0 && ct.Symbol != "" {
-			id2sym[ct.ContractID] = ct.Symbol
-		}
+	ids := make([]int, 0, len(acc.Position))
+	for _, p := range acc.Position {
+		ids = append(ids, p.ContractID)
 	}
+	id2sym := c.contractSymbols(ctx, ids)
 	out := make([]PositionInfo, 0, len(acc.Position))
 	for _, p := range acc.Position {
 		sym := id2sym[p.ContractID]
 		if sym == "" {
-			continue
+			// a position left out would read as flat to closes and flattens
+			return nil, fmt.Errorf("position %s: %w %d", p.Side, ErrUnknownContract, p.ContractID)
 		}
 		var levF float64
 		if p.Leverage != "" {
@@ -182,6 +226,55 @@ func (c *Client) GetPositions(ctx context.Context) ([]PositionInfo, error) {
 	return out, nil
 }
 
+// contractSymbols maps contract ids to symbols; account responses key
+// positions and settings by id. The map is cached and the full contract
+// list fetched again only when one of ids is missing, at most once per
+// symbolRefetch.
+func (c *Client) contractSymbols(ctx context.Context, ids []int) map[int]string {
+	c.symMu.Lock()
+	m, last := c.id2sym, c.symFull
+	c.symMu.Unlock()
+	missing := false
+	for _, id := range ids {
+		if _, ok := m[id]; !ok {
+			missing = true
+			break
+		}
+	}
+	if !missing || (!last.IsZero() && c.clk.Since(last) < symbolRefetch) {
+		return m
+	}
+	if _, err := c.GetContracts(ctx, ""); err != nil {
+		c.symMu.Lock()
+		c.symFull = c.clk.Now()
+		c.symMu.Unlock()
+	}
+	c.symMu.Lock()
+	defer c.symMu.Unlock()
+	return c.id2sym
+}
+
+// noteContracts adds cs to the id cache; a full list replaces it.
+func (c *Client) noteContracts(cs []Contract, full bool) {
+	c.symMu.Lock()
+	defer c.symMu.Unlock()
+	m := make(map[int]string, len(c.id2sym)+len(cs))
+	if !full {
+		for id, sym := range c.id2sym {
+			m[id] = sym
+		}
+	}
+	for _, ct := range cs {
+		if ct.ContractID != 0 && ct.Symbol != "" {
+			m[ct.ContractID] = ct.Symbol
+		}
+	}
+	c.id2sym = m
+	if full {
+		c.symFull = c.clk.Now()
+	}
+}
+
 func (c *Client) GetCollateralUSDT(ctx context.Context) (available float64, equity float64, err error) {
 	var acc AccountsResp
 	if err = c.doPrivate(ctx, epAccounts, url.Values{}, nil, &acc); err != nil {
@@ -209,6 +302,13 @@ func (c *Client) GetCollateralUSDT(ctx context.Context) (available float64, equi
 }
 
 func (c *Client) doPublic(ctx context.Context, ep endpoint, query url.Values, body any, out any) error {
+	_, _, err := c.doPublicTimed(ctx, ep, query, body, out)
+	return err
+}
+
+// doPublicTimed is doPublic that also reports when the request went out
+// and when the response was read, excluding any rate-limit wait.
+func (c *Client) doPublicTimed(ctx context.Context, ep endpoint, query url.Values, body any, out any) (sent, recv time.Time, err error) {
 	c.rl.Acquire(ep.domain, ep.weight)
 	u := c.cfg.BaseURL + ep.path
 	if len(query) > 0 {
@@ -221,32 +321,58 @@ func (c *Client) doPublic(ctx context.Context, ep endpoint, query url.Values, bo
 	}
 	req, err := http.NewRequestWithContext(ctx, ep.method, u, reqBody)
 	if err != nil {
-		return err
+		return sent, recv, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("locale", "zh-CN")
+	c.m.Requests.Inc(ep.path)
+	sent = c.clk.Now()
 	resp, err := c.hc.Do(req)
 	if err != nil {
-		c.log.Error("http_public", "path", ep.path, "err", err.Error())
-		return err
+		c.m.RequestErrors.Inc(ep.path, "transport")
+		c.log.Error(logger.EvHTTPPublic, logger.KPath, ep.path, logger.KErr, err.Error())
+		return sent, recv, err
 	}
 	defer resp.Body.Close()
 	b, _ := io.ReadAll(resp.Body)
+	recv = c.clk.Now()
+	c.m.RequestLatency.Observe(recv.Sub(sent).Seconds(), ep.path)
 	if resp.StatusCode != 200 {
-		c.log.Error("http_public", "path", ep.path, "code", strconv.Itoa(resp.StatusCode), "body", string(b))
-		return fmt.Errorf("status %d", resp.StatusCode)
+		c.m.RequestErrors.Inc(ep.path, "status")
+		c.log.Error(logger.EvHTTPPublic, logger.KPath, ep.path, logger.KCode, strconv.Itoa(resp.StatusCode), logger.KBody, string(b))
+		return sent, recv, fmt.Errorf("status %d", resp.StatusCode)
 	}
 	if out != nil {
 		if err := json.Unmarshal(b, out); err != nil {
-			c.log.Error("json_public", "path", ep.path, "err", err.Error())
-			return err
+			c.m.RequestErrors.Inc(ep.path, "json")
+			c.log.Error(logger.EvJSONPublic, logger.KPath, ep.path, logger.KErr, err.Error())
+			return sent, recv, err
 		}
 	}
-	return nil
+	return sent, recv, nil
 }
 
-func (c *Client) doPrivate(ctx context.Context, ep endpoint, query url.Values, body any, out any) error {
+func (c *Client) doPrivate(ctx context.Context, ep endpoint, query url.Values, body any, out any) (err error) {
+	defer func() {
+		if ctx.Err() == nil {
+			c.recordPrivate(err)
+		}
+	}()
+	c.rl.Acquire(ep.domain, ep.weight)
+	err = c.sendPrivate(ctx, ep, query, body, out)
+	if !errors.Is(err, ErrTimestampRejected) {
+		return err
+	}
+	// the local clock moved since the last sync: remeasure, taking the
+	// fresh sample as is, and sign once more with the corrected offset
+	if serr := c.resync(ctx, true); serr != nil {
+		return err
+	}
 	c.rl.Acquire(ep.domain, ep.weight)
+	return c.sendPrivate(ctx, ep, query, body, out)
+}
+
+func (c *Client) sendPrivate(ctx context.Context, ep endpoint, query url.Values, body any, out any) error {
 	requestPath := ep.path
 	var queryString string
 	if len(query) > 0 {
@@ -269,7 +395,7 @@ func (c *Client) doPrivate(ctx context.Context, ep endpoint, query url.Values, b
 	if len(bodyBytes) > 0 {
 		signPayload += string(bodyBytes)
 	}
-	mac := hmac.New(sha256.New, []byte(c.cfg.APISecret))
+	mac := hmac.New(sha256.New, []byte(c.cfg.APISecret.Reveal()))
 	mac.Write([]byte(signPayload))
 	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
 
@@ -281,27 +407,36 @@ func (c *Client) doPrivate(ctx context.Context, ep endpoint, query url.Values, b
 	if err != nil {
 		return err
 	}
-	req.Header.Set("ACCESS-KEY", c.cfg.APIKey)
+	req.Header.Set("ACCESS-KEY", c.cfg.APIKey.Reveal())
 	req.Header.Set("ACCESS-SIGN", signature)
 	req.Header.Set("ACCESS-TIMESTAMP", ts)
-	req.Header.Set("ACCESS-PASSPHRASE", c.cfg.Passphrase)
+	req.Header.Set("ACCESS-PASSPHRASE", c.cfg.Passphrase.Reveal())
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("locale", "zh-CN")
 
+	c.m.Requests.Inc(ep.path)
+	start := time.Now()
 	resp, err := c.hc.Do(req)
 	if err != nil {
-		c.log.Error("http_private", "path", ep.path, "err", err.Error())
+		c.m.RequestErrors.Inc(ep.path, "transport")
+		c.log.Error(logger.EvHTTPPrivate, logger.KPath, ep.path, logger.KErr, err.Error())
 		return err
 	}
 	defer resp.Body.Close()
 	b, _ := io.ReadAll(resp.Body)
+	c.m.RequestLatency.Observe(time.Since(start).Seconds(), ep.path)
 	if resp.StatusCode != 200 {
-		c.log.Error("http_private", "path", ep.path, "code", strconv.Itoa(resp.StatusCode), "body", string(b))
+		c.m.RequestErrors.Inc(ep.path, "status")
+		c.log.Error(logger.EvHTTPPrivate, logger.KPath, ep.path, logger.KCode, strconv.Itoa(resp.StatusCode), logger.KBody, string(b))
+		if timestampRejected(b) {
+			return fmt.Errorf("status %d: %w", resp.StatusCode, ErrTimestampRejected)
+		}
 		return fmt.Errorf("status %d", resp.StatusCode)
 	}
 	if out != nil {
 		if err := json.Unmarshal(b, out); err != nil {
-			c.log.Error("json_private", "path", ep.path, "err", err.Error())
+			c.m.RequestErrors.Inc(ep.path, "json")
+			c.log.Error(logger.EvJSONPrivate, logger.KPath, ep.path, logger.KErr, err.Error())
 			return err
 		}
 	}
@@ -331,3 +466,64 @@ func (c *Client) PlaceOrder(ctx context.Context, req PlaceOrderReq) (PlaceOrderR
 	}
 	return out, nil
 }
+
+// CancelOrder cancels one normal order. An order that has already
+// finished is an error; callers read its final state with GetOrder.
+func (c *Client) CancelOrder(ctx context.Context, orderID string) error {
+	return c.doPrivate(ctx, epCancelOrder, url.Values{}, map[string]string{"orderId": orderID}, nil)
+}
+
+type CancelAllReq struct {
+	CancelOrderType string `json:"cancelOrderType"`
+	Symbol          string `json:"symbol,omitempty"`
+}
+
+type CancelResult struct {
+	OrderID string `json:"orderId"`
+	Success bool   `json:"success"`
+}
+
+// CancelAllOrders cancels every open normal order for symbol, or for all
+// symbols when symbol is empty.
+func (c *Client) CancelAllOrders(ctx context.Context, symbol string) ([]CancelResult, error) {
+	var out []CancelResult
+	req := CancelAllReq{CancelOrderType: "normal", Symbol: symbol}
+	if err := c.doPrivate(ctx, epCancelAll, url.Values{}, req, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type OpenOrder struct {
+	Symbol     string `json:"symbol"`
+	OrderID    string `json:"order_id"`
+	ClientOID  string `json:"client_oid"`
+	Size       string `json:"size"`
+	FilledQty  string `json:"filled_qty"`
+	Price      string `json:"price"`
+	PriceAvg   string `json:"price_avg"`
+	Type       string `json:"type"`
+	OrderType  string `json:"order_type"`
+	Status     string `json:"status"`
+	CreateTime string `json:"createTime"`
+}
+
+// GetOpenOrders lists resting orders for symbol, or for all symbols when
+// symbol is empty.
+func (c *Client) GetOpenOrders(ctx context.Context, symbol string) ([]OpenOrder, error) {
+	q := url.Values{}
+	if symbol != "" {
+		q.Set("symbol", symbol)
+	}
+	var out []OpenOrder
+	if err := c.doPrivate(ctx, epOpenOrders, q, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SetTransport replaces the HTTP transport, e.g. with a Recorder or
+// Replayer. Call it before the first request.
+func (c *Client) SetTransport(rt http.RoundTripper) {
+	c.hc.Transport = rt
+}
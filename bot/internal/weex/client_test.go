@@ -0,0 +1,445 @@
+package weex
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/weex/ai_trading/bot/internal/clock"
+	"github.com/weex/ai_trading/bot/internal/config"
+	"github.com/weex/ai_trading/bot/internal/logger"
+	"github.com/weex/ai_trading/bot/internal/metrics"
+	"github.com/weex/ai_trading/bot/internal/ratelimit"
+	"github.com/weex/ai_trading/bot/internal/weex/weextest"
+)
+
+const sym = "cmt_btcusdt"
+
+func newTestClient(t *testing.T, cfg weextest.Config) (*weextest.Server, *Client) {
+	t.Helper()
+	s := weextest.New(cfg)
+	t.Cleanup(s.Close)
+	return s, clientFor(t, s.ClientConfig())
+}
+
+func clientFor(t *testing.T, cfg config.Config) *Client {
+	log := logger.New(logger.Config{Dir: t.TempDir()})
+	t.Cleanup(log.Close)
+	rl := ratelimit.New(ratelimit.Config{IPCapacity: 500, UIDCapacity: 500, Window: 10 * time.Second})
+	return NewClient(cfg, log, rl, metrics.New())
+}
+
+func ctxTimeout(t *testing.T, d time.Duration) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestSignedRequest(t *testing.T) {
+	_, c := newTestClient(t, weextest.Config{Equity: 5000})
+	avail, eq, err := c.GetCollateralUSDT(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if avail != 5000 || eq != 5000 {
+		t.Fatalf("collateral = %v/%v, want 5000/5000", avail, eq)
+	}
+	if _, perr := c.PrivateStatus(); perr != nil {
+		t.Fatalf("private status: %v", perr)
+	}
+}
+
+func TestWrongSecretRejected(t *testing.T) {
+	s, _ := newTestClient(t, weextest.Config{})
+	cfg := s.ClientConfig()
+	cfg.APISecret = "other"
+	c := clientFor(t, cfg)
+	if err := c.PingPrivate(context.Background()); err == nil {
+		t.Fatal("request signed with the wrong secret was accepted")
+	}
+	if _, perr := c.PrivateStatus(); perr == nil {
+		t.Fatal("private status not recorded as failed")
+	}
+}
+
+func TestTimestampRejectedResyncs(t *testing.T) {
+	s, c := newTestClient(t, weextest.Config{})
+	// the local clock is now a minute behind the exchange and the client
+	// has not synced: the first signature is refused, the retry is not
+	s.SetClockOffset(time.Minute)
+	if err := c.PingPrivate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Hits("/capi/v2/account/accounts"); got != 2 {
+		t.Fatalf("accounts hits = %d, want 2 (rejected, then re-signed)", got)
+	}
+	if got := s.Hits("/capi/v2/market/time"); got != 1 {
+		t.Fatalf("time hits = %d, want 1", got)
+	}
+	if d := c.Drift(); d < 59000 || d > 61000 {
+		t.Fatalf("drift = %dms, want about 60000", d)
+	}
+}
+
+func TestTimestampRejectedResyncFails(t *testing.T) {
+	s, c := newTestClient(t, weextest.Config{})
+	s.SetClockOffset(time.Minute)
+	s.Inject("/capi/v2/market/time", weextest.FaultServerError, 1)
+	err := c.PingPrivate(context.Background())
+	if !errors.Is(err, ErrTimestampRejected) {
+		t.Fatalf("err = %v, want ErrTimestampRejected", err)
+	}
+	if got := s.Hits("/capi/v2/account/accounts"); got != 1 {
+		t.Fatalf("accounts hits = %d, want 1 (no retry without a new offset)", got)
+	}
+}
+
+// near reports whether got is within tol of want, in ms; the server reads
+// the wall clock, so a few ms pass between its stamp and the check.
+func near(got, want, tol int64) bool { return got >= want-tol && got <= want+tol }
+
+func TestTimeSyncManualClock(t *testing.T) {
+	const timePath = "/capi/v2/market/time"
+	s, c := newTestClient(t, weextest.Config{})
+	// the local clock is stopped five minutes behind the exchange
+	clk := clock.NewManual(time.Now().Add(-5 * time.Minute))
+	c.SetClock(clk)
+	if err := c.SyncServerTime(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if d := c.Drift(); !near(d, 300000, 2000) {
+		t.Fatalf("drift = %dms, want about 300000", d)
+	}
+	if rtt := c.RTT(); rtt != 0 {
+		t.Fatalf("rtt = %dms on a stopped clock, want 0", rtt)
+	}
+	// signed with the synced offset, so accepted without a resync
+	if err := c.PingPrivate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Hits(timePath); got != 1 {
+		t.Fatalf("time hits = %d, want 1", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.RunTimeSync(ctx, time.Minute)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	clk.BlockUntil(1)
+	if got := s.Hits(timePath); got != 1 {
+		t.Fatalf("time hits before the interval = %d, want 1", got)
+	}
+	// a minute passes locally; the exchange also jumps ten seconds ahead,
+	// so the sample is 4m10s and the estimate moves 30% of the way there
+	s.SetClockOffset(10 * time.Second)
+	clk.Advance(time.Minute)
+	deadline := time.Now().Add(2 * time.Second)
+	for s.Hits(timePath) < 2 || c.Drift() > 290000 {
+		if time.Now().After(deadline) {
+			t.Fatalf("no resync after the interval: time hits %d, drift %dms", s.Hits(timePath), c.Drift())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if d := c.Drift(); !near(d, 285000, 2000) {
+		t.Fatalf("drift = %dms, want about 285000", d)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	const path = "/capi/v2/market/ticker"
+	for _, tt := range []struct {
+		name  string
+		fault weextest.Fault
+	}{
+		{"rate limit", weextest.FaultRateLimit},
+		{"server error", weextest.FaultServerError},
+		{"malformed", weextest.FaultMalformed},
+		{"timeout", weextest.FaultTimeout},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestClient(t, weextest.Config{})
+			s.Inject(path, tt.fault, 1)
+			if _, err := c.GetTicker(ctxTimeout(t, 200*time.Millisecond), sym); err == nil {
+				t.Fatal("faulted request succeeded")
+			}
+			// the fault is used up; the next request goes through
+			tk, err := c.GetTicker(context.Background(), sym)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tk.Last != "100" {
+				t.Fatalf("last = %q, want 100", tk.Last)
+			}
+			if got := s.Hits(path); got != 2 {
+				t.Fatalf("hits = %d, want 2", got)
+			}
+		})
+	}
+}
+
+func TestPrivateFaultPlacesNothing(t *testing.T) {
+	const path = "/capi/v2/order/placeOrder"
+	for _, f := range []weextest.Fault{weextest.FaultRateLimit, weextest.FaultServerError, weextest.FaultTimeout} {
+		s, c := newTestClient(t, weextest.Config{})
+		s.Inject(path, f, 1)
+		req := PlaceOrderReq{Symbol: sym, ClientOID: "a", Size: "1", Type: "1", OrderType: "0", MatchPrice: "1"}
+		if _, err := c.PlaceOrder(ctxTimeout(t, 200*time.Millisecond), req); err == nil {
+			t.Fatalf("fault %d: order accepted", f)
+		}
+		if n := len(s.Orders()); n != 0 {
+			t.Fatalf("fault %d: %d orders on the exchange, want 0", f, n)
+		}
+		if _, err := c.PlaceOrder(context.Background(), req); err != nil {
+			t.Fatalf("fault %d: retry: %v", f, err)
+		}
+		if n := len(s.Orders()); n != 1 {
+			t.Fatalf("fault %d: %d orders after retry, want 1", f, n)
+		}
+	}
+}
+
+func TestLimitOrderFillsOnStep(t *testing.T) {
+	s, c := newTestClient(t, weextest.Config{})
+	ctx := context.Background()
+	s.Script(sym,
+		weextest.Quote{Last: 100, Bid: 99.9, Ask: 100.1, Mark: 100, Index: 100},
+		weextest.Quote{Last: 99.6, Bid: 99.5, Ask: 99.7, Mark: 99.6, Index: 99.6},
+		weextest.Quote{Last: 99.3, Bid: 99.2, Ask: 99.4, Mark: 99.3, Index: 99.3},
+	)
+	resp, err := c.PlaceOrder(ctx, PlaceOrderReq{Symbol: sym, ClientOID: "b1", Size: "2", Type: "1", OrderType: "0", MatchPrice: "0", Price: "99.5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for step, want := range []string{"open", "open", "filled"} {
+		if step > 0 {
+			s.Step()
+		}
+		d, err := c.GetOrder(ctx, resp.OrderID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Status != want {
+			t.Fatalf("step %d: status %q, want %q", step, d.Status, want)
+		}
+	}
+	d, _ := c.GetOrder(ctx, resp.OrderID)
+	if d.FilledQty != "2" || d.PriceAvg != "99.5" || !d.Done() {
+		t.Fatalf("fill = %s @ %s, want 2 @ 99.5", d.FilledQty, d.PriceAvg)
+	}
+	pos, err := c.GetPositions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pos) != 1 || pos[0].Symbol != sym || pos[0].Side != "long" || pos[0].Size != 2 {
+		t.Fatalf("positions = %+v, want long 2 %s", pos, sym)
+	}
+	open, err := c.GetOpenOrders(ctx, sym)
+	if err != nil || len(open) != 0 {
+		t.Fatalf("open orders = %v, %v; want none", open, err)
+	}
+}
+
+func TestCloseBeyondPositionRejected(t *testing.T) {
+	s, c := newTestClient(t, weextest.Config{})
+	ctx := context.Background()
+	s.SetPosition(weextest.Position{Symbol: sym, Side: "SHORT", Size: 1, EntryPrice: 100})
+	if _, err := c.PlaceOrder(ctx, PlaceOrderReq{Symbol: sym, ClientOID: "c1", Size: "1.5", Type: "4", OrderType: "0", MatchPrice: "1"}); err == nil {
+		t.Fatal("close larger than the position was accepted")
+	}
+	if _, err := c.PlaceOrder(ctx, PlaceOrderReq{Symbol: sym, ClientOID: "c2", Size: "1", Type: "4", OrderType: "0", MatchPrice: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if pos := s.Positions(); len(pos) != 0 {
+		t.Fatalf("positions = %+v, want none", pos)
+	}
+}
+
+func TestPostOnlyCrossingRejected(t *testing.T) {
+	_, c := newTestClient(t, weextest.Config{})
+	ctx := context.Background()
+	if _, err := c.PlaceOrder(ctx, PlaceOrderReq{Symbol: sym, ClientOID: "p1", Size: "1", Type: "1", OrderType: "1", MatchPrice: "0", Price: "100.1"}); err == nil {
+		t.Fatal("post-only buy at the ask was accepted")
+	}
+	resp, err := c.PlaceOrder(ctx, PlaceOrderReq{Symbol: sym, ClientOID: "p2", Size: "1", Type: "1", OrderType: "1", MatchPrice: "0", Price: "99.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CancelOrder(ctx, resp.OrderID); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CancelOrder(ctx, resp.OrderID); err == nil {
+		t.Fatal("second cancel of the same order succeeded")
+	}
+	d, _ := c.GetOrder(ctx, resp.OrderID)
+	if d.Status != "canceled" || !d.Done() {
+		t.Fatalf("status = %q, want canceled", d.Status)
+	}
+}
+
+func TestTpSlLifecycle(t *testing.T) {
+	s, c := newTestClient(t, weextest.Config{})
+	ctx := context.Background()
+	s.SetPosition(weextest.Position{Symbol: sym, Side: "LONG", Size: 1, EntryPrice: 100})
+	sl, err := c.PlaceTpSl(ctx, TpSlReq{Symbol: sym, PlanType: PlanStopLoss, TriggerPrice: "95", ExecutePrice: "0", Size: "1", PositionSide: "long"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp, err := c.PlaceTpSl(ctx, TpSlReq{Symbol: sym, PlanType: PlanTakeProfit, TriggerPrice: "110", ExecutePrice: "0", Size: "1", PositionSide: "long"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plans, err := c.GetPlanOrders(ctx, sym)
+	if err != nil || len(plans) != 2 {
+		t.Fatalf("plans = %v, %v; want 2", plans, err)
+	}
+	if err := c.ModifyTpSl(ctx, ModifyTpSlReq{OrderID: sl.OrderID, TriggerPrice: "97", ExecutePrice: "0"}); err != nil {
+		t.Fatal(err)
+	}
+	// 96 is past the amended stop but not the original one
+	s.Script(sym, weextest.Quote{Last: 100, Bid: 99.9, Ask: 100.1, Mark: 100, Index: 100}, weextest.Quote{Last: 96, Bid: 95.9, Ask: 96.1, Mark: 96, Index: 96})
+	s.Step()
+	if pos := s.Positions(); len(pos) != 0 {
+		t.Fatalf("positions = %+v, want closed by the stop", pos)
+	}
+	if plans, _ := c.GetPlanOrders(ctx, sym); len(plans) != 0 {
+		t.Fatalf("live plans = %v, want none", plans)
+	}
+	status := map[string]string{}
+	for _, p := range s.Plans() {
+		status[p.ID] = p.Status
+	}
+	if status[sl.OrderID] != "triggered" || status[tp.OrderID] != "canceled" {
+		t.Fatalf("stop %s, target %s; want triggered, canceled", status[sl.OrderID], status[tp.OrderID])
+	}
+	// only the history tells the stop that fired from the dropped target
+	hist, err := c.GetPlanHistory(ctx, sym, time.Time{})
+	if err != nil || len(hist) != 2 {
+		t.Fatalf("history = %v, %v; want 2", hist, err)
+	}
+	for _, h := range hist {
+		if want := h.OrderID == sl.OrderID; h.Triggered() != want {
+			t.Fatalf("plan %s status %q: triggered = %v, want %v", h.OrderID, h.Status, h.Triggered(), want)
+		}
+	}
+	if err := c.CancelPlan(ctx, tp.OrderID); err == nil {
+		t.Fatal("cancel of a dropped plan succeeded")
+	}
+}
+
+func TestPlanOrderLifecycle(t *testing.T) {
+	s, c := newTestClient(t, weextest.Config{})
+	ctx := context.Background()
+	s.Script(sym,
+		weextest.Quote{Last: 100, Bid: 99.9, Ask: 100.1, Mark: 100, Index: 100},
+		weextest.Quote{Last: 105, Bid: 104.9, Ask: 105.1, Mark: 105, Index: 105},
+	)
+	breakout, err := c.PlacePlanOrder(ctx, PlanOrderReq{Symbol: sym, ClientOID: "pl1", Size: "1", Type: "1", MatchPrice: "1", TriggerPrice: "104"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dip, err := c.PlacePlanOrder(ctx, PlanOrderReq{Symbol: sym, ClientOID: "pl2", Size: "1", Type: "1", MatchPrice: "0", ExecutePrice: "94", TriggerPrice: "95"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CancelPlan(ctx, dip.OrderID); err != nil {
+		t.Fatal(err)
+	}
+	plans, _ := c.GetPlanOrders(ctx, "")
+	if len(plans) != 1 || plans[0].OrderID != breakout.OrderID {
+		t.Fatalf("plans = %+v, want only %s", plans, breakout.OrderID)
+	}
+	s.Step()
+	pos := s.Positions()
+	if len(pos) != 1 || pos[0].Side != "LONG" || pos[0].Size != 1 || pos[0].EntryPrice != 105.1 {
+		t.Fatalf("positions = %+v, want long 1 @ 105.1 from the triggered plan", pos)
+	}
+	if plans, _ := c.GetPlanOrders(ctx, ""); len(plans) != 0 {
+		t.Fatalf("plans = %+v, want none after the trigger", plans)
+	}
+	orders := s.Orders()
+	if len(orders) != 1 || orders[0].Status != "filled" || !orders[0].Market {
+		t.Fatalf("orders = %+v, want one filled market order", orders)
+	}
+	if _, err := c.GetOrder(ctx, orders[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.Plans()); n != 2 {
+		t.Fatalf("plans kept = %d, want 2", n)
+	}
+}
+
+func TestContractSymbolsCached(t *testing.T) {
+	const contractsPath = "/capi/v2/market/contracts"
+	s, c := newTestClient(t, weextest.Config{})
+	clk := clock.NewManual(time.Now())
+	c.SetClock(clk)
+	ctx := context.Background()
+	s.SetPosition(weextest.Position{Symbol: sym, Side: "LONG", Size: 1, EntryPrice: 100})
+	for i := 0; i < 3; i++ {
+		pos, err := c.GetPositions(ctx)
+		if err != nil || len(pos) != 1 || pos[0].Symbol != sym {
+			t.Fatalf("positions = %+v, %v; want long %s", pos, err, sym)
+		}
+	}
+	if got := s.Hits(contractsPath); got != 1 {
+		t.Fatalf("contracts hits = %d, want 1", got)
+	}
+	// a contract listed after the cache was filled: one refetch learns it,
+	// a second unknown id inside symbolRefetch does not fetch again and
+	// fails the call instead of leaving the position out
+	clk.Advance(symbolRefetch)
+	const listed = "cmt_newusdt"
+	s.Script(listed, weextest.Quote{Last: 5, Bid: 4.9, Ask: 5.1, Mark: 5, Index: 5})
+	s.SetPosition(weextest.Position{Symbol: listed, Side: "SHORT", Size: 2, EntryPrice: 5})
+	if pos, err := c.GetPositions(ctx); err != nil || len(pos) != 2 {
+		t.Fatalf("positions = %+v, %v; want 2", pos, err)
+	}
+	const later = "cmt_laterusdt"
+	s.Script(later, weextest.Quote{Last: 5, Bid: 4.9, Ask: 5.1, Mark: 5, Index: 5})
+	s.SetPosition(weextest.Position{Symbol: later, Side: "SHORT", Size: 2, EntryPrice: 5})
+	if pos, err := c.GetPositions(ctx); !errors.Is(err, ErrUnknownContract) {
+		t.Fatalf("positions inside the refetch interval = %+v, %v; want ErrUnknownContract", pos, err)
+	}
+	if got := s.Hits(contractsPath); got != 2 {
+		t.Fatalf("contracts hits = %d, want 2", got)
+	}
+	clk.Advance(symbolRefetch)
+	if pos, err := c.GetPositions(ctx); err != nil || len(pos) != 3 {
+		t.Fatalf("positions after the refetch interval = %+v, %v; want 3", pos, err)
+	}
+	if got := s.Hits(contractsPath); got != 3 {
+		t.Fatalf("contracts hits = %d, want 3", got)
+	}
+}
+
+func TestCancelAllPlans(t *testing.T) {
+	s, c := newTestClient(t, weextest.Config{})
+	ctx := context.Background()
+	s.SetPosition(weextest.Position{Symbol: sym, Side: "LONG", Size: 1, EntryPrice: 100})
+	for _, px := range []string{"95", "110"} {
+		typ := PlanStopLoss
+		if px == "110" {
+			typ = PlanTakeProfit
+		}
+		if _, err := c.PlaceTpSl(ctx, TpSlReq{Symbol: sym, PlanType: typ, TriggerPrice: px, ExecutePrice: "0", Size: "1", PositionSide: "long"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.PlacePlanOrder(ctx, PlanOrderReq{Symbol: sym, Size: "1", Type: "1", MatchPrice: "1", ExecutePrice: "0", TriggerPrice: "90"}); err != nil {
+		t.Fatal(err)
+	}
+	n, err := c.CancelAllPlans(ctx, "")
+	if err != nil || n != 3 {
+		t.Fatalf("cancelled %d, %v; want 3", n, err)
+	}
+	if plans, _ := c.GetPlanOrders(ctx, ""); len(plans) != 0 {
+		t.Fatalf("live plans = %v, want none", plans)
+	}
+}
@@ -10,14 +10,26 @@ type endpoint struct {
 }
 
 var (
-    epServerTime = endpoint{"/capi/v2/market/time", "GET", 1, ratelimit.IP}
-    epTicker     = endpoint{"/capi/v2/market/ticker", "GET", 1, ratelimit.IP}
-    epIndex      = endpoint{"/capi/v2/market/index", "GET", 1, ratelimit.IP}
-    epDepth      = endpoint{"/capi/v2/market/depth", "GET", 1, ratelimit.IP}
-    epFundRate   = endpoint{"/capi/v2/market/currentFundRate", "GET", 1, ratelimit.IP}
-    epAccounts   = endpoint{"/capi/v2/account/accounts", "GET", 5, ratelimit.UID}
-    epContracts  = endpoint{"/capi/v2/market/contracts", "GET", 10, ratelimit.IP}
-    epPlaceOrder = endpoint{"/capi/v2/order/placeOrder", "POST", 5, ratelimit.UID}
+    epServerTime  = endpoint{"/capi/v2/market/time", "GET", 1, ratelimit.IP}
+    epTicker      = endpoint{"/capi/v2/market/ticker", "GET", 1, ratelimit.IP}
+    epIndex       = endpoint{"/capi/v2/market/index", "GET", 1, ratelimit.IP}
+    epDepth       = endpoint{"/capi/v2/market/depth", "GET", 1, ratelimit.IP}
+    epFundRate    = endpoint{"/capi/v2/market/currentFundRate", "GET", 1, ratelimit.IP}
+    epAccounts    = endpoint{"/capi/v2/account/accounts", "GET", 5, ratelimit.UID}
+    epContracts   = endpoint{"/capi/v2/market/contracts", "GET", 10, ratelimit.IP}
+    epPlaceOrder  = endpoint{"/capi/v2/order/placeOrder", "POST", 5, ratelimit.UID}
+    epCancelAll   = endpoint{"/capi/v2/order/cancelAllOrders", "POST", 40, ratelimit.UID}
+    epCancelOrder = endpoint{"/capi/v2/order/cancel_order", "POST", 2, ratelimit.UID}
+    epOpenOrders  = endpoint{"/capi/v2/order/current", "GET", 2, ratelimit.UID}
+    epLeverage    = endpoint{"/capi/v2/account/leverage", "POST", 10, ratelimit.UID}
+    epMarginMode  = endpoint{"/capi/v2/account/position/changeHoldModel", "POST", 20, ratelimit.UID}
+    epOrderDetail = endpoint{"/capi/v2/order/detail", "GET", 2, ratelimit.UID}
+    epPlaceTpSl   = endpoint{"/capi/v2/order/placeTpSlOrder", "POST", 2, ratelimit.UID}
+    epModifyTpSl  = endpoint{"/capi/v2/order/modifyTpSlOrder", "POST", 2, ratelimit.UID}
+    epPlacePlan   = endpoint{"/capi/v2/order/plan_order", "POST", 2, ratelimit.UID}
+    epCancelPlan  = endpoint{"/capi/v2/order/cancel_plan", "POST", 2, ratelimit.UID}
+    epPlanOrders  = endpoint{"/capi/v2/order/currentPlan", "GET", 2, ratelimit.UID}
+    epPlanHistory = endpoint{"/capi/v2/order/historyPlan", "GET", 5, ratelimit.UID}
 )
 
 type Ticker struct {
@@ -0,0 +1,176 @@
+package weex
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type OrderDetail struct {
+	Symbol    string `json:"symbol"`
+	OrderID   string `json:"order_id"`
+	ClientOID string `json:"client_oid"`
+	Size      string `json:"size"`
+	FilledQty string `json:"filled_qty"`
+	PriceAvg  string `json:"price_avg"`
+	Type      string `json:"type"`
+	Status    string `json:"status"`
+}
+
+// Done reports whether the order can no longer fill.
+func (o OrderDetail) Done() bool {
+	switch o.Status {
+	case "filled", "canceled", "cancelled":
+		return true
+	}
+	return false
+}
+
+func (c *Client) GetOrder(ctx context.Context, orderID string) (OrderDetail, error) {
+	q := url.Values{}
+	q.Set("orderId", orderID)
+	var out OrderDetail
+	if err := c.doPrivate(ctx, epOrderDetail, q, nil, &out); err != nil {
+		return OrderDetail{}, err
+	}
+	return out, nil
+}
+
+// Plan types of a TP/SL order attached to a position.
+const (
+	PlanTakeProfit = "profit_plan"
+	PlanStopLoss   = "loss_plan"
+)
+
+// TpSlReq closes Size of the position on PositionSide ("long" or "short")
+// once the trigger price trades. ExecutePrice "0" closes at market.
+type TpSlReq struct {
+	Symbol       string `json:"symbol"`
+	ClientOID    string `json:"clientOrderId"`
+	PlanType     string `json:"planType"`
+	TriggerPrice string `json:"triggerPrice"`
+	ExecutePrice string `json:"executePrice"`
+	Size         string `json:"size"`
+	PositionSide string `json:"positionSide"`
+}
+
+type PlanOrderResp struct {
+	OrderID string `json:"order_id"`
+}
+
+// PlaceTpSl attaches a take-profit or stop-loss to an open position. The
+// exchange drops it when the position is closed.
+func (c *Client) PlaceTpSl(ctx context.Context, req TpSlReq) (PlanOrderResp, error) {
+	var out PlanOrderResp
+	if err := c.doPrivate(ctx, epPlaceTpSl, url.Values{}, req, &out); err != nil {
+		return PlanOrderResp{}, err
+	}
+	return out, nil
+}
+
+type ModifyTpSlReq struct {
+	OrderID      string `json:"orderId"`
+	TriggerPrice string `json:"triggerPrice"`
+	ExecutePrice string `json:"executePrice"`
+}
+
+// ModifyTpSl moves the trigger of a live TP/SL order.
+func (c *Client) ModifyTpSl(ctx context.Context, req ModifyTpSlReq) error {
+	return c.doPrivate(ctx, epModifyTpSl, url.Values{}, req, nil)
+}
+
+// PlanOrderReq is a conditional order: once TriggerPrice trades, an order
+// of Type (1 open long, 2 open short, 3 close long, 4 close short) is
+// placed at ExecutePrice, or at market when MatchPrice is "1".
+type PlanOrderReq struct {
+	Symbol       string `json:"symbol"`
+	ClientOID    string `json:"client_oid"`
+	Size         string `json:"size"`
+	Type         string `json:"type"`
+	MatchPrice   string `json:"match_price"`
+	ExecutePrice string `json:"execute_price"`
+	TriggerPrice string `json:"trigger_price"`
+}
+
+func (c *Client) PlacePlanOrder(ctx context.Context, req PlanOrderReq) (PlanOrderResp, error) {
+	var out PlanOrderResp
+	if err := c.doPrivate(ctx, epPlacePlan, url.Values{}, req, &out); err != nil {
+		return PlanOrderResp{}, err
+	}
+	return out, nil
+}
+
+// CancelPlan cancels a conditional or TP/SL order.
+func (c *Client) CancelPlan(ctx context.Context, orderID string) error {
+	return c.doPrivate(ctx, epCancelPlan, url.Values{}, map[string]string{"orderId": orderID}, nil)
+}
+
+type PlanOrder struct {
+	Symbol       string `json:"symbol"`
+	OrderID      string `json:"order_id"`
+	Type         string `json:"type"`
+	Size         string `json:"size"`
+	TriggerPrice string `json:"trigger_price"`
+	Status       string `json:"status"`
+}
+
+// GetPlanOrders lists untriggered conditional and TP/SL orders for symbol,
+// or for all symbols when symbol is empty.
+func (c *Client) GetPlanOrders(ctx context.Context, symbol string) ([]PlanOrder, error) {
+	q := url.Values{}
+	if symbol != "" {
+		q.Set("symbol", symbol)
+	}
+	var out []PlanOrder
+	if err := c.doPrivate(ctx, epPlanOrders, q, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Triggered reports whether a plan order from the history fired rather
+// than being cancelled or expiring.
+func (p PlanOrder) Triggered() bool {
+	switch strings.ToLower(p.Status) {
+	case "triggered", "executed", "success":
+		return true
+	}
+	return false
+}
+
+// GetPlanHistory lists conditional and TP/SL orders of symbol that are no
+// longer live, triggered or cancelled, created since since.
+func (c *Client) GetPlanHistory(ctx context.Context, symbol string, since time.Time) ([]PlanOrder, error) {
+	q := url.Values{}
+	q.Set("symbol", symbol)
+	if !since.IsZero() {
+		q.Set("startTime", strconv.FormatInt(since.UnixMilli(), 10))
+	}
+	var out []PlanOrder
+	if err := c.doPrivate(ctx, epPlanHistory, q, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CancelAllPlans cancels every live plan order of symbol, or of all
+// symbols when symbol is empty, and returns how many it cancelled.
+func (c *Client) CancelAllPlans(ctx context.Context, symbol string) (int, error) {
+	plans, err := c.GetPlanOrders(ctx, symbol)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	var errs []error
+	for _, p := range plans {
+		if err := c.CancelPlan(ctx, p.OrderID); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		n++
+	}
+	return n, errors.Join(errs...)
+}
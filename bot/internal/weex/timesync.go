@@ -0,0 +1,132 @@
+package weex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/weex/ai_trading/bot/internal/logger"
+)
+
+// driftAlpha weights a new drift sample against the running estimate, so
+// one slow round trip cannot swing the offset used for signing.
+const driftAlpha = 0.3
+
+// ErrTimestampRejected marks a signed request refused because its
+// ACCESS-TIMESTAMP was outside the server's window.
+var ErrTimestampRejected = errors.New("request timestamp rejected")
+
+func (c *Client) serverTimestamp() string {
+	now := c.clk.Now().UnixMilli() + c.drift.Load()
+	return strconv.FormatInt(now, 10)
+}
+
+// SyncServerTime measures the server clock and folds the sample into the
+// smoothed drift estimate. The first sample is taken as is.
+func (c *Client) SyncServerTime(ctx context.Context) error {
+	return c.resync(ctx, false)
+}
+
+// resync takes one sample: the server timestamp is compared with the local
+// midpoint of the round trip, which cancels symmetric network delay. reset
+// replaces the estimate instead of smoothing into it.
+func (c *Client) resync(ctx context.Context, reset bool) error {
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+	var resp struct {
+		Timestamp int64 `json:"timestamp"`
+	}
+	sent, recv, err := c.doPublicTimed(ctx, epServerTime, url.Values{}, nil, &resp)
+	if err != nil {
+		return err
+	}
+	rtt := recv.Sub(sent)
+	mid := sent.Add(rtt / 2)
+	sample := float64(resp.Timestamp - mid.UnixMilli())
+	if reset || !c.synced {
+		c.smooth = sample
+		c.synced = true
+	} else {
+		c.smooth += driftAlpha * (sample - c.smooth)
+	}
+	drift := int64(math.Round(c.smooth))
+	c.drift.Store(drift)
+	c.rtt.Store(rtt.Milliseconds())
+	kv := []string{logger.KServerTS, strconv.FormatInt(resp.Timestamp, 10), logger.KDriftMs, strconv.FormatInt(drift, 10),
+		logger.KSampleMs, strconv.FormatFloat(sample, 'f', 0, 64), logger.KRTTMs, strconv.FormatInt(rtt.Milliseconds(), 10)}
+	if reset {
+		kv = append(kv, logger.KReason, "timestamp_rejected")
+	}
+	c.log.Info(logger.EvSyncTime, kv...)
+	c.checkDriftLocked(drift)
+	return nil
+}
+
+// checkDriftLocked alerts once when the drift crosses the threshold and
+// once when it is back under it.
+func (c *Client) checkDriftLocked(drift int64) {
+	limit := int64(c.cfg.DriftAlertMs)
+	if limit <= 0 {
+		return
+	}
+	over := drift > limit || drift < -limit
+	switch {
+	case over && !c.alerting:
+		c.log.Error(logger.EvDriftAlert, logger.KDriftMs, strconv.FormatInt(drift, 10), logger.KThresholdMs, strconv.FormatInt(limit, 10))
+	case !over && c.alerting:
+		c.log.Info(logger.EvDriftAlert, logger.KDriftMs, strconv.FormatInt(drift, 10), logger.KThresholdMs, strconv.FormatInt(limit, 10), logger.KMsg, "recovered")
+	}
+	c.alerting = over
+}
+
+// RunTimeSync resyncs every interval until ctx is done. Failures are
+// logged and the previous estimate kept.
+func (c *Client) RunTimeSync(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	t := c.clk.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+			if err := c.SyncServerTime(ctx); err != nil && ctx.Err() == nil {
+				c.log.Error(logger.EvSyncTime, logger.KErr, err.Error())
+			}
+		}
+	}
+}
+
+// Drift returns the smoothed server-minus-local clock offset in ms.
+func (c *Client) Drift() int64 {
+	return c.drift.Load()
+}
+
+// RTT returns the round trip of the last time sync in ms.
+func (c *Client) RTT() int64 {
+	return c.rtt.Load()
+}
+
+// timestampRejected reports whether an error body is the exchange refusing
+// ACCESS-TIMESTAMP: codes 40005/40008, or a message naming the timestamp.
+func timestampRejected(body []byte) bool {
+	var e struct {
+		Code json.RawMessage `json:"code"`
+		Msg  string          `json:"msg"`
+	}
+	if json.Unmarshal(body, &e) != nil {
+		return false
+	}
+	switch strings.Trim(string(e.Code), `"`) {
+	case "40005", "40008":
+		return true
+	}
+	return strings.Contains(strings.ToLower(e.Msg), "timestamp")
+}
@@ -0,0 +1,116 @@
+package weextest
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// Settings is one symbol's margin mode (SHARED or ISOLATED) and leverage
+// per side. New servers start every symbol at SHARED 20x.
+type Settings struct {
+	MarginMode string
+	Long       float64
+	Short      float64
+}
+
+// Settings returns the account settings of symbol.
+func (s *Server) Settings(symbol string) Settings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st := s.settings[symbol]; st != nil {
+		return *st
+	}
+	return Settings{}
+}
+
+// SetSettings replaces the account settings of symbol, e.g. to start from
+// a mismatch.
+func (s *Server) SetSettings(symbol string, st Settings) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp := st
+	s.settings[symbol] = &cp
+}
+
+func (s *Server) accountSettingsLocked() map[string]any {
+	lev := map[string]any{}
+	mode := map[string]any{}
+	for sym, st := range s.settings {
+		id := strconv.Itoa(s.contracts[sym].id)
+		shared := "0"
+		if st.MarginMode == "SHARED" {
+			shared = ff(st.Long)
+		}
+		lev[id] = map[string]string{
+			"isolated_long_leverage":  ff(st.Long),
+			"isolated_short_leverage": ff(st.Short),
+			"cross_leverage":          shared,
+			"shared_leverage":         shared,
+		}
+		mode[id] = map[string]string{"margin_mode": st.MarginMode}
+	}
+	return map[string]any{"contract_id_to_leverage_setting": lev, "contract_id_to_mode_setting": mode}
+}
+
+func marginModeName(code int) string {
+	switch code {
+	case 1:
+		return "SHARED"
+	case 3:
+		return "ISOLATED"
+	}
+	return ""
+}
+
+func (s *Server) handleMarginMode(w http.ResponseWriter, r *http.Request, body []byte) (any, int) {
+	var req struct {
+		Symbol     string `json:"symbol"`
+		MarginMode int    `json:"marginMode"`
+	}
+	if err := decodeBody(body, &req); err != nil {
+		return "bad request body: " + err.Error(), http.StatusBadRequest
+	}
+	st := s.settings[req.Symbol]
+	mode := marginModeName(req.MarginMode)
+	if st == nil || mode == "" {
+		return "invalid symbol or marginMode", http.StatusBadRequest
+	}
+	if mode == st.MarginMode {
+		return map[string]string{"msg": "success"}, http.StatusOK
+	}
+	for _, side := range []string{"LONG", "SHORT"} {
+		if p := s.positions[posKey{req.Symbol, side}]; p != nil && p.Size > 0 {
+			return "margin mode cannot change with open positions", http.StatusBadRequest
+		}
+	}
+	for _, o := range s.orders {
+		if o.Symbol == req.Symbol && o.Status == "open" {
+			return "margin mode cannot change with open orders", http.StatusBadRequest
+		}
+	}
+	st.MarginMode = mode
+	return map[string]string{"msg": "success"}, http.StatusOK
+}
+
+func (s *Server) handleLeverage(w http.ResponseWriter, r *http.Request, body []byte) (any, int) {
+	var req struct {
+		Symbol        string `json:"symbol"`
+		MarginMode    int    `json:"marginMode"`
+		LongLeverage  string `json:"longLeverage"`
+		ShortLeverage string `json:"shortLeverage"`
+	}
+	if err := decodeBody(body, &req); err != nil {
+		return "bad request body: " + err.Error(), http.StatusBadRequest
+	}
+	st := s.settings[req.Symbol]
+	if st == nil || marginModeName(req.MarginMode) != st.MarginMode {
+		return "marginMode does not match the account", http.StatusBadRequest
+	}
+	long, err1 := strconv.ParseFloat(req.LongLeverage, 64)
+	short, err2 := strconv.ParseFloat(req.ShortLeverage, 64)
+	if err1 != nil || err2 != nil || long < 1 || long > 125 || short < 1 || short > 125 {
+		return "invalid leverage", http.StatusBadRequest
+	}
+	st.Long, st.Short = long, short
+	return map[string]string{"msg": "success"}, http.StatusOK
+}
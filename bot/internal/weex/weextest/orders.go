@@ -0,0 +1,324 @@
+package weextest
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Order is an order as the fake exchange sees it.
+type Order struct {
+	ID        string
+	ClientOID string
+	Symbol    string
+	// Type is the WEEX order type: 1 open long, 2 open short, 3 close
+	// long, 4 close short.
+	Type     string
+	Market   bool
+	PostOnly bool
+	Price    float64
+	Size     float64
+	Filled   float64
+	AvgPrice float64
+	Status   string // open, filled, canceled
+	Created  time.Time
+}
+
+type posKey struct{ symbol, side string }
+
+// Position is one side of one symbol; Side is LONG or SHORT.
+type Position struct {
+	Symbol     string
+	Side       string
+	Size       float64
+	EntryPrice float64
+}
+
+// Orders returns a copy of every order placed, oldest first.
+func (s *Server) Orders() []Order {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Order, len(s.orders))
+	for i, o := range s.orders {
+		out[i] = *o
+	}
+	return out
+}
+
+// Positions returns the open positions sorted by symbol and side.
+func (s *Server) Positions() []Position {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Position
+	for _, p := range s.positions {
+		if p.Size > 0 {
+			out = append(out, *p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Symbol != out[j].Symbol {
+			return out[i].Symbol < out[j].Symbol
+		}
+		return out[i].Side < out[j].Side
+	})
+	return out
+}
+
+// Equity is the USDT balance after realized PnL and fees.
+func (s *Server) Equity() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.equity
+}
+
+// SetPosition opens or replaces a position directly, e.g. to test
+// flatten-on-start.
+func (s *Server) SetPosition(p Position) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp := p
+	s.positions[posKey{p.Symbol, p.Side}] = &cp
+}
+
+func orderSide(typ string) (side string, opening, buy bool) {
+	switch typ {
+	case "1":
+		return "LONG", true, true
+	case "2":
+		return "SHORT", true, false
+	case "3":
+		return "LONG", false, false
+	case "4":
+		return "SHORT", false, true
+	}
+	return "", false, false
+}
+
+func orderType(o *Order) string {
+	if o.PostOnly {
+		return "1"
+	}
+	return "0"
+}
+
+type placeReq struct {
+	Symbol     string `json:"symbol"`
+	ClientOID  string `json:"client_oid"`
+	Size       string `json:"size"`
+	Type       string `json:"type"`
+	OrderType  string `json:"order_type"`
+	MatchPrice string `json:"match_price"`
+	Price      string `json:"price"`
+}
+
+func (s *Server) handlePlaceOrder(w http.ResponseWriter, r *http.Request, body []byte) (any, int) {
+	var req placeReq
+	if err := decodeBody(body, &req); err != nil {
+		return "bad request body: " + err.Error(), http.StatusBadRequest
+	}
+	if _, ok := s.markets[req.Symbol]; !ok {
+		return "unknown symbol", http.StatusBadRequest
+	}
+	side, opening, _ := orderSide(req.Type)
+	if side == "" {
+		return "invalid type " + req.Type, http.StatusBadRequest
+	}
+	size, err := strconv.ParseFloat(req.Size, 64)
+	if err != nil || size <= 0 {
+		return "invalid size", http.StatusBadRequest
+	}
+	o := &Order{ClientOID: req.ClientOID, Symbol: req.Symbol, Type: req.Type, Market: req.MatchPrice == "1", PostOnly: req.OrderType == "1", Size: size, Status: "open", Created: s.now()}
+	if !o.Market {
+		if o.Price, err = strconv.ParseFloat(req.Price, 64); err != nil || o.Price <= 0 {
+			return "invalid price", http.StatusBadRequest
+		}
+	}
+	if o.PostOnly {
+		_, _, buy := orderSide(req.Type)
+		q := s.markets[req.Symbol].quote()
+		if o.Market || (buy && q.Ask > 0 && o.Price >= q.Ask) || (!buy && q.Bid > 0 && o.Price <= q.Bid) {
+			return "post only order would take liquidity", http.StatusBadRequest
+		}
+	}
+	if !opening {
+		held := 0.0
+		if p := s.positions[posKey{req.Symbol, side}]; p != nil {
+			held = p.Size
+		}
+		if size > held+1e-12 {
+			return "insufficient position to close", http.StatusBadRequest
+		}
+	}
+	o.ID = s.nextID()
+	s.orders = append(s.orders, o)
+	s.matchLocked(req.Symbol)
+	return map[string]string{"client_oid": o.ClientOID, "order_id": o.ID}, http.StatusOK
+}
+
+// matchLocked fires plan orders the last price has reached, then fills
+// open orders of symbol that the current quote crosses:
+// market orders always, limit buys at ask <= price, limit sells at
+// bid >= price.
+func (s *Server) matchLocked(symbol string) {
+	m := s.markets[symbol]
+	if m == nil {
+		return
+	}
+	defer s.dropOrphansLocked(symbol)
+	s.triggerLocked(symbol)
+	q := m.quote()
+	for _, o := range s.orders {
+		if o.Symbol != symbol || o.Status != "open" {
+			continue
+		}
+		_, _, buy := orderSide(o.Type)
+		px := q.Bid
+		if buy {
+			px = q.Ask
+		}
+		switch {
+		case o.Market:
+		case buy && q.Ask > 0 && q.Ask <= o.Price:
+			px = o.Price
+		case !buy && q.Bid > 0 && q.Bid >= o.Price:
+			px = o.Price
+		default:
+			continue
+		}
+		s.fillLocked(o, px)
+	}
+}
+
+func (s *Server) fillLocked(o *Order, px float64) {
+	side, opening, _ := orderSide(o.Type)
+	c := s.contracts[o.Symbol]
+	fee, _ := strconv.ParseFloat(c.makerFee, 64)
+	if o.Market {
+		fee, _ = strconv.ParseFloat(c.takerFee, 64)
+	}
+	k := posKey{o.Symbol, side}
+	p := s.positions[k]
+	if p == nil {
+		p = &Position{Symbol: o.Symbol, Side: side}
+		s.positions[k] = p
+	}
+	size := o.Size
+	if opening {
+		p.EntryPrice = (p.EntryPrice*p.Size + px*size) / (p.Size + size)
+		p.Size += size
+	} else {
+		if size > p.Size {
+			size = p.Size
+		}
+		pnl := (px - p.EntryPrice) * size
+		if side == "SHORT" {
+			pnl = -pnl
+		}
+		s.equity += pnl
+		p.Size -= size
+		if p.Size <= 1e-12 {
+			delete(s.positions, k)
+		}
+	}
+	s.equity -= fee * px * size
+	o.Filled, o.AvgPrice, o.Status = size, px, "filled"
+}
+
+func (s *Server) handleCancelAll(w http.ResponseWriter, r *http.Request, body []byte) (any, int) {
+	var req struct {
+		CancelOrderType string `json:"cancelOrderType"`
+		Symbol          string `json:"symbol"`
+	}
+	if err := decodeBody(body, &req); err != nil {
+		return "bad request body: " + err.Error(), http.StatusBadRequest
+	}
+	type result struct {
+		OrderID string `json:"orderId"`
+		Success bool   `json:"success"`
+	}
+	out := []result{}
+	for _, o := range s.orders {
+		if o.Status != "open" || (req.Symbol != "" && o.Symbol != req.Symbol) {
+			continue
+		}
+		o.Status = "canceled"
+		out = append(out, result{OrderID: o.ID, Success: true})
+	}
+	return out, http.StatusOK
+}
+
+func (s *Server) handleCancelOrder(w http.ResponseWriter, r *http.Request, body []byte) (any, int) {
+	var req struct {
+		OrderID string `json:"orderId"`
+	}
+	if err := decodeBody(body, &req); err != nil {
+		return "bad request body: " + err.Error(), http.StatusBadRequest
+	}
+	for _, o := range s.orders {
+		if o.ID != req.OrderID {
+			continue
+		}
+		if o.Status != "open" {
+			return "order is " + o.Status, http.StatusBadRequest
+		}
+		o.Status = "canceled"
+		return map[string]any{"order_id": o.ID, "result": true}, http.StatusOK
+	}
+	return "order not found", http.StatusBadRequest
+}
+
+func (s *Server) handleOpenOrders(w http.ResponseWriter, r *http.Request, _ []byte) (any, int) {
+	sym := r.URL.Query().Get("symbol")
+	out := []map[string]string{}
+	for _, o := range s.orders {
+		if o.Status != "open" || (sym != "" && o.Symbol != sym) {
+			continue
+		}
+		out = append(out, map[string]string{
+			"symbol": o.Symbol, "order_id": o.ID, "client_oid": o.ClientOID,
+			"size": ff(o.Size), "filled_qty": ff(o.Filled), "price": ff(o.Price), "price_avg": ff(o.AvgPrice),
+			"type": o.Type, "order_type": orderType(o), "status": "0",
+			"createTime": strconv.FormatInt(o.Created.UnixMilli(), 10),
+		})
+	}
+	return out, http.StatusOK
+}
+
+func (s *Server) handleAccounts(w http.ResponseWriter, r *http.Request, _ []byte) (any, int) {
+	type pos struct {
+		ContractID int    `json:"contract_id"`
+		Side       string `json:"side"`
+		MarginMode string `json:"margin_mode"`
+		Leverage   string `json:"leverage"`
+		Size       string `json:"size"`
+	}
+	positions := []pos{}
+	upnl := 0.0
+	for _, p := range s.positions {
+		st := s.settings[p.Symbol]
+		if st == nil {
+			continue
+		}
+		lev := st.Long
+		if p.Side == "SHORT" {
+			lev = st.Short
+		}
+		positions = append(positions, pos{ContractID: s.contracts[p.Symbol].id, Side: p.Side, MarginMode: st.MarginMode, Leverage: ff(lev), Size: ff(p.Size)})
+		if m := s.markets[p.Symbol]; m != nil {
+			d := (m.quote().Mark - p.EntryPrice) * p.Size
+			if p.Side == "SHORT" {
+				d = -d
+			}
+			upnl += d
+		}
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i].ContractID < positions[j].ContractID })
+	return map[string]any{
+		"account": s.accountSettingsLocked(),
+		"collateral": []map[string]any{{
+			"coin_id": 2, "amount": ff(s.equity), "equity": ff(s.equity + upnl), "available": ff(s.equity),
+		}},
+		"position": positions,
+	}, http.StatusOK
+}
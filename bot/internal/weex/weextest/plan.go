@@ -0,0 +1,260 @@
+package weextest
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// Plan is a TP/SL or conditional order waiting for its trigger.
+type Plan struct {
+	ID     string
+	Symbol string
+	// Kind is profit_plan or loss_plan for TP/SL on PositionSide, or plan
+	// for a conditional order of Type.
+	Kind         string
+	PositionSide string // LONG or SHORT
+	Type         string
+	Size         float64
+	Trigger      float64
+	Market       bool
+	Execute      float64
+	Status       string // live, triggered, canceled
+	// rising: a conditional order fires when last reaches Trigger from below
+	rising bool
+}
+
+// Plans returns a copy of every plan order, oldest first.
+func (s *Server) Plans() []Plan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Plan, len(s.plans))
+	for i, p := range s.plans {
+		out[i] = *p
+	}
+	return out
+}
+
+func (s *Server) nextID() string {
+	s.seq++
+	return strconv.Itoa(1000000 + s.seq)
+}
+
+// triggerLocked fires live plans of symbol whose trigger the last price
+// has reached: TP/SL close their position at market, conditional orders
+// are placed as ordinary orders.
+func (s *Server) triggerLocked(symbol string) {
+	m := s.markets[symbol]
+	if m == nil {
+		return
+	}
+	last := m.quote().Last
+	for _, p := range s.plans {
+		if p.Symbol != symbol || p.Status != "live" {
+			continue
+		}
+		long := p.PositionSide == "LONG"
+		var hit bool
+		switch p.Kind {
+		case "loss_plan":
+			hit = (long && last <= p.Trigger) || (!long && last >= p.Trigger)
+		case "profit_plan":
+			hit = (long && last >= p.Trigger) || (!long && last <= p.Trigger)
+		default:
+			hit = (p.rising && last >= p.Trigger) || (!p.rising && last <= p.Trigger)
+		}
+		if !hit {
+			continue
+		}
+		p.Status = "triggered"
+		o := &Order{ID: s.nextID(), Symbol: symbol, Type: p.Type, Market: p.Market, Price: p.Execute, Size: p.Size, Status: "open", Created: s.now()}
+		if p.Kind != "plan" {
+			o.Type, o.Market = "3", true
+			if !long {
+				o.Type = "4"
+			}
+			pos := s.positions[posKey{symbol, p.PositionSide}]
+			if pos == nil {
+				continue
+			}
+			if o.Size > pos.Size {
+				o.Size = pos.Size
+			}
+		}
+		s.orders = append(s.orders, o)
+	}
+}
+
+// dropOrphansLocked cancels TP/SL whose position is gone, as the exchange
+// does when a position closes.
+func (s *Server) dropOrphansLocked(symbol string) {
+	for _, p := range s.plans {
+		if p.Symbol != symbol || p.Status != "live" || p.Kind == "plan" {
+			continue
+		}
+		if pos := s.positions[posKey{symbol, p.PositionSide}]; pos == nil || pos.Size <= 0 {
+			p.Status = "canceled"
+		}
+	}
+}
+
+func (s *Server) handleOrderDetail(w http.ResponseWriter, r *http.Request, _ []byte) (any, int) {
+	id := r.URL.Query().Get("orderId")
+	for _, o := range s.orders {
+		if o.ID != id {
+			continue
+		}
+		return map[string]string{
+			"symbol": o.Symbol, "order_id": o.ID, "client_oid": o.ClientOID,
+			"size": ff(o.Size), "filled_qty": ff(o.Filled), "price_avg": ff(o.AvgPrice),
+			"type": o.Type, "status": o.Status,
+		}, http.StatusOK
+	}
+	return "order not found", http.StatusBadRequest
+}
+
+func (s *Server) handlePlaceTpSl(w http.ResponseWriter, r *http.Request, body []byte) (any, int) {
+	var req struct {
+		Symbol       string `json:"symbol"`
+		PlanType     string `json:"planType"`
+		TriggerPrice string `json:"triggerPrice"`
+		ExecutePrice string `json:"executePrice"`
+		Size         string `json:"size"`
+		PositionSide string `json:"positionSide"`
+	}
+	if err := decodeBody(body, &req); err != nil {
+		return "bad request body: " + err.Error(), http.StatusBadRequest
+	}
+	if req.PlanType != "profit_plan" && req.PlanType != "loss_plan" {
+		return "invalid planType", http.StatusBadRequest
+	}
+	side := map[string]string{"long": "LONG", "short": "SHORT"}[req.PositionSide]
+	pos := s.positions[posKey{req.Symbol, side}]
+	if side == "" || pos == nil || pos.Size <= 0 {
+		return "no position", http.StatusBadRequest
+	}
+	trigger, err := strconv.ParseFloat(req.TriggerPrice, 64)
+	if err != nil || trigger <= 0 {
+		return "invalid triggerPrice", http.StatusBadRequest
+	}
+	size, err := strconv.ParseFloat(req.Size, 64)
+	if err != nil || size <= 0 {
+		return "invalid size", http.StatusBadRequest
+	}
+	p := &Plan{ID: s.nextID(), Symbol: req.Symbol, Kind: req.PlanType, PositionSide: side, Size: size, Trigger: trigger, Market: true, Status: "live"}
+	s.plans = append(s.plans, p)
+	return map[string]string{"order_id": p.ID}, http.StatusOK
+}
+
+func (s *Server) handleModifyTpSl(w http.ResponseWriter, r *http.Request, body []byte) (any, int) {
+	var req struct {
+		OrderID      string `json:"orderId"`
+		TriggerPrice string `json:"triggerPrice"`
+	}
+	if err := decodeBody(body, &req); err != nil {
+		return "bad request body: " + err.Error(), http.StatusBadRequest
+	}
+	p := s.livePlan(req.OrderID)
+	if p == nil || p.Kind == "plan" {
+		return "plan order not found", http.StatusBadRequest
+	}
+	trigger, err := strconv.ParseFloat(req.TriggerPrice, 64)
+	if err != nil || trigger <= 0 {
+		return "invalid triggerPrice", http.StatusBadRequest
+	}
+	p.Trigger = trigger
+	return map[string]string{"order_id": p.ID}, http.StatusOK
+}
+
+func (s *Server) handlePlacePlan(w http.ResponseWriter, r *http.Request, body []byte) (any, int) {
+	var req struct {
+		Symbol       string `json:"symbol"`
+		Size         string `json:"size"`
+		Type         string `json:"type"`
+		MatchPrice   string `json:"match_price"`
+		ExecutePrice string `json:"execute_price"`
+		TriggerPrice string `json:"trigger_price"`
+	}
+	if err := decodeBody(body, &req); err != nil {
+		return "bad request body: " + err.Error(), http.StatusBadRequest
+	}
+	m := s.markets[req.Symbol]
+	side, _, _ := orderSide(req.Type)
+	if m == nil || side == "" {
+		return "invalid symbol or type", http.StatusBadRequest
+	}
+	trigger, err := strconv.ParseFloat(req.TriggerPrice, 64)
+	if err != nil || trigger <= 0 {
+		return "invalid triggerPrice", http.StatusBadRequest
+	}
+	size, err := strconv.ParseFloat(req.Size, 64)
+	if err != nil || size <= 0 {
+		return "invalid size", http.StatusBadRequest
+	}
+	p := &Plan{ID: s.nextID(), Symbol: req.Symbol, Kind: "plan", PositionSide: side, Type: req.Type, Size: size, Trigger: trigger, Market: req.MatchPrice == "1", Status: "live", rising: m.quote().Last < trigger}
+	if !p.Market {
+		if p.Execute, err = strconv.ParseFloat(req.ExecutePrice, 64); err != nil || p.Execute <= 0 {
+			return "invalid execute_price", http.StatusBadRequest
+		}
+	}
+	s.plans = append(s.plans, p)
+	return map[string]string{"order_id": p.ID}, http.StatusOK
+}
+
+func (s *Server) handleCancelPlan(w http.ResponseWriter, r *http.Request, body []byte) (any, int) {
+	var req struct {
+		OrderID string `json:"orderId"`
+	}
+	if err := decodeBody(body, &req); err != nil {
+		return "bad request body: " + err.Error(), http.StatusBadRequest
+	}
+	p := s.livePlan(req.OrderID)
+	if p == nil {
+		return "plan order not found", http.StatusBadRequest
+	}
+	p.Status = "canceled"
+	return map[string]string{"order_id": p.ID}, http.StatusOK
+}
+
+func (s *Server) handlePlanOrders(w http.ResponseWriter, r *http.Request, _ []byte) (any, int) {
+	sym := r.URL.Query().Get("symbol")
+	out := []map[string]string{}
+	for _, p := range s.plans {
+		if p.Status != "live" || (sym != "" && p.Symbol != sym) {
+			continue
+		}
+		out = append(out, map[string]string{
+			"symbol": p.Symbol, "order_id": p.ID, "type": p.Kind,
+			"size": ff(p.Size), "trigger_price": ff(p.Trigger), "status": "0",
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i]["order_id"] < out[j]["order_id"] })
+	return out, http.StatusOK
+}
+
+// handlePlanHistory lists plans that are no longer live; startTime is not
+// applied, the fake keeps every plan.
+func (s *Server) handlePlanHistory(w http.ResponseWriter, r *http.Request, _ []byte) (any, int) {
+	sym := r.URL.Query().Get("symbol")
+	out := []map[string]string{}
+	for _, p := range s.plans {
+		if p.Status == "live" || (sym != "" && p.Symbol != sym) {
+			continue
+		}
+		out = append(out, map[string]string{
+			"symbol": p.Symbol, "order_id": p.ID, "type": p.Kind,
+			"size": ff(p.Size), "trigger_price": ff(p.Trigger), "status": p.Status,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i]["order_id"] < out[j]["order_id"] })
+	return out, http.StatusOK
+}
+
+func (s *Server) livePlan(id string) *Plan {
+	for _, p := range s.plans {
+		if p.ID == id && p.Status == "live" {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,465 @@
+// Package weextest runs an in-process fake of the WEEX contract API for
+// exercising weex.Client, the traders and the engine offline. It serves
+// the market, account, order and plan order endpoints the bot uses,
+// verifies request signatures, and can add latency, inject failures and
+// walk a scripted price path.
+package weextest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/weex/ai_trading/bot/internal/config"
+)
+
+// Fault is a failure the server returns instead of a normal response.
+type Fault int
+
+const (
+	FaultRateLimit   Fault = iota // 429 with a WEEX-style error body
+	FaultServerError              // 503
+	FaultMalformed                // 200 with a truncated JSON body
+	FaultTimeout                  // hangs until the client gives up
+)
+
+// Quote is the market state of one symbol at one step of the price path.
+type Quote struct {
+	Last        float64
+	Bid         float64
+	Ask         float64
+	Mark        float64
+	Index       float64
+	FundingRate float64
+	// BidSize/AskSize are the quantity at each generated depth level;
+	// zero means 1.
+	BidSize float64
+	AskSize float64
+}
+
+type Config struct {
+	APIKey     string
+	APISecret  string
+	Passphrase string
+	Symbols    []string
+	// Latency delays every response.
+	Latency time.Duration
+	// ClockOffset shifts the server clock relative to local time, to
+	// exercise drift handling.
+	ClockOffset time.Duration
+	// RecvWindow is how far a signed timestamp may be from the server
+	// clock; default 30s.
+	RecvWindow time.Duration
+	// Equity is the starting USDT balance; default 10000.
+	Equity float64
+	// AutoStep advances a symbol's price path after each ticker request.
+	AutoStep bool
+}
+
+type fault struct {
+	path string
+	kind Fault
+	left int
+}
+
+type market struct {
+	path []Quote
+	i    int
+}
+
+func (m *market) quote() Quote { return m.path[m.i] }
+
+type Server struct {
+	srv *httptest.Server
+	URL string
+
+	mu        sync.Mutex
+	cfg       Config
+	markets   map[string]*market
+	contracts map[string]contract
+	faults    []fault
+	hits      map[string]int
+	orders    []*Order
+	plans     []*Plan
+	positions map[posKey]*Position
+	settings  map[string]*Settings
+	equity    float64
+	seq       int
+	offset    atomic.Int64 // ClockOffset, adjustable while serving
+}
+
+type contract struct {
+	id                 int
+	tick, step         string
+	makerFee, takerFee string
+}
+
+// New starts a server; call Close when done.
+func New(cfg Config) *Server {
+	if cfg.APIKey == "" {
+		cfg.APIKey, cfg.APISecret, cfg.Passphrase = "test-key", "test-secret", "test-pass"
+	}
+	if len(cfg.Symbols) == 0 {
+		cfg.Symbols = []string{"cmt_btcusdt"}
+	}
+	if cfg.RecvWindow <= 0 {
+		cfg.RecvWindow = 30 * time.Second
+	}
+	if cfg.Equity == 0 {
+		cfg.Equity = 10000
+	}
+	s := &Server{
+		cfg:       cfg,
+		markets:   make(map[string]*market),
+		contracts: make(map[string]contract),
+		hits:      make(map[string]int),
+		positions: make(map[posKey]*Position),
+		settings:  make(map[string]*Settings),
+		equity:    cfg.Equity,
+	}
+	s.offset.Store(int64(cfg.ClockOffset))
+	for i, sym := range cfg.Symbols {
+		s.markets[sym] = &market{path: []Quote{{Last: 100, Bid: 99.9, Ask: 100.1, Mark: 100, Index: 100, FundingRate: 0.0001}}}
+		s.contracts[sym] = contract{id: i + 1, tick: "0.1", step: "0.001", makerFee: "0.0002", takerFee: "0.0006"}
+		s.settings[sym] = &Settings{MarginMode: "SHARED", Long: 20, Short: 20}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/capi/v2/market/time", s.public(s.handleTime))
+	mux.HandleFunc("/capi/v2/market/ticker", s.public(s.handleTicker))
+	mux.HandleFunc("/capi/v2/market/index", s.public(s.handleIndex))
+	mux.HandleFunc("/capi/v2/market/depth", s.public(s.handleDepth))
+	mux.HandleFunc("/capi/v2/market/currentFundRate", s.public(s.handleFundRate))
+	mux.HandleFunc("/capi/v2/market/contracts", s.public(s.handleContracts))
+	mux.HandleFunc("/capi/v2/account/accounts", s.private(s.handleAccounts))
+	mux.HandleFunc("/capi/v2/account/leverage", s.private(s.handleLeverage))
+	mux.HandleFunc("/capi/v2/account/position/changeHoldModel", s.private(s.handleMarginMode))
+	mux.HandleFunc("/capi/v2/order/placeOrder", s.private(s.handlePlaceOrder))
+	mux.HandleFunc("/capi/v2/order/cancelAllOrders", s.private(s.handleCancelAll))
+	mux.HandleFunc("/capi/v2/order/cancel_order", s.private(s.handleCancelOrder))
+	mux.HandleFunc("/capi/v2/order/current", s.private(s.handleOpenOrders))
+	mux.HandleFunc("/capi/v2/order/detail", s.private(s.handleOrderDetail))
+	mux.HandleFunc("/capi/v2/order/placeTpSlOrder", s.private(s.handlePlaceTpSl))
+	mux.HandleFunc("/capi/v2/order/modifyTpSlOrder", s.private(s.handleModifyTpSl))
+	mux.HandleFunc("/capi/v2/order/plan_order", s.private(s.handlePlacePlan))
+	mux.HandleFunc("/capi/v2/order/cancel_plan", s.private(s.handleCancelPlan))
+	mux.HandleFunc("/capi/v2/order/currentPlan", s.private(s.handlePlanOrders))
+	mux.HandleFunc("/capi/v2/order/historyPlan", s.private(s.handlePlanHistory))
+	s.srv = httptest.NewServer(mux)
+	s.URL = s.srv.URL
+	return s
+}
+
+func (s *Server) Close() { s.srv.Close() }
+
+// ClientConfig is config.Defaults pointed at the server with matching
+// credentials and symbols.
+func (s *Server) ClientConfig() config.Config {
+	c := config.Defaults()
+	c.BaseURL = s.URL
+	c.APIKey = config.Secret(s.cfg.APIKey)
+	c.APISecret = config.Secret(s.cfg.APISecret)
+	c.Passphrase = config.Secret(s.cfg.Passphrase)
+	c.Symbols = append([]string(nil), s.cfg.Symbols...)
+	return c
+}
+
+// SetQuote replaces symbol's price path with a single quote.
+func (s *Server) SetQuote(symbol string, q Quote) { s.Script(symbol, q) }
+
+// Script sets symbol's price path. The first quote is current; Step moves
+// along the path and stays on the last quote once it is reached.
+func (s *Server) Script(symbol string, path ...Quote) {
+	if len(path) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.markets[symbol] = &market{path: append([]Quote(nil), path...)}
+	if _, ok := s.contracts[symbol]; !ok {
+		s.contracts[symbol] = contract{id: len(s.contracts) + 1, tick: "0.1", step: "0.001", makerFee: "0.0002", takerFee: "0.0006"}
+		s.settings[symbol] = &Settings{MarginMode: "SHARED", Long: 20, Short: 20}
+	}
+	s.matchLocked(symbol)
+}
+
+// Step advances every symbol one quote along its path and fills resting
+// limit orders the new prices cross.
+func (s *Server) Step() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sym := range s.markets {
+		s.stepLocked(sym)
+	}
+}
+
+func (s *Server) stepLocked(symbol string) {
+	m := s.markets[symbol]
+	if m.i < len(m.path)-1 {
+		m.i++
+	}
+	s.matchLocked(symbol)
+}
+
+// SetLatency changes the delay added to every response.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	s.cfg.Latency = d
+	s.mu.Unlock()
+}
+
+// Inject makes the next n requests to path fail with f; path "" matches
+// every endpoint.
+func (s *Server) Inject(path string, f Fault, n int) {
+	s.mu.Lock()
+	s.faults = append(s.faults, fault{path: path, kind: f, left: n})
+	s.mu.Unlock()
+}
+
+// Hits reports how many requests reached path, including failed ones.
+func (s *Server) Hits(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[path]
+}
+
+// SetClockOffset moves the server clock relative to local time, e.g. to
+// simulate local drift during a session.
+func (s *Server) SetClockOffset(d time.Duration) { s.offset.Store(int64(d)) }
+
+func (s *Server) now() time.Time { return time.Now().Add(time.Duration(s.offset.Load())) }
+
+type handler func(w http.ResponseWriter, r *http.Request, body []byte) (any, int)
+
+func (s *Server) public(h handler) http.HandlerFunc  { return s.serve(h, false) }
+func (s *Server) private(h handler) http.HandlerFunc { return s.serve(h, true) }
+
+func (s *Server) serve(h handler, signed bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.hits[r.URL.Path]++
+		latency := s.cfg.Latency
+		f, faulted := s.takeFault(r.URL.Path)
+		s.mu.Unlock()
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if faulted {
+			s.writeFault(w, r, f)
+			return
+		}
+		if signed {
+			if code, msg := s.verify(r, body); code != 0 {
+				writeError(w, http.StatusUnauthorized, code, msg)
+				return
+			}
+		}
+		s.mu.Lock()
+		out, status := h(w, r, body)
+		s.mu.Unlock()
+		if status != http.StatusOK {
+			writeError(w, status, status, fmt.Sprint(out))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	}
+}
+
+func (s *Server) takeFault(path string) (Fault, bool) {
+	for i := range s.faults {
+		f := &s.faults[i]
+		if f.left > 0 && (f.path == "" || f.path == path) {
+			f.left--
+			return f.kind, true
+		}
+	}
+	return 0, false
+}
+
+func (s *Server) writeFault(w http.ResponseWriter, r *http.Request, f Fault) {
+	switch f {
+	case FaultRateLimit:
+		writeError(w, http.StatusTooManyRequests, 429, "Too Many Requests")
+	case FaultServerError:
+		writeError(w, http.StatusServiceUnavailable, 50000, "service unavailable")
+	case FaultMalformed:
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"symbol":"cmt_`))
+	case FaultTimeout:
+		<-r.Context().Done()
+	}
+}
+
+func writeError(w http.ResponseWriter, status, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"code": strconv.Itoa(code), "msg": msg})
+}
+
+// verify checks the WEEX signature scheme: base64(HMAC-SHA256(secret,
+// timestamp + method + path[?query] + body)).
+func (s *Server) verify(r *http.Request, body []byte) (int, string) {
+	if r.Header.Get("ACCESS-KEY") != s.cfg.APIKey {
+		return 40001, "invalid ACCESS-KEY"
+	}
+	if r.Header.Get("ACCESS-PASSPHRASE") != s.cfg.Passphrase {
+		return 40002, "invalid ACCESS-PASSPHRASE"
+	}
+	ts := r.Header.Get("ACCESS-TIMESTAMP")
+	ms, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return 40003, "invalid ACCESS-TIMESTAMP"
+	}
+	if d := s.now().Sub(time.UnixMilli(ms)); d > s.cfg.RecvWindow || d < -s.cfg.RecvWindow {
+		return 40004, "request timestamp expired"
+	}
+	payload := ts + r.Method + r.URL.Path
+	if r.URL.RawQuery != "" {
+		payload += "?" + r.URL.RawQuery
+	}
+	payload += string(body)
+	mac := hmac.New(sha256.New, []byte(s.cfg.APISecret))
+	mac.Write([]byte(payload))
+	want := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(want), []byte(r.Header.Get("ACCESS-SIGN"))) {
+		return 40005, "signature mismatch"
+	}
+	return 0, ""
+}
+
+func (s *Server) market(r *http.Request) (string, *market, bool) {
+	sym := r.URL.Query().Get("symbol")
+	m, ok := s.markets[sym]
+	return sym, m, ok
+}
+
+func ff(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+
+func (s *Server) handleTime(w http.ResponseWriter, r *http.Request, _ []byte) (any, int) {
+	now := s.now()
+	return map[string]any{"epoch": ff(float64(now.UnixMilli()) / 1000), "iso": now.UTC().Format(time.RFC3339Nano), "timestamp": now.UnixMilli()}, http.StatusOK
+}
+
+func (s *Server) handleTicker(w http.ResponseWriter, r *http.Request, _ []byte) (any, int) {
+	sym, m, ok := s.market(r)
+	if !ok {
+		return "unknown symbol", http.StatusBadRequest
+	}
+	q := m.quote()
+	out := map[string]any{
+		"symbol": sym, "last": ff(q.Last), "best_ask": ff(q.Ask), "best_bid": ff(q.Bid),
+		"high_24h": ff(q.Last), "low_24h": ff(q.Last), "volume_24h": "0", "priceChangePercent": "0",
+		"base_volume": "0", "markPrice": ff(q.Mark), "indexPrice": ff(q.Index),
+		"timestamp": strconv.FormatInt(s.now().UnixMilli(), 10),
+	}
+	if s.cfg.AutoStep {
+		s.stepLocked(sym)
+	}
+	return out, http.StatusOK
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request, _ []byte) (any, int) {
+	sym, m, ok := s.market(r)
+	if !ok {
+		return "unknown symbol", http.StatusBadRequest
+	}
+	return map[string]any{"symbol": sym, "index": ff(m.quote().Index), "timestamp": strconv.FormatInt(s.now().UnixMilli(), 10)}, http.StatusOK
+}
+
+func (s *Server) handleDepth(w http.ResponseWriter, r *http.Request, _ []byte) (any, int) {
+	sym, m, ok := s.market(r)
+	if !ok {
+		return "unknown symbol", http.StatusBadRequest
+	}
+	limit := 15
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		limit = n
+	}
+	q := m.quote()
+	tickStr := s.contracts[sym].tick
+	tick, _ := strconv.ParseFloat(tickStr, 64)
+	dec := 0
+	if i := strings.IndexByte(tickStr, '.'); i >= 0 {
+		dec = len(tickStr) - i - 1
+	}
+	levels := func(top, dir, size float64) [][]string {
+		if size == 0 {
+			size = 1
+		}
+		out := make([][]string, limit)
+		for i := range out {
+			out[i] = []string{strconv.FormatFloat(round(top+dir*float64(i)*tick, tick), 'f', dec, 64), ff(size)}
+		}
+		return out
+	}
+	return map[string]any{
+		"asks":      levels(q.Ask, 1, q.AskSize),
+		"bids":      levels(q.Bid, -1, q.BidSize),
+		"timestamp": strconv.FormatInt(s.now().UnixMilli(), 10),
+	}, http.StatusOK
+}
+
+func round(v, tick float64) float64 {
+	if tick <= 0 {
+		return v
+	}
+	return math.Round(v/tick) * tick
+}
+
+func (s *Server) handleFundRate(w http.ResponseWriter, r *http.Request, _ []byte) (any, int) {
+	syms := s.symbolsFor(r)
+	out := make([]map[string]any, 0, len(syms))
+	for _, sym := range syms {
+		out = append(out, map[string]any{"symbol": sym, "fundingRate": ff(s.markets[sym].quote().FundingRate), "collectCycle": 480, "timestamp": s.now().UnixMilli()})
+	}
+	return out, http.StatusOK
+}
+
+func (s *Server) handleContracts(w http.ResponseWriter, r *http.Request, _ []byte) (any, int) {
+	syms := s.symbolsFor(r)
+	out := make([]map[string]any, 0, len(syms))
+	for _, sym := range syms {
+		c := s.contracts[sym]
+		out = append(out, map[string]any{"symbol": sym, "contract_id": c.id, "tick_size": c.tick, "size_increment": c.step, "makerFeeRate": c.makerFee, "takerFeeRate": c.takerFee})
+	}
+	return out, http.StatusOK
+}
+
+// symbolsFor is the ?symbol= filter, or every symbol sorted.
+func (s *Server) symbolsFor(r *http.Request) []string {
+	if sym := r.URL.Query().Get("symbol"); sym != "" {
+		if _, ok := s.markets[sym]; ok {
+			return []string{sym}
+		}
+		return nil
+	}
+	out := make([]string, 0, len(s.markets))
+	for sym := range s.markets {
+		out = append(out, sym)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func decodeBody(body []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	return dec.Decode(v)
+}
@@ -0,0 +1,110 @@
+package weextest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const accountsPath = "/capi/v2/account/accounts"
+
+// signed sends a request to path signed with secret at ts.
+func signed(t *testing.T, s *Server, method, path, body, secret string, ts time.Time) (int, string) {
+	t.Helper()
+	stamp := strconv.FormatInt(ts.UnixMilli(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(stamp + method + path + body))
+	req, err := http.NewRequest(method, s.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("ACCESS-KEY", s.cfg.APIKey)
+	req.Header.Set("ACCESS-PASSPHRASE", s.cfg.Passphrase)
+	req.Header.Set("ACCESS-TIMESTAMP", stamp)
+	req.Header.Set("ACCESS-SIGN", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var e struct {
+		Code string `json:"code"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+	}
+	return resp.StatusCode, e.Code
+}
+
+func TestVerifySignature(t *testing.T) {
+	s := New(Config{})
+	defer s.Close()
+	now := time.Now()
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		secret   string
+		ts       time.Time
+		wantCode string
+	}{
+		{"valid get", "GET", accountsPath, "", s.cfg.APISecret, now, ""},
+		{"valid post", "POST", "/capi/v2/order/placeOrder", `{"symbol":"unknown"}`, s.cfg.APISecret, now, "400"},
+		{"wrong secret", "GET", accountsPath, "", "other", now, "40005"},
+		{"stale timestamp", "GET", accountsPath, "", s.cfg.APISecret, now.Add(-time.Minute), "40004"},
+		{"future timestamp", "GET", accountsPath, "", s.cfg.APISecret, now.Add(time.Minute), "40004"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, code := signed(t, s, tt.method, tt.path, tt.body, tt.secret, tt.ts)
+			if code != tt.wantCode {
+				t.Fatalf("status %d code %q, want code %q", status, code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestVerifyHeaders(t *testing.T) {
+	s := New(Config{})
+	defer s.Close()
+	for _, h := range []struct{ header, code string }{{"ACCESS-KEY", "40001"}, {"ACCESS-PASSPHRASE", "40002"}, {"ACCESS-TIMESTAMP", "40003"}} {
+		req, _ := http.NewRequest("GET", s.URL+accountsPath, nil)
+		req.Header.Set("ACCESS-KEY", s.cfg.APIKey)
+		req.Header.Set("ACCESS-PASSPHRASE", s.cfg.Passphrase)
+		req.Header.Set("ACCESS-TIMESTAMP", strconv.FormatInt(time.Now().UnixMilli(), 10))
+		req.Header.Set(h.header, "bad")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var e struct {
+			Code string `json:"code"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized || e.Code != h.code {
+			t.Errorf("bad %s: status %d code %q, want 401 %s", h.header, resp.StatusCode, e.Code, h.code)
+		}
+	}
+}
+
+func TestClockOffsetMovesWindow(t *testing.T) {
+	s := New(Config{ClockOffset: time.Minute})
+	defer s.Close()
+	if _, code := signed(t, s, "GET", accountsPath, "", s.cfg.APISecret, time.Now()); code != "40004" {
+		t.Fatalf("local time against a server a minute ahead: code %q, want 40004", code)
+	}
+	if _, code := signed(t, s, "GET", accountsPath, "", s.cfg.APISecret, time.Now().Add(time.Minute)); code != "" {
+		t.Fatalf("server time: code %q, want accepted", code)
+	}
+	if got := s.Hits(accountsPath); got != 2 {
+		t.Fatalf("hits = %d, want 2", got)
+	}
+}